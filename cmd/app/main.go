@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -12,14 +13,23 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"remnawave-tg-shop-bot/internal/admin"
+	"remnawave-tg-shop-bot/internal/api"
+	"remnawave-tg-shop-bot/internal/broadcast"
 	"remnawave-tg-shop-bot/internal/cache"
+	"remnawave-tg-shop-bot/internal/channel"
 	"remnawave-tg-shop-bot/internal/config"
 	"remnawave-tg-shop-bot/internal/cryptopay"
 	"remnawave-tg-shop-bot/internal/database"
 	"remnawave-tg-shop-bot/internal/handler"
+	"remnawave-tg-shop-bot/internal/metrics"
 	"remnawave-tg-shop-bot/internal/notification"
+	"remnawave-tg-shop-bot/internal/notifier"
 	"remnawave-tg-shop-bot/internal/payment"
+	"remnawave-tg-shop-bot/internal/promo"
+	"remnawave-tg-shop-bot/internal/referral"
 	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/report"
 	"remnawave-tg-shop-bot/internal/sync"
 	"remnawave-tg-shop-bot/internal/translation"
 	"remnawave-tg-shop-bot/internal/tribute"
@@ -54,16 +64,33 @@ func main() {
 	customerRepository := database.NewCustomerRepository(pool)
 	purchaseRepository := database.NewPurchaseRepository(pool)
 	referralRepository := database.NewReferralRepository(pool)
+	referralContestRepository := database.NewReferralContestRepository(pool)
+	promoCodeRepository := database.NewPromoCodeRepository(pool)
+	broadcastRepository := database.NewBroadcastRepository(pool)
+	adminUserRepository := database.NewAdminUserRepository(pool)
+	subscriptionEventRepository := database.NewSubscriptionEventRepository(pool)
+	provisioningJobRepository := database.NewProvisioningJobRepository(pool)
+	notificationLogRepository := database.NewNotificationLogRepository(pool)
+	winbackRepository := database.NewWinbackRepository(pool)
 
 	cryptoPayClient := cryptopay.NewCryptoPayClient(config.CryptoPayUrl(), config.CryptoPayToken())
-	remnawaveClient := remnawave.NewClient(config.RemnawaveUrl(), config.RemnawaveToken(), config.RemnawaveMode())
+	panels := remnawave.NewPanels()
+	for _, panel := range config.RemnawavePanels() {
+		panels.Add(panel.Name, remnawave.NewClient(panel))
+	}
 	yookasaClient := yookasa.NewClient(config.YookasaUrl(), config.YookasaShopId(), config.YookasaSecretKey())
-	b, err := bot.New(config.TelegramToken(), bot.WithWorkers(3))
+	b, err := bot.New(config.TelegramToken(), bot.WithWorkers(3), bot.WithMiddlewares(handler.BanMiddleware(customerRepository, tm)))
 	if err != nil {
 		panic(err)
 	}
 
-	paymentService := payment.NewPaymentService(tm, purchaseRepository, remnawaveClient, customerRepository, b, cryptoPayClient, yookasaClient, referralRepository, cache)
+	referralService := referral.NewService(referralRepository, referralContestRepository, customerRepository, subscriptionEventRepository, panels, b, tm)
+
+	eventNotifier := notifier.NewNotifier(b, tm)
+
+	usageCache := remnawave.NewUsageCache(panels, 30*time.Second)
+
+	paymentService := payment.NewPaymentService(tm, purchaseRepository, panels, customerRepository, b, cryptoPayClient, yookasaClient, referralRepository, referralService, subscriptionEventRepository, provisioningJobRepository, winbackRepository, eventNotifier, cache, usageCache)
 
 	cronScheduler := setupInvoiceChecker(purchaseRepository, cryptoPayClient, paymentService, yookasaClient)
 	if cronScheduler != nil {
@@ -71,15 +98,78 @@ func main() {
 		defer cronScheduler.Stop()
 	}
 
-	subService := notification.NewSubscriptionService(customerRepository, purchaseRepository, paymentService, b, tm)
+	provisioningCronScheduler := provisioningWorker(paymentService)
+	provisioningCronScheduler.Start()
+	defer provisioningCronScheduler.Stop()
+
+	subService := notification.NewSubscriptionService(customerRepository, purchaseRepository, notificationLogRepository, paymentService, b, tm)
 
 	subscriptionNotificationCronScheduler := subscriptionChecker(subService)
 	subscriptionNotificationCronScheduler.Start()
 	defer subscriptionNotificationCronScheduler.Stop()
 
-	syncService := sync.NewSyncService(remnawaveClient, customerRepository)
+	if config.TrialDays() > 0 {
+		trialCronScheduler := trialScheduler(notification.NewTrialService(customerRepository, notificationLogRepository, winbackRepository, panels, b, tm))
+		trialCronScheduler.Start()
+		defer trialCronScheduler.Stop()
+	}
+
+	if len(config.WinbackSteps()) > 0 {
+		winbackCronScheduler := winbackScheduler(notification.NewWinbackService(customerRepository, winbackRepository, b, tm))
+		winbackCronScheduler.Start()
+		defer winbackCronScheduler.Stop()
+	}
+
+	referralContestCronScheduler := referralContestChecker(referralService)
+	referralContestCronScheduler.Start()
+	defer referralContestCronScheduler.Stop()
+
+	reportService := report.NewService(purchaseRepository, b, tm)
+
+	dailyReportCronScheduler := dailyReportScheduler(reportService)
+	dailyReportCronScheduler.Start()
+	defer dailyReportCronScheduler.Stop()
+
+	syncService := sync.NewSyncService(panels, customerRepository, subscriptionEventRepository, eventNotifier, b, tm)
+
+	go func() {
+		if err := syncService.BackfillPanelUsers(ctx); err != nil {
+			slog.Error("Error backfilling panel users", "error", err)
+		}
+	}()
+
+	if config.SyncCron() != "" {
+		syncCronScheduler := syncScheduler(syncService)
+		syncCronScheduler.Start()
+		defer syncCronScheduler.Stop()
+	}
+
+	promoService := promo.NewService(promoCodeRepository, customerRepository, subscriptionEventRepository, panels)
+
+	accessService := admin.NewAccessService(adminUserRepository)
+	adminService := admin.NewService(customerRepository, purchaseRepository, referralRepository, subscriptionEventRepository, panels, accessService)
+
+	broadcastService := broadcast.NewService(broadcastRepository, customerRepository, b, tm)
+	if err := broadcastService.Resume(ctx); err != nil {
+		slog.Error("Error resuming broadcasts", "error", err)
+	}
+
+	nodeStatusCache := remnawave.NewNodeStatusCache(panels, time.Minute)
+
+	if config.AdminLogChatId() != 0 {
+		nodeMonitorCronScheduler := nodeMonitorScheduler(notification.NewNodeMonitor(nodeStatusCache, eventNotifier))
+		nodeMonitorCronScheduler.Start()
+		defer nodeMonitorCronScheduler.Stop()
+	}
+
+	channelService := channel.NewService(customerRepository, subscriptionEventRepository, panels, b, tm)
+	if config.ChannelBonusDays() > 0 {
+		channelBonusCronScheduler := channelBonusChecker(channelService)
+		channelBonusCronScheduler.Start()
+		defer channelBonusCronScheduler.Stop()
+	}
 
-	h := handler.NewHandler(syncService, paymentService, tm, customerRepository, purchaseRepository, cryptoPayClient, yookasaClient, referralRepository, cache)
+	h := handler.NewHandler(syncService, paymentService, tm, customerRepository, purchaseRepository, winbackRepository, cryptoPayClient, yookasaClient, referralRepository, referralService, promoService, broadcastService, adminService, accessService, eventNotifier, reportService, usageCache, nodeStatusCache, channelService, cache)
 
 	me, err := b.GetMe(ctx)
 	if err != nil {
@@ -111,32 +201,100 @@ func main() {
 
 	config.SetBotURL(fmt.Sprintf("https://t.me/%s", me.Username))
 
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/start", bot.MatchTypePrefix, h.StartCommandHandler)
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/connect", bot.MatchTypeExact, h.ConnectCommandHandler, h.CreateCustomerIfNotExistMiddleware)
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/sync", bot.MatchTypeExact, h.SyncUsersCommandHandler, isAdminMiddleware)
-
-	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackReferral, bot.MatchTypeExact, h.ReferralCallbackHandler, h.CreateCustomerIfNotExistMiddleware)
-	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackBuy, bot.MatchTypeExact, h.BuyCallbackHandler, h.CreateCustomerIfNotExistMiddleware)
-	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackTrial, bot.MatchTypeExact, h.TrialCallbackHandler, h.CreateCustomerIfNotExistMiddleware)
-	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackActivateTrial, bot.MatchTypeExact, h.ActivateTrialCallbackHandler, h.CreateCustomerIfNotExistMiddleware)
-	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackStart, bot.MatchTypeExact, h.StartCallbackHandler, h.CreateCustomerIfNotExistMiddleware)
-	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackSell, bot.MatchTypePrefix, h.SellCallbackHandler, h.CreateCustomerIfNotExistMiddleware)
-	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackConnect, bot.MatchTypeExact, h.ConnectCallbackHandler, h.CreateCustomerIfNotExistMiddleware)
-	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackPayment, bot.MatchTypePrefix, h.PaymentCallbackHandler, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandlerMatchFunc(func(update *models.Update) bool {
+		if update.Message == nil || update.Message.From == nil {
+			return false
+		}
+		step, _ := broadcastService.PendingInput(update.Message.From.ID)
+		return step != broadcast.InputNone && (update.Message.Text == "/cancel" || !strings.HasPrefix(update.Message.Text, "/"))
+	}, metrics.InstrumentHandler(h.BroadcastInputHandler), h.AdminMiddleware(admin.PermissionBroadcast))
+
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/start", bot.MatchTypePrefix, metrics.InstrumentHandler(h.StartCommandHandler))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/connect", bot.MatchTypeExact, metrics.InstrumentHandler(h.ConnectCommandHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/status", bot.MatchTypeExact, metrics.InstrumentHandler(h.StatusCommandHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "sync", bot.MatchTypeCommandStartOnly, metrics.InstrumentHandler(h.SyncUsersCommandHandler), h.AdminMiddleware(admin.PermissionSync))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/contest_start", bot.MatchTypePrefix, metrics.InstrumentHandler(h.ContestStartCommandHandler), h.AdminMiddleware(admin.PermissionContest))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/contest_stop", bot.MatchTypeExact, metrics.InstrumentHandler(h.ContestStopCommandHandler), h.AdminMiddleware(admin.PermissionContest))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/contest", bot.MatchTypeExact, metrics.InstrumentHandler(h.ContestCommandHandler), h.AdminMiddleware(admin.PermissionContest))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/admin", bot.MatchTypeExact, metrics.InstrumentHandler(h.AdminCommandHandler), h.AdminMiddleware(admin.PermissionPanel))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/broadcast", bot.MatchTypeExact, metrics.InstrumentHandler(h.BroadcastCommandHandler), h.AdminMiddleware(admin.PermissionBroadcast))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/admins", bot.MatchTypeExact, metrics.InstrumentHandler(h.AdminsCommandHandler), h.AdminMiddleware(admin.PermissionAdmins))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "admin_add", bot.MatchTypeCommandStartOnly, metrics.InstrumentHandler(h.AdminAddCommandHandler), h.AdminMiddleware(admin.PermissionAdmins))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "admin_remove", bot.MatchTypeCommandStartOnly, metrics.InstrumentHandler(h.AdminRemoveCommandHandler), h.AdminMiddleware(admin.PermissionAdmins))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "user", bot.MatchTypeCommandStartOnly, metrics.InstrumentHandler(h.UserCommandHandler), h.AdminMiddleware(admin.PermissionUsersView))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "extend", bot.MatchTypeCommandStartOnly, metrics.InstrumentHandler(h.ExtendCommandHandler), h.AdminMiddleware(admin.PermissionUsersManage))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "report", bot.MatchTypeCommandStartOnly, metrics.InstrumentHandler(h.ReportCommandHandler), h.AdminMiddleware(admin.PermissionReports))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "ban", bot.MatchTypeCommandStartOnly, metrics.InstrumentHandler(h.BanCommandHandler), h.AdminMiddleware(admin.PermissionUsersManage))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "refund", bot.MatchTypeCommandStartOnly, metrics.InstrumentHandler(h.RefundCommandHandler), h.AdminMiddleware(admin.PermissionRefund))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "unban", bot.MatchTypeCommandStartOnly, metrics.InstrumentHandler(h.UnbanCommandHandler), h.AdminMiddleware(admin.PermissionUsersManage))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "promo_create", bot.MatchTypeCommandStartOnly, metrics.InstrumentHandler(h.PromoCreateCommandHandler), h.AdminMiddleware(admin.PermissionPromo))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "promo_disable", bot.MatchTypeCommandStartOnly, metrics.InstrumentHandler(h.PromoDisableCommandHandler), h.AdminMiddleware(admin.PermissionPromo))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "promo", bot.MatchTypeCommandStartOnly, metrics.InstrumentHandler(h.PromoCommandHandler), h.CreateCustomerIfNotExistMiddleware)
+
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdmin, bot.MatchTypeExact, metrics.InstrumentHandler(h.AdminCallbackHandler), h.AdminMiddleware(admin.PermissionPanel))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminStats, bot.MatchTypeExact, metrics.InstrumentHandler(h.AdminStatsCallbackHandler), h.AdminMiddleware(admin.PermissionStats))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminUsers, bot.MatchTypeExact, metrics.InstrumentHandler(h.AdminUsersCallbackHandler), h.AdminMiddleware(admin.PermissionUsersView))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminPromo, bot.MatchTypeExact, metrics.InstrumentHandler(h.AdminPromoCallbackHandler), h.AdminMiddleware(admin.PermissionPromo))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminSync, bot.MatchTypeExact, metrics.InstrumentHandler(h.AdminSyncCallbackHandler), h.AdminMiddleware(admin.PermissionSync))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminSyncApply, bot.MatchTypeExact, metrics.InstrumentHandler(h.AdminSyncApplyCallbackHandler), h.AdminMiddleware(admin.PermissionSync))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminUserInfo, bot.MatchTypePrefix, metrics.InstrumentHandler(h.AdminUserInfoCallbackHandler), h.AdminMiddleware(admin.PermissionUsersView))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminUserExtend, bot.MatchTypePrefix, metrics.InstrumentHandler(h.AdminUserExtendCallbackHandler), h.AdminMiddleware(admin.PermissionUsersManage))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminUserResetTraffic, bot.MatchTypePrefix, metrics.InstrumentHandler(h.AdminUserResetTrafficCallbackHandler), h.AdminMiddleware(admin.PermissionUsersManage))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminUserResetTrial, bot.MatchTypePrefix, metrics.InstrumentHandler(h.AdminUserResetTrialCallbackHandler), h.AdminMiddleware(admin.PermissionUsersManage))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminUserDisable, bot.MatchTypePrefix, metrics.InstrumentHandler(h.AdminUserDisableCallbackHandler), h.AdminMiddleware(admin.PermissionUsersManage))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminUserEnable, bot.MatchTypePrefix, metrics.InstrumentHandler(h.AdminUserEnableCallbackHandler), h.AdminMiddleware(admin.PermissionUsersManage))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminUserRegenerateLink, bot.MatchTypePrefix, metrics.InstrumentHandler(h.AdminUserRegenerateLinkCallbackHandler), h.AdminMiddleware(admin.PermissionUsersManage))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminUserResendConnect, bot.MatchTypePrefix, metrics.InstrumentHandler(h.AdminUserResendConnectCallbackHandler), h.AdminMiddleware(admin.PermissionUsersManage))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminUserHistory, bot.MatchTypePrefix, metrics.InstrumentHandler(h.AdminUserHistoryCallbackHandler), h.AdminMiddleware(admin.PermissionUsersView))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminBroadcast, bot.MatchTypeExact, metrics.InstrumentHandler(h.AdminBroadcastCallbackHandler), h.AdminMiddleware(admin.PermissionBroadcast))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackBroadcastButtons, bot.MatchTypePrefix, metrics.InstrumentHandler(h.BroadcastButtonsCallbackHandler), h.AdminMiddleware(admin.PermissionBroadcast))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackBroadcastSegment, bot.MatchTypePrefix, metrics.InstrumentHandler(h.BroadcastSegmentCallbackHandler), h.AdminMiddleware(admin.PermissionBroadcast))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackBroadcastStart, bot.MatchTypePrefix, metrics.InstrumentHandler(h.BroadcastStartCallbackHandler), h.AdminMiddleware(admin.PermissionBroadcast))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackBroadcastStatus, bot.MatchTypePrefix, metrics.InstrumentHandler(h.BroadcastStatusCallbackHandler), h.AdminMiddleware(admin.PermissionBroadcast))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackBroadcastCancel, bot.MatchTypePrefix, metrics.InstrumentHandler(h.BroadcastCancelCallbackHandler), h.AdminMiddleware(admin.PermissionBroadcast))
+
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackReferral, bot.MatchTypeExact, metrics.InstrumentHandler(h.ReferralCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackBuy, bot.MatchTypeExact, metrics.InstrumentHandler(h.BuyCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackLocation, bot.MatchTypeExact, metrics.InstrumentHandler(h.LocationCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackLocationSet, bot.MatchTypePrefix, metrics.InstrumentHandler(h.LocationSetCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackTrial, bot.MatchTypeExact, metrics.InstrumentHandler(h.TrialCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackTrialChannel, bot.MatchTypeExact, metrics.InstrumentHandler(h.TrialCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackChannelBonus, bot.MatchTypeExact, metrics.InstrumentHandler(h.ChannelBonusCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackChannelCheck, bot.MatchTypeExact, metrics.InstrumentHandler(h.ChannelBonusCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackActivateTrial, bot.MatchTypeExact, metrics.InstrumentHandler(h.ActivateTrialCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackStart, bot.MatchTypeExact, metrics.InstrumentHandler(h.StartCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackSell, bot.MatchTypePrefix, metrics.InstrumentHandler(h.SellCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackConnect, bot.MatchTypeExact, metrics.InstrumentHandler(h.ConnectCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackServerStatus, bot.MatchTypeExact, metrics.InstrumentHandler(h.ServerStatusCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackResetLink, bot.MatchTypeExact, metrics.InstrumentHandler(h.ResetLinkCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackResetLinkDo, bot.MatchTypeExact, metrics.InstrumentHandler(h.ResetLinkConfirmCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackPayment, bot.MatchTypePrefix, metrics.InstrumentHandler(h.PaymentCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandlerMatchFunc(func(update *models.Update) bool {
+		return update.Message != nil && update.Message.Contact != nil
+	}, metrics.InstrumentHandler(h.ContactHandler), h.CreateCustomerIfNotExistMiddleware)
 	b.RegisterHandlerMatchFunc(func(update *models.Update) bool {
 		return update.PreCheckoutQuery != nil
-	}, h.PreCheckoutCallbackHandler, h.CreateCustomerIfNotExistMiddleware)
+	}, metrics.InstrumentHandler(h.PreCheckoutCallbackHandler), h.CreateCustomerIfNotExistMiddleware)
 
 	b.RegisterHandlerMatchFunc(func(update *models.Update) bool {
 		return update.Message != nil && update.Message.SuccessfulPayment != nil
-	}, h.SuccessPaymentHandler)
+	}, metrics.InstrumentHandler(h.SuccessPaymentHandler))
 
 	mux := http.NewServeMux()
-	mux.Handle("/healthcheck", fullHealthHandler(pool, remnawaveClient))
+	mux.Handle("/healthcheck", fullHealthHandler(pool, panels))
+	mux.Handle("/metrics", metrics.Handler())
 	if config.GetTributeWebHookUrl() != "" {
-		tributeHandler := tribute.NewClient(paymentService, customerRepository)
+		tributeHandler := tribute.NewClient(paymentService, customerRepository, eventNotifier)
 		mux.Handle(config.GetTributeWebHookUrl(), tributeHandler.WebHookHandler())
 	}
+	if config.RemnawaveWebhookURL() != "" {
+		panelWebhook := notification.NewPanelWebhook(customerRepository, notificationLogRepository, subscriptionEventRepository, b, tm)
+		mux.Handle(config.RemnawaveWebhookURL(), panelWebhook.Handler())
+	}
+	if config.AdminAPIToken() != "" {
+		apiServer := api.NewServer(customerRepository, purchaseRepository, adminService, promoService, syncService)
+		mux.Handle("/api/v1/", apiServer.Handler())
+	}
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", config.GetHealthCheckPort()),
@@ -160,60 +318,194 @@ func main() {
 	}
 }
 
-func fullHealthHandler(pool *pgxpool.Pool, rw *remnawave.Client) http.Handler {
+// fullHealthHandler checks the database and every Remnawave panel. "remnawave" is ok only when all panels answer,
+// "panels" has the result per panel.
+func fullHealthHandler(pool *pgxpool.Pool, panels *remnawave.Panels) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		status := map[string]string{
-			"status": "ok",
-			"db":     "ok",
-			"rw":     "ok",
-			"time":   time.Now().Format(time.RFC3339),
-		}
+		status := struct {
+			Status    string            `json:"status"`
+			DB        string            `json:"db"`
+			Remnawave string            `json:"remnawave"`
+			Panels    map[string]string `json:"panels"`
+			Time      string            `json:"time"`
+		}{Status: "ok", DB: "ok", Remnawave: "ok", Panels: make(map[string]string), Time: time.Now().Format(time.RFC3339)}
 
 		dbCtx, dbCancel := context.WithTimeout(r.Context(), 5*time.Second)
 		defer dbCancel()
 		if err := pool.Ping(dbCtx); err != nil {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			status["status"] = "fail"
-			status["db"] = "error: " + err.Error()
+			status.Status = "fail"
+			status.DB = "error: " + err.Error()
 		}
 
 		rwCtx, rwCancel := context.WithTimeout(r.Context(), 5*time.Second)
 		defer rwCancel()
-		if err := rw.Ping(rwCtx); err != nil {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			status["status"] = "fail"
-			status["rw"] = "error: " + err.Error()
+		for _, name := range panels.Names() {
+			status.Panels[name] = "ok"
+			if err := panels.Get(name).Ping(rwCtx); err != nil {
+				status.Status = "fail"
+				status.Panels[name] = "error: " + err.Error()
+				if status.Remnawave == "ok" {
+					status.Remnawave = fmt.Sprintf("error: %s: %s", name, err.Error())
+				}
+			}
 		}
 
-		if status["status"] == "ok" {
+		w.Header().Set("Content-Type", "application/json")
+		if status.Status == "ok" {
 			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, `{"status":"%s","db":"%s","remnawave":"%s","time":"%s"}`,
-			status["status"], status["db"], status["rw"], status["time"])
+		_ = json.NewEncoder(w).Encode(status)
 	})
 }
 
-func isAdminMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
-	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
-		if update.Message != nil && update.Message.From.ID == config.GetAdminTelegramId() {
-			next(ctx, b, update)
-		} else {
-			return
+func provisioningWorker(paymentService *payment.PaymentService) *cron.Cron {
+	c := cron.New(cron.WithSeconds())
+
+	_, err := c.AddFunc("*/15 * * * * *", metrics.TrackJob("provisioning_queue", func() error {
+		err := paymentService.ProcessProvisioningJobs(context.Background())
+		if err != nil {
+			slog.Error("Error processing provisioning jobs", "error", err)
 		}
+		return err
+	}))
+
+	if err != nil {
+		panic(err)
 	}
+	return c
 }
 
 func subscriptionChecker(subService *notification.SubscriptionService) *cron.Cron {
 	c := cron.New()
 
-	_, err := c.AddFunc("0 16 * * *", func() {
+	_, err := c.AddFunc(config.ExpirationNotifyCron(), metrics.TrackJob("subscription_expiration", func() error {
 		err := subService.ProcessSubscriptionExpiration()
 		if err != nil {
 			slog.Error("Error sending subscription notifications", "error", err)
 		}
-	})
+		return err
+	}))
+
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func trialScheduler(trialService *notification.TrialService) *cron.Cron {
+	c := cron.New()
+
+	_, err := c.AddFunc("*/15 * * * *", metrics.TrackJob("trial", func() error {
+		err := trialService.ProcessTrials(context.Background())
+		if err != nil {
+			slog.Error("Error sending trial messages", "error", err)
+		}
+		return err
+	}))
+
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func winbackScheduler(winbackService *notification.WinbackService) *cron.Cron {
+	c := cron.New()
+
+	_, err := c.AddFunc("30 * * * *", metrics.TrackJob("winback", func() error {
+		err := winbackService.ProcessWinback(context.Background())
+		if err != nil {
+			slog.Error("Error sending winback messages", "error", err)
+		}
+		return err
+	}))
+
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func channelBonusChecker(channelService *channel.Service) *cron.Cron {
+	c := cron.New()
+
+	_, err := c.AddFunc("0 */6 * * *", metrics.TrackJob("channel_bonus", func() error {
+		err := channelService.VerifyBonuses(context.Background())
+		if err != nil {
+			slog.Error("Error verifying channel bonuses", "error", err)
+		}
+		return err
+	}))
+
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func referralContestChecker(referralService *referral.Service) *cron.Cron {
+	c := cron.New()
+
+	_, err := c.AddFunc("*/10 * * * *", metrics.TrackJob("referral_contests", func() error {
+		err := referralService.FinishExpiredContests(context.Background())
+		if err != nil {
+			slog.Error("Error finishing referral contests", "error", err)
+		}
+		return err
+	}))
+
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func dailyReportScheduler(reportService *report.Service) *cron.Cron {
+	c := cron.New()
+
+	_, err := c.AddFunc("5 0 * * *", metrics.TrackJob("daily_report", func() error {
+		err := reportService.SendDaily(context.Background())
+		if err != nil {
+			slog.Error("Error sending daily report", "error", err)
+		}
+		return err
+	}))
+
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func nodeMonitorScheduler(nodeMonitor *notification.NodeMonitor) *cron.Cron {
+	c := cron.New()
+
+	_, err := c.AddFunc("* * * * *", metrics.TrackJob("node_monitor", func() error {
+		err := nodeMonitor.Check(context.Background())
+		if err != nil {
+			slog.Error("Error checking panel nodes", "error", err)
+		}
+		return err
+	}))
+
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func syncScheduler(syncService *sync.SyncService) *cron.Cron {
+	c := cron.New()
+
+	_, err := c.AddFunc(config.SyncCron(), metrics.TrackJob("sync", func() error {
+		err := syncService.RunScheduled(context.Background())
+		if err != nil {
+			slog.Error("Error running scheduled sync", "error", err)
+		}
+		return err
+	}))
 
 	if err != nil {
 		panic(err)
@@ -244,10 +536,11 @@ func setupInvoiceChecker(
 	c := cron.New(cron.WithSeconds())
 
 	if config.IsCryptoPayEnabled() {
-		_, err := c.AddFunc("*/5 * * * * *", func() {
+		_, err := c.AddFunc("*/5 * * * * *", metrics.TrackJob("cryptopay_poller", func() error {
 			ctx := context.Background()
 			checkCryptoPayInvoice(ctx, purchaseRepository, cryptoPayClient, paymentService)
-		})
+			return nil
+		}))
 
 		if err != nil {
 			panic(err)
@@ -255,10 +548,11 @@ func setupInvoiceChecker(
 	}
 
 	if config.IsYookasaEnabled() {
-		_, err := c.AddFunc("*/5 * * * * *", func() {
+		_, err := c.AddFunc("*/5 * * * * *", metrics.TrackJob("yookasa_poller", func() error {
 			ctx := context.Background()
 			checkYookasaInvoice(ctx, purchaseRepository, yookasaClient, paymentService)
-		})
+			return nil
+		}))
 
 		if err != nil {
 			panic(err)
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS referral_contest_winner;
+DROP INDEX IF EXISTS idx_referral_contest_single_active;
+DROP TABLE IF EXISTS referral_contest;
+DROP TABLE IF EXISTS referral_milestone_reward;
+
+ALTER TABLE referral DROP COLUMN IF EXISTS bonus_granted_at;
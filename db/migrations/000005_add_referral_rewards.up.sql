@@ -0,0 +1,39 @@
+ALTER TABLE referral ADD COLUMN IF NOT EXISTS bonus_granted_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE referral
+SET bonus_granted_at = used_at
+WHERE bonus_granted AND bonus_granted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS referral_milestone_reward
+(
+    id          BIGSERIAL PRIMARY KEY,
+    referrer_id BIGINT  NOT NULL REFERENCES customer (telegram_id) ON DELETE CASCADE,
+    referrals   INTEGER NOT NULL,
+    days        INTEGER NOT NULL,
+    granted_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT referral_milestone_reward_unique UNIQUE (referrer_id, referrals)
+);
+
+CREATE TABLE IF NOT EXISTS referral_contest
+(
+    id          BIGSERIAL PRIMARY KEY,
+    status      VARCHAR(20)              NOT NULL DEFAULT 'active',
+    prize_days  INTEGER[]                NOT NULL,
+    started_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ends_at     TIMESTAMP WITH TIME ZONE NOT NULL,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_referral_contest_single_active ON referral_contest (status) WHERE status = 'active';
+
+CREATE TABLE IF NOT EXISTS referral_contest_winner
+(
+    id          BIGSERIAL PRIMARY KEY,
+    contest_id  BIGINT  NOT NULL REFERENCES referral_contest (id) ON DELETE CASCADE,
+    place       INTEGER NOT NULL,
+    referrer_id BIGINT  NOT NULL,
+    referrals   INTEGER NOT NULL,
+    days        INTEGER NOT NULL,
+    rewarded_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT referral_contest_winner_unique UNIQUE (contest_id, place)
+);
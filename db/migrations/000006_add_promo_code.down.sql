@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS promo_code_activation;
+DROP TABLE IF EXISTS promo_code;
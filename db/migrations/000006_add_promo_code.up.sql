@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS promo_code
+(
+    id              BIGSERIAL PRIMARY KEY,
+    code            VARCHAR(64) NOT NULL,
+    days            INTEGER     NOT NULL,
+    max_activations INTEGER     NOT NULL DEFAULT 0,
+    activations     INTEGER     NOT NULL DEFAULT 0,
+    is_active       BOOLEAN     NOT NULL DEFAULT TRUE,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at      TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT promo_code_code_unique UNIQUE (code)
+);
+
+CREATE TABLE IF NOT EXISTS promo_code_activation
+(
+    id            BIGSERIAL PRIMARY KEY,
+    promo_code_id BIGINT NOT NULL REFERENCES promo_code (id) ON DELETE CASCADE,
+    customer_id   BIGINT NOT NULL REFERENCES customer (id) ON DELETE CASCADE,
+    activated_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT promo_code_activation_unique UNIQUE (promo_code_id, customer_id)
+);
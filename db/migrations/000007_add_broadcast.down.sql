@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_broadcast_status;
+DROP TABLE IF EXISTS broadcast;
+
+ALTER TABLE customer DROP COLUMN IF EXISTS bot_blocked_at;
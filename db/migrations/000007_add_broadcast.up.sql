@@ -0,0 +1,25 @@
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS bot_blocked_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS broadcast
+(
+    id               BIGSERIAL PRIMARY KEY,
+    status           VARCHAR(20) NOT NULL DEFAULT 'draft',
+    content_type     VARCHAR(20) NOT NULL,
+    text             TEXT        NOT NULL DEFAULT '',
+    entities         JSONB,
+    file_id          TEXT,
+    buttons          JSONB,
+    segment          VARCHAR(20) NOT NULL DEFAULT 'all',
+    language         VARCHAR(10),
+    created_by       BIGINT      NOT NULL,
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at       TIMESTAMP WITH TIME ZONE,
+    finished_at      TIMESTAMP WITH TIME ZONE,
+    last_customer_id BIGINT      NOT NULL DEFAULT 0,
+    total            INTEGER     NOT NULL DEFAULT 0,
+    delivered        INTEGER     NOT NULL DEFAULT 0,
+    failed           INTEGER     NOT NULL DEFAULT 0,
+    blocked          INTEGER     NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_broadcast_status ON broadcast (status);
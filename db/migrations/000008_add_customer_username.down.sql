@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_customer_username;
+
+ALTER TABLE customer DROP COLUMN IF EXISTS username;
@@ -0,0 +1,3 @@
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS username VARCHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_customer_username ON customer (LOWER(username));
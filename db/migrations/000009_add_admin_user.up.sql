@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS admin_user
+(
+    telegram_id BIGINT PRIMARY KEY,
+    role        VARCHAR(20) NOT NULL,
+    added_by    BIGINT      NOT NULL,
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS subscription_event;
+DROP FUNCTION IF EXISTS subscription_event_append_only();
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS subscription_event
+(
+    id                 BIGSERIAL PRIMARY KEY,
+    customer_id        BIGINT      NOT NULL,
+    telegram_id        BIGINT      NOT NULL,
+    source             VARCHAR(32) NOT NULL,
+    actor              VARCHAR(64) NOT NULL,
+    previous_expire_at TIMESTAMP WITH TIME ZONE,
+    new_expire_at      TIMESTAMP WITH TIME ZONE,
+    traffic_limit      BIGINT,
+    purchase_id        BIGINT,
+    created_at         TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_event_customer_id ON subscription_event (customer_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_subscription_event_telegram_id ON subscription_event (telegram_id);
+
+-- The audit log must survive customer deletion by sync, so there is no foreign key, and rows can never change.
+CREATE OR REPLACE FUNCTION subscription_event_append_only() RETURNS TRIGGER AS
+$$
+BEGIN
+    RAISE EXCEPTION 'subscription_event is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER subscription_event_append_only
+    BEFORE UPDATE OR DELETE
+    ON subscription_event
+    FOR EACH ROW
+EXECUTE FUNCTION subscription_event_append_only();
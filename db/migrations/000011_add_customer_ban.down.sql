@@ -0,0 +1,4 @@
+ALTER TABLE customer
+    DROP COLUMN IF EXISTS banned_at,
+    DROP COLUMN IF EXISTS ban_reason,
+    DROP COLUMN IF EXISTS is_banned;
@@ -0,0 +1,4 @@
+ALTER TABLE customer
+    ADD COLUMN IF NOT EXISTS is_banned  BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS ban_reason TEXT,
+    ADD COLUMN IF NOT EXISTS banned_at  TIMESTAMP WITH TIME ZONE;
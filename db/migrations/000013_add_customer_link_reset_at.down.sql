@@ -0,0 +1,2 @@
+ALTER TABLE customer
+    DROP COLUMN IF EXISTS link_reset_at;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS provisioning_job
+(
+    id          BIGSERIAL PRIMARY KEY,
+    purchase_id BIGINT      NOT NULL UNIQUE REFERENCES purchase (id) ON DELETE CASCADE,
+    status      VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts    INTEGER     NOT NULL DEFAULT 0,
+    last_error  TEXT,
+    next_run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_provisioning_job_due ON provisioning_job (next_run_at) WHERE status = 'pending';
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_customer_panel_uuid;
+
+ALTER TABLE customer
+    DROP COLUMN IF EXISTS panel_short_uuid,
+    DROP COLUMN IF EXISTS panel_uuid;
@@ -0,0 +1,6 @@
+ALTER TABLE customer
+    ADD COLUMN IF NOT EXISTS panel_uuid       UUID,
+    ADD COLUMN IF NOT EXISTS panel_short_uuid VARCHAR(64);
+
+-- Existing customers get their panel user from the panel on the next start, see SyncService.BackfillPanelUsers.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_customer_panel_uuid ON customer (panel_uuid);
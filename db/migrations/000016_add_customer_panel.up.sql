@@ -0,0 +1,2 @@
+ALTER TABLE customer
+    ADD COLUMN IF NOT EXISTS panel VARCHAR(64) NOT NULL DEFAULT '';
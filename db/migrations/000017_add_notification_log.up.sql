@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS notification_log
+(
+    id          BIGSERIAL PRIMARY KEY,
+    customer_id BIGINT                   NOT NULL REFERENCES customer (id) ON DELETE CASCADE,
+    kind        VARCHAR(64)              NOT NULL,
+    expire_at   TIMESTAMP WITH TIME ZONE NOT NULL,
+    sent_at     TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (customer_id, kind, expire_at)
+);
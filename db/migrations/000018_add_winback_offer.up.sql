@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS winback_offer
+(
+    id                  BIGSERIAL PRIMARY KEY,
+    customer_id         BIGINT                   NOT NULL REFERENCES customer (id) ON DELETE CASCADE,
+    step                INTEGER                  NOT NULL,
+    expire_at           TIMESTAMP WITH TIME ZONE NOT NULL,
+    discount_percent    INTEGER                  NOT NULL DEFAULT 0,
+    discount_expires_at TIMESTAMP WITH TIME ZONE,
+    sent_at             TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    converted_at        TIMESTAMP WITH TIME ZONE,
+    purchase_id         BIGINT                   REFERENCES purchase (id) ON DELETE SET NULL,
+    UNIQUE (customer_id, expire_at, step)
+);
+
+CREATE INDEX IF NOT EXISTS idx_winback_offer_customer ON winback_offer (customer_id, sent_at DESC);
@@ -0,0 +1,13 @@
+DELETE FROM winback_offer WHERE campaign <> 'winback';
+
+ALTER TABLE winback_offer
+    DROP CONSTRAINT IF EXISTS winback_offer_campaign_customer_id_expire_at_step_key;
+
+ALTER TABLE winback_offer
+    ADD CONSTRAINT winback_offer_customer_id_expire_at_step_key UNIQUE (customer_id, expire_at, step);
+
+ALTER TABLE winback_offer
+    DROP COLUMN IF EXISTS campaign;
+
+ALTER TABLE customer
+    DROP COLUMN IF EXISTS is_trial;
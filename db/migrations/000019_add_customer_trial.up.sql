@@ -0,0 +1,27 @@
+ALTER TABLE customer
+    ADD COLUMN IF NOT EXISTS is_trial BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Only customers whose subscription still comes from an activated trial: no paid purchase and no other change of
+-- the subscription after the activation.
+UPDATE customer c
+SET is_trial = TRUE
+WHERE c.expire_at IS NOT NULL
+  AND EXISTS (SELECT 1
+              FROM subscription_event t
+              WHERE t.customer_id = c.id
+                AND t.source = 'trial'
+                AND NOT EXISTS (SELECT 1
+                                FROM subscription_event e
+                                WHERE e.customer_id = c.id
+                                  AND e.source <> 'trial'
+                                  AND e.created_at > t.created_at))
+  AND NOT EXISTS (SELECT 1 FROM purchase p WHERE p.customer_id = c.id AND p.status = 'paid');
+
+ALTER TABLE winback_offer
+    ADD COLUMN IF NOT EXISTS campaign VARCHAR(16) NOT NULL DEFAULT 'winback';
+
+ALTER TABLE winback_offer
+    DROP CONSTRAINT IF EXISTS winback_offer_customer_id_expire_at_step_key;
+
+ALTER TABLE winback_offer
+    ADD CONSTRAINT winback_offer_campaign_customer_id_expire_at_step_key UNIQUE (campaign, customer_id, expire_at, step);
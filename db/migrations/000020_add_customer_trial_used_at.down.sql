@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_customer_phone_hash;
+
+ALTER TABLE customer
+    DROP COLUMN IF EXISTS phone_hash;
+ALTER TABLE customer
+    DROP COLUMN IF EXISTS trial_source;
+ALTER TABLE customer
+    DROP COLUMN IF EXISTS trial_used_at;
@@ -0,0 +1,15 @@
+ALTER TABLE customer
+    ADD COLUMN IF NOT EXISTS trial_used_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE customer
+    ADD COLUMN IF NOT EXISTS trial_source VARCHAR(16);
+ALTER TABLE customer
+    ADD COLUMN IF NOT EXISTS phone_hash VARCHAR(64);
+
+-- Customers that ever had a subscription could not take the trial before, keep it that way.
+UPDATE customer
+SET trial_used_at = created_at,
+    trial_source  = 'legacy'
+WHERE trial_used_at IS NULL
+  AND (subscription_link IS NOT NULL OR expire_at IS NOT NULL);
+
+CREATE INDEX IF NOT EXISTS idx_customer_phone_hash ON customer (phone_hash);
@@ -0,0 +1,4 @@
+ALTER TABLE customer
+    DROP COLUMN IF EXISTS channel_bonus_days;
+ALTER TABLE customer
+    DROP COLUMN IF EXISTS channel_bonus_at;
@@ -0,0 +1,4 @@
+ALTER TABLE customer
+    ADD COLUMN IF NOT EXISTS channel_bonus_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE customer
+    ADD COLUMN IF NOT EXISTS channel_bonus_days INTEGER;
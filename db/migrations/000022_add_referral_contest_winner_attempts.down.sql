@@ -0,0 +1,6 @@
+ALTER TABLE referral_contest_winner
+    DROP COLUMN IF EXISTS failed_at;
+ALTER TABLE referral_contest_winner
+    DROP COLUMN IF EXISTS last_error;
+ALTER TABLE referral_contest_winner
+    DROP COLUMN IF EXISTS attempts;
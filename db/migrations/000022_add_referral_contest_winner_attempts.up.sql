@@ -0,0 +1,6 @@
+ALTER TABLE referral_contest_winner
+    ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE referral_contest_winner
+    ADD COLUMN IF NOT EXISTS last_error TEXT;
+ALTER TABLE referral_contest_winner
+    ADD COLUMN IF NOT EXISTS failed_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,348 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+)
+
+const purchaseHistorySize = 10
+
+var (
+	ErrPanelUserNotFound     = errors.New("user not found in remnawave")
+	ErrBanAdmin              = errors.New("admins cannot be banned")
+	ErrPurchaseNotFound      = errors.New("purchase not found")
+	ErrPurchaseNotRefundable = errors.New("only paid purchases can be refunded")
+)
+
+// CustomerInfo is everything support needs to answer a customer in one place.
+type CustomerInfo struct {
+	Customer      *database.Customer
+	PanelUser     *remapi.UserDto
+	PanelError    error
+	Purchases     []database.Purchase
+	Referrals     int
+	PaidReferrals int
+	ReferredBy    *int64
+}
+
+type Service struct {
+	customerRepository *database.CustomerRepository
+	purchaseRepository *database.PurchaseRepository
+	referralRepository *database.ReferralRepository
+	eventRepository    *database.SubscriptionEventRepository
+	panels             *remnawave.Panels
+	accessService      *AccessService
+}
+
+func NewService(
+	customerRepository *database.CustomerRepository,
+	purchaseRepository *database.PurchaseRepository,
+	referralRepository *database.ReferralRepository,
+	eventRepository *database.SubscriptionEventRepository,
+	panels *remnawave.Panels,
+	accessService *AccessService,
+) *Service {
+	return &Service{
+		customerRepository: customerRepository,
+		purchaseRepository: purchaseRepository,
+		referralRepository: referralRepository,
+		eventRepository:    eventRepository,
+		panels:             panels,
+		accessService:      accessService,
+	}
+}
+
+// FindCustomer resolves a telegram id, "@username" or remnawave panel username to a customer. Panel usernames are
+// looked up in every panel.
+func (s *Service) FindCustomer(ctx context.Context, query string) (*database.Customer, error) {
+	query = strings.TrimSpace(query)
+
+	if telegramID, err := strconv.ParseInt(query, 10, 64); err == nil {
+		return s.customerRepository.FindByTelegramId(ctx, telegramID)
+	}
+
+	if strings.HasPrefix(query, "@") {
+		return s.customerRepository.FindByUsername(ctx, query)
+	}
+
+	var telegramID int64
+	for _, name := range s.panels.Names() {
+		id, err := s.panels.Get(name).GetTelegramIdByUsername(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		if id != 0 {
+			telegramID = id
+			break
+		}
+	}
+	if telegramID == 0 {
+		return s.customerRepository.FindByUsername(ctx, query)
+	}
+	return s.customerRepository.FindByTelegramId(ctx, telegramID)
+}
+
+// Lookup collects the customer row, live panel state, purchases and referrals. Panel errors are
+// reported in PanelError so the database part is still shown when remnawave is unavailable.
+func (s *Service) Lookup(ctx context.Context, customer *database.Customer) (*CustomerInfo, error) {
+	info := &CustomerInfo{Customer: customer}
+
+	info.PanelUser, info.PanelError = s.panels.Get(customer.Panel).FindUser(ctx, customer.TelegramID, customer.PanelUUID)
+
+	purchases, err := s.purchaseRepository.FindByCustomerID(ctx, customer.ID, purchaseHistorySize)
+	if err != nil {
+		return nil, err
+	}
+	info.Purchases = purchases
+
+	if info.Referrals, err = s.referralRepository.CountByReferrer(ctx, customer.TelegramID); err != nil {
+		return nil, err
+	}
+	if info.PaidReferrals, err = s.referralRepository.CountPaidByReferrer(ctx, customer.TelegramID); err != nil {
+		return nil, err
+	}
+
+	referral, err := s.referralRepository.FindByReferee(ctx, customer.TelegramID)
+	if err != nil {
+		return nil, err
+	}
+	if referral != nil {
+		info.ReferredBy = &referral.ReferrerID
+	}
+
+	return info, nil
+}
+
+// Extend adds days to the subscription keeping the customer's current traffic limit. The actor is recorded
+// in the subscription audit log.
+func (s *Service) Extend(ctx context.Context, customer *database.Customer, days int, actor string) error {
+	if customer.IsBanned {
+		return database.ErrCustomerBanned
+	}
+	trafficLimit := config.TrafficLimit()
+	panelUser, err := s.panels.Get(customer.Panel).FindUser(ctx, customer.TelegramID, customer.PanelUUID)
+	if err != nil {
+		return err
+	}
+	if panelUser != nil {
+		if limit, ok := panelUser.TrafficLimitBytes.Get(); ok {
+			trafficLimit = limit
+		}
+	}
+
+	user, err := s.panels.Get(customer.Panel).CreateOrUpdateUser(ctx, customer.ID, customer.TelegramID, customer.PanelUUID, trafficLimit, days)
+	if err != nil {
+		return err
+	}
+
+	err = s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
+		"subscription_link": user.GetSubscriptionUrl(),
+		"expire_at":         user.GetExpireAt(),
+		"panel_uuid":        user.UUID,
+		"panel_short_uuid":  user.ShortUuid,
+		"is_trial":          false,
+	})
+	if err != nil {
+		return err
+	}
+
+	limit := int64(trafficLimit)
+	s.eventRepository.Record(ctx, database.SubscriptionEvent{
+		CustomerID:       customer.ID,
+		TelegramID:       customer.TelegramID,
+		Source:           database.SubscriptionEventAdmin,
+		Actor:            actor,
+		PreviousExpireAt: customer.ExpireAt,
+		NewExpireAt:      &user.ExpireAt,
+		TrafficLimit:     &limit,
+	})
+
+	slog.Info("Subscription extended by admin", "customer_id", utils.MaskHalfInt64(customer.ID), "days", days)
+	return nil
+}
+
+// Refund records a purchase that was paid back in the payment system: the purchase is cancelled and its days are
+// taken back from the subscription, but not into the past. The money itself is returned in the payment system.
+func (s *Service) Refund(ctx context.Context, purchaseID int64, actor string) (*database.Purchase, *database.Customer, error) {
+	purchase, err := s.purchaseRepository.FindById(ctx, purchaseID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if purchase == nil {
+		return nil, nil, ErrPurchaseNotFound
+	}
+	if purchase.Status != database.PurchaseStatusPaid {
+		return nil, nil, ErrPurchaseNotRefundable
+	}
+	customer, err := s.customerRepository.FindById(ctx, purchase.CustomerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if customer == nil {
+		return nil, nil, fmt.Errorf("customer %s not found", utils.MaskHalfInt64(purchase.CustomerID))
+	}
+
+	if customer.ExpireAt != nil && customer.ExpireAt.After(time.Now()) {
+		if err := s.takeBackDays(ctx, customer, purchase, actor); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := s.purchaseRepository.UpdateFields(ctx, purchase.ID, map[string]interface{}{
+		"status": database.PurchaseStatusCancel,
+	}); err != nil {
+		return nil, nil, err
+	}
+	purchase.Status = database.PurchaseStatusCancel
+
+	slog.Info("Purchase refunded", "purchase_id", utils.MaskHalfInt64(purchase.ID), "customer_id", utils.MaskHalfInt64(customer.ID))
+	return purchase, customer, nil
+}
+
+func (s *Service) takeBackDays(ctx context.Context, customer *database.Customer, purchase *database.Purchase, actor string) error {
+	panel := s.panels.Get(customer.Panel)
+	panelUser, err := panel.FindUser(ctx, customer.TelegramID, customer.PanelUUID)
+	if err != nil {
+		return err
+	}
+	if panelUser == nil {
+		return ErrPanelUserNotFound
+	}
+	trafficLimit := config.TrafficLimit()
+	if limit, ok := panelUser.TrafficLimitBytes.Get(); ok {
+		trafficLimit = limit
+	}
+
+	expireAt := remnawave.DecreasedExpire(panelUser.ExpireAt, purchase.Month*config.DaysInMonth())
+	user, err := panel.SetExpire(ctx, customer.TelegramID, customer.PanelUUID, trafficLimit, expireAt)
+	if err != nil {
+		return err
+	}
+	if err := s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{"expire_at": user.ExpireAt}); err != nil {
+		return err
+	}
+
+	limit := int64(trafficLimit)
+	s.eventRepository.Record(ctx, database.SubscriptionEvent{
+		CustomerID:       customer.ID,
+		TelegramID:       customer.TelegramID,
+		Source:           database.SubscriptionEventRefund,
+		Actor:            actor,
+		PreviousExpireAt: customer.ExpireAt,
+		NewExpireAt:      &user.ExpireAt,
+		TrafficLimit:     &limit,
+		PurchaseID:       &purchase.ID,
+	})
+	customer.ExpireAt = &user.ExpireAt
+	return nil
+}
+
+// History returns the latest entries of the subscription audit log of the customer.
+func (s *Service) History(ctx context.Context, customer *database.Customer, limit uint64) ([]database.SubscriptionEvent, error) {
+	return s.eventRepository.FindByTelegramId(ctx, customer.TelegramID, limit)
+}
+
+// Ban blocks the customer in the bot and disables the panel user. Customers without a panel user are banned
+// in the bot only. Admins, configured or added with /admin_add, cannot be banned.
+func (s *Service) Ban(ctx context.Context, customer *database.Customer, reason *string) error {
+	_, isAdmin, err := s.accessService.RoleOf(ctx, customer.TelegramID)
+	if err != nil {
+		return err
+	}
+	if isAdmin {
+		return ErrBanAdmin
+	}
+
+	if err := s.customerRepository.SetBanned(ctx, customer.ID, true, reason); err != nil {
+		return err
+	}
+	if err := s.SetEnabled(ctx, customer, false); err != nil && !errors.Is(err, ErrPanelUserNotFound) {
+		return err
+	}
+
+	slog.Info("Customer banned", "customer_id", utils.MaskHalfInt64(customer.ID))
+	return nil
+}
+
+func (s *Service) Unban(ctx context.Context, customer *database.Customer) error {
+	if err := s.customerRepository.SetBanned(ctx, customer.ID, false, nil); err != nil {
+		return err
+	}
+	if err := s.SetEnabled(ctx, customer, true); err != nil && !errors.Is(err, ErrPanelUserNotFound) {
+		return err
+	}
+
+	slog.Info("Customer unbanned", "customer_id", utils.MaskHalfInt64(customer.ID))
+	return nil
+}
+
+// ResetTrial lets the customer take the trial again.
+func (s *Service) ResetTrial(ctx context.Context, customer *database.Customer) error {
+	if err := s.customerRepository.ResetTrial(ctx, customer.ID); err != nil {
+		return err
+	}
+	customer.TrialUsedAt = nil
+	customer.TrialSource = nil
+
+	slog.Info("Trial reset by admin", "customer_id", utils.MaskHalfInt64(customer.ID))
+	return nil
+}
+
+func (s *Service) ResetTraffic(ctx context.Context, customer *database.Customer) error {
+	panelUser, err := s.panelUser(ctx, customer)
+	if err != nil {
+		return err
+	}
+	return s.panels.Get(customer.Panel).ResetUserTraffic(ctx, panelUser.UUID)
+}
+
+func (s *Service) SetEnabled(ctx context.Context, customer *database.Customer, enabled bool) error {
+	panelUser, err := s.panelUser(ctx, customer)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		return s.panels.Get(customer.Panel).EnableUser(ctx, panelUser.UUID)
+	}
+	return s.panels.Get(customer.Panel).DisableUser(ctx, panelUser.UUID)
+}
+
+// RegenerateLink revokes the subscription link in remnawave and stores the new one.
+func (s *Service) RegenerateLink(ctx context.Context, customer *database.Customer) error {
+	panelUser, err := s.panelUser(ctx, customer)
+	if err != nil {
+		return err
+	}
+
+	link, err := s.panels.Get(customer.Panel).RevokeSubscription(ctx, panelUser.UUID)
+	if err != nil {
+		return err
+	}
+
+	customer.SubscriptionLink = &link
+	return s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
+		"subscription_link": link,
+	})
+}
+
+func (s *Service) panelUser(ctx context.Context, customer *database.Customer) (*remapi.UserDto, error) {
+	panelUser, err := s.panels.Get(customer.Panel).FindUser(ctx, customer.TelegramID, customer.PanelUUID)
+	if err != nil {
+		return nil, err
+	}
+	if panelUser == nil {
+		return nil, ErrPanelUserNotFound
+	}
+	return panelUser, nil
+}
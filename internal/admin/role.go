@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+type Role string
+
+const (
+	RoleOwner   Role = "owner"
+	RoleSupport Role = "support"
+	RoleFinance Role = "finance"
+)
+
+type Permission string
+
+const (
+	PermissionPanel       Permission = "panel"
+	PermissionStats       Permission = "stats"
+	PermissionUsersView   Permission = "users_view"
+	PermissionUsersManage Permission = "users_manage"
+	PermissionPromo       Permission = "promo"
+	PermissionBroadcast   Permission = "broadcast"
+	PermissionSync        Permission = "sync"
+	PermissionContest     Permission = "contest"
+	PermissionRefund      Permission = "refund"
+	PermissionAdmins      Permission = "admins"
+	PermissionReports     Permission = "reports"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleSupport: {PermissionPanel, PermissionStats, PermissionUsersView, PermissionUsersManage, PermissionSync},
+	RoleFinance: {PermissionPanel, PermissionStats, PermissionUsersView, PermissionPromo, PermissionReports},
+}
+
+var (
+	ErrInvalidRole  = errors.New("invalid role")
+	ErrOwnerManaged = errors.New("owner is configured by ADMIN_TELEGRAM_ID")
+)
+
+func ParseRole(value string) (Role, error) {
+	switch role := Role(value); role {
+	case RoleOwner, RoleSupport, RoleFinance:
+		return role, nil
+	default:
+		return "", ErrInvalidRole
+	}
+}
+
+// Can reports whether the role grants the permission. The owner can do everything.
+func (r Role) Can(permission Permission) bool {
+	if r == RoleOwner {
+		return true
+	}
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+type roleContextKey struct{}
+
+func WithRole(ctx context.Context, role Role) context.Context {
+	return context.WithValue(ctx, roleContextKey{}, role)
+}
+
+// RoleFromContext returns the role stored by the admin middleware, empty for regular customers.
+func RoleFromContext(ctx context.Context) Role {
+	role, _ := ctx.Value(roleContextKey{}).(Role)
+	return role
+}
+
+// AccessService resolves admin roles from ADMIN_TELEGRAM_ID, ADMINS and the admin_user table, in that order.
+type AccessService struct {
+	adminUserRepository *database.AdminUserRepository
+}
+
+func NewAccessService(adminUserRepository *database.AdminUserRepository) *AccessService {
+	return &AccessService{adminUserRepository: adminUserRepository}
+}
+
+// RoleOf returns the role of the telegram user, or false if they are not an admin.
+func (s *AccessService) RoleOf(ctx context.Context, telegramID int64) (Role, bool, error) {
+	if telegramID == config.GetAdminTelegramId() {
+		return RoleOwner, true, nil
+	}
+	if role, ok := config.Admins()[telegramID]; ok {
+		return Role(role), true, nil
+	}
+
+	admin, err := s.adminUserRepository.FindByTelegramId(ctx, telegramID)
+	if err != nil {
+		return "", false, err
+	}
+	if admin == nil {
+		return "", false, nil
+	}
+	return Role(admin.Role), true, nil
+}
+
+// List returns configured admins together with admins added from the bot.
+func (s *AccessService) List(ctx context.Context) ([]database.AdminUser, error) {
+	admins := []database.AdminUser{{TelegramID: config.GetAdminTelegramId(), Role: string(RoleOwner)}}
+	for telegramID, role := range config.Admins() {
+		admins = append(admins, database.AdminUser{TelegramID: telegramID, Role: role})
+	}
+
+	stored, err := s.adminUserRepository.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(admins, stored...), nil
+}
+
+func (s *AccessService) Add(ctx context.Context, telegramID int64, role Role, addedBy int64) error {
+	if telegramID == config.GetAdminTelegramId() {
+		return ErrOwnerManaged
+	}
+	return s.adminUserRepository.Save(ctx, telegramID, string(role), addedBy)
+}
+
+func (s *AccessService) Remove(ctx context.Context, telegramID int64) (bool, error) {
+	if telegramID == config.GetAdminTelegramId() {
+		return false, ErrOwnerManaged
+	}
+	return s.adminUserRepository.Delete(ctx, telegramID)
+}
@@ -0,0 +1,430 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"remnawave-tg-shop-bot/internal/admin"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/promo"
+	"remnawave-tg-shop-bot/internal/sync"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// Server is the token-protected JSON API for internal tools, mounted under /api/v1 on the health check server.
+type Server struct {
+	customerRepository *database.CustomerRepository
+	purchaseRepository *database.PurchaseRepository
+	adminService       *admin.Service
+	promoService       *promo.Service
+	syncService        *sync.SyncService
+}
+
+func NewServer(
+	customerRepository *database.CustomerRepository,
+	purchaseRepository *database.PurchaseRepository,
+	adminService *admin.Service,
+	promoService *promo.Service,
+	syncService *sync.SyncService,
+) *Server {
+	return &Server{
+		customerRepository: customerRepository,
+		purchaseRepository: purchaseRepository,
+		adminService:       adminService,
+		promoService:       promoService,
+		syncService:        syncService,
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write(openAPISpec)
+	})
+	mux.Handle("GET /api/v1/customers", s.auth(s.listCustomers))
+	mux.Handle("GET /api/v1/customers/{telegramId}", s.auth(s.getCustomer))
+	mux.Handle("GET /api/v1/customers/{telegramId}/purchases", s.auth(s.listCustomerPurchases))
+	mux.Handle("POST /api/v1/customers/{telegramId}/extend", s.auth(s.extendCustomer))
+	mux.Handle("POST /api/v1/customers/{telegramId}/reset-trial", s.auth(s.resetCustomerTrial))
+	mux.Handle("GET /api/v1/purchases", s.auth(s.listPurchases))
+	mux.Handle("POST /api/v1/promo-codes", s.auth(s.createPromoCode))
+	mux.Handle("POST /api/v1/sync", s.auth(s.triggerSync))
+	mux.Handle("GET /api/v1/stats", s.auth(s.stats))
+	return mux
+}
+
+// auth checks the "Authorization: Bearer <ADMIN_API_TOKEN>" header in constant time.
+func (s *Server) auth(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminAPIToken())) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+		next(w, r.WithContext(ctx))
+	})
+}
+
+type page[T any] struct {
+	Items  []T `json:"items"`
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+type customerResponse struct {
+	ID               int64      `json:"id"`
+	TelegramID       int64      `json:"telegram_id"`
+	ExpireAt         *time.Time `json:"expire_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	SubscriptionLink *string    `json:"subscription_link"`
+	Language         string     `json:"language"`
+	TrialUsedAt      *time.Time `json:"trial_used_at"`
+	TrialSource      *string    `json:"trial_source"`
+}
+
+type purchaseResponse struct {
+	ID          int64      `json:"id"`
+	CustomerID  int64      `json:"customer_id"`
+	Amount      float64    `json:"amount"`
+	Currency    string     `json:"currency"`
+	Month       int        `json:"month"`
+	Status      string     `json:"status"`
+	InvoiceType string     `json:"invoice_type"`
+	CreatedAt   time.Time  `json:"created_at"`
+	PaidAt      *time.Time `json:"paid_at"`
+}
+
+func toCustomerResponse(c database.Customer) customerResponse {
+	return customerResponse{
+		ID:               c.ID,
+		TelegramID:       c.TelegramID,
+		ExpireAt:         c.ExpireAt,
+		CreatedAt:        c.CreatedAt,
+		SubscriptionLink: c.SubscriptionLink,
+		Language:         c.Language,
+		TrialUsedAt:      c.TrialUsedAt,
+		TrialSource:      c.TrialSource,
+	}
+}
+
+func toPurchaseResponses(purchases []database.Purchase) []purchaseResponse {
+	result := make([]purchaseResponse, 0, len(purchases))
+	for _, p := range purchases {
+		result = append(result, purchaseResponse{
+			ID:          p.ID,
+			CustomerID:  p.CustomerID,
+			Amount:      p.Amount,
+			Currency:    p.Currency,
+			Month:       p.Month,
+			Status:      string(p.Status),
+			InvoiceType: string(p.InvoiceType),
+			CreatedAt:   p.CreatedAt,
+			PaidAt:      p.PaidAt,
+		})
+	}
+	return result
+}
+
+func (s *Server) listCustomers(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := pagination(w, r)
+	if !ok {
+		return
+	}
+	search := r.URL.Query().Get("search")
+
+	customers, err := s.customerRepository.FindPage(r.Context(), search, uint64(limit), uint64(offset))
+	if err != nil {
+		internalError(w, "Error listing customers", err)
+		return
+	}
+	total, err := s.customerRepository.CountSearch(r.Context(), search)
+	if err != nil {
+		internalError(w, "Error counting customers", err)
+		return
+	}
+
+	items := make([]customerResponse, 0, len(customers))
+	for _, c := range customers {
+		items = append(items, toCustomerResponse(c))
+	}
+	writeJSON(w, http.StatusOK, page[customerResponse]{Items: items, Total: total, Limit: limit, Offset: offset})
+}
+
+func (s *Server) getCustomer(w http.ResponseWriter, r *http.Request) {
+	customer, ok := s.customerFromPath(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, toCustomerResponse(*customer))
+}
+
+func (s *Server) listCustomerPurchases(w http.ResponseWriter, r *http.Request) {
+	customer, ok := s.customerFromPath(w, r)
+	if !ok {
+		return
+	}
+	s.writePurchases(w, r, database.PurchaseFilter{CustomerID: customer.ID})
+}
+
+func (s *Server) listPurchases(w http.ResponseWriter, r *http.Request) {
+	s.writePurchases(w, r, database.PurchaseFilter{
+		Status:      database.PurchaseStatus(r.URL.Query().Get("status")),
+		InvoiceType: database.InvoiceType(r.URL.Query().Get("invoice_type")),
+	})
+}
+
+func (s *Server) writePurchases(w http.ResponseWriter, r *http.Request, filter database.PurchaseFilter) {
+	limit, offset, ok := pagination(w, r)
+	if !ok {
+		return
+	}
+
+	purchases, err := s.purchaseRepository.FindPage(r.Context(), filter, uint64(limit), uint64(offset))
+	if err != nil {
+		internalError(w, "Error listing purchases", err)
+		return
+	}
+	total, err := s.purchaseRepository.Count(r.Context(), filter)
+	if err != nil {
+		internalError(w, "Error counting purchases", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page[purchaseResponse]{Items: toPurchaseResponses(purchases), Total: total, Limit: limit, Offset: offset})
+}
+
+type extendRequest struct {
+	Days int `json:"days"`
+}
+
+func (s *Server) extendCustomer(w http.ResponseWriter, r *http.Request) {
+	customer, ok := s.customerFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req extendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Days <= 0 {
+		writeError(w, http.StatusBadRequest, "days must be a positive number")
+		return
+	}
+
+	err := s.adminService.Extend(r.Context(), customer, req.Days, database.ActorAPI)
+	if errors.Is(err, database.ErrCustomerBanned) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		internalError(w, "Error extending subscription", err)
+		return
+	}
+
+	customer, err = s.customerRepository.FindById(r.Context(), customer.ID)
+	if err != nil {
+		internalError(w, "Error loading customer", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toCustomerResponse(*customer))
+}
+
+func (s *Server) resetCustomerTrial(w http.ResponseWriter, r *http.Request) {
+	customer, ok := s.customerFromPath(w, r)
+	if !ok {
+		return
+	}
+	if err := s.adminService.ResetTrial(r.Context(), customer); err != nil {
+		internalError(w, "Error resetting trial", err)
+		return
+	}
+	customer, err := s.customerRepository.FindById(r.Context(), customer.ID)
+	if err != nil {
+		internalError(w, "Error finding customer", err)
+		return
+	}
+	if customer == nil {
+		writeError(w, http.StatusNotFound, "customer not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, toCustomerResponse(*customer))
+}
+
+type createPromoCodeRequest struct {
+	Code           string `json:"code"`
+	Days           int    `json:"days"`
+	MaxActivations int    `json:"max_activations"`
+	ValidDays      int    `json:"valid_days"`
+}
+
+type promoCodeResponse struct {
+	ID             int64      `json:"id"`
+	Code           string     `json:"code"`
+	Days           int        `json:"days"`
+	MaxActivations int        `json:"max_activations"`
+	Activations    int        `json:"activations"`
+	IsActive       bool       `json:"is_active"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+}
+
+func (s *Server) createPromoCode(w http.ResponseWriter, r *http.Request) {
+	var req createPromoCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.Code == "" || req.Days <= 0 || req.MaxActivations < 0 || req.ValidDays < 0 {
+		writeError(w, http.StatusBadRequest, "code and positive days are required")
+		return
+	}
+
+	promoCode, err := s.promoService.Create(r.Context(), req.Code, req.Days, req.MaxActivations, req.ValidDays)
+	if errors.Is(err, database.ErrPromoCodeAlreadyExists) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		internalError(w, "Error creating promo code", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, promoCodeResponse{
+		ID:             promoCode.ID,
+		Code:           promoCode.Code,
+		Days:           promoCode.Days,
+		MaxActivations: promoCode.MaxActivations,
+		Activations:    promoCode.Activations,
+		IsActive:       promoCode.IsActive,
+		CreatedAt:      promoCode.CreatedAt,
+		ExpiresAt:      promoCode.ExpiresAt,
+	})
+}
+
+// triggerSync starts the synchronization in the background, its result is reported to the admin event feed.
+func (s *Server) triggerSync(w http.ResponseWriter, r *http.Request) {
+	if err := s.syncService.SyncInBackground(); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "started"})
+}
+
+type revenueResponse struct {
+	InvoiceType string  `json:"invoice_type"`
+	Currency    string  `json:"currency"`
+	Amount      float64 `json:"amount"`
+	Count       int     `json:"count"`
+}
+
+type statsResponse struct {
+	Customers           int                          `json:"customers"`
+	ActiveSubscriptions int                          `json:"active_subscriptions"`
+	ActiveTrials        int                          `json:"active_trials"`
+	Revenue             map[string][]revenueResponse `json:"revenue"`
+}
+
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) {
+	customerStats, err := s.customerRepository.Stats(r.Context())
+	if err != nil {
+		internalError(w, "Error loading customer stats", err)
+		return
+	}
+
+	response := statsResponse{
+		Customers:           customerStats.Total,
+		ActiveSubscriptions: customerStats.Active,
+		ActiveTrials:        customerStats.ActiveTrials,
+		Revenue:             make(map[string][]revenueResponse),
+	}
+
+	now := time.Now()
+	periods := map[string]time.Time{
+		"today": time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()),
+		"week":  now.AddDate(0, 0, -7),
+		"month": now.AddDate(0, -1, 0),
+	}
+	for name, since := range periods {
+		revenue, err := s.purchaseRepository.RevenueSince(r.Context(), since)
+		if err != nil {
+			internalError(w, "Error loading revenue", err)
+			return
+		}
+		items := make([]revenueResponse, 0, len(revenue))
+		for _, rev := range revenue {
+			items = append(items, revenueResponse{InvoiceType: string(rev.InvoiceType), Currency: rev.Currency, Amount: rev.Amount, Count: rev.Count})
+		}
+		response.Revenue[name] = items
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) customerFromPath(w http.ResponseWriter, r *http.Request) (*database.Customer, bool) {
+	telegramID, err := strconv.ParseInt(r.PathValue("telegramId"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid telegram id")
+		return nil, false
+	}
+	customer, err := s.customerRepository.FindByTelegramId(r.Context(), telegramID)
+	if err != nil {
+		internalError(w, "Error finding customer", err)
+		return nil, false
+	}
+	if customer == nil {
+		writeError(w, http.StatusNotFound, "customer not found")
+		return nil, false
+	}
+	return customer, true
+}
+
+func pagination(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	limit, offset := defaultLimit, 0
+	var err error
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxLimit {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and 500")
+			return 0, 0, false
+		}
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, "offset must not be negative")
+			return 0, 0, false
+		}
+	}
+	return limit, offset, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("api: write response error", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func internalError(w http.ResponseWriter, msg string, err error) {
+	slog.Error(msg, "error", err)
+	writeError(w, http.StatusInternalServerError, "internal server error")
+}
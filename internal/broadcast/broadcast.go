@@ -0,0 +1,413 @@
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/metrics"
+	"remnawave-tg-shop-bot/internal/translation"
+	"remnawave-tg-shop-bot/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	recipientsBatchSize = 100
+	maxSendAttempts     = 3
+)
+
+var (
+	ErrUnsupportedContent = errors.New("unsupported message content")
+	ErrInvalidButtons     = errors.New("invalid buttons")
+	ErrNotDraft           = errors.New("broadcast is not a draft")
+)
+
+type Button struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// InputStep is what the bot expects as the next message from the admin composing a broadcast.
+type InputStep int
+
+const (
+	InputNone InputStep = iota
+	InputContent
+	InputButtons
+)
+
+type pendingInput struct {
+	step        InputStep
+	broadcastID int64
+}
+
+type Service struct {
+	broadcastRepository *database.BroadcastRepository
+	customerRepository  *database.CustomerRepository
+	telegramBot         *bot.Bot
+	translation         *translation.Manager
+
+	mu      sync.Mutex
+	running map[int64]bool
+	inputs  map[int64]pendingInput
+}
+
+func NewService(
+	broadcastRepository *database.BroadcastRepository,
+	customerRepository *database.CustomerRepository,
+	telegramBot *bot.Bot,
+	translation *translation.Manager,
+) *Service {
+	return &Service{
+		broadcastRepository: broadcastRepository,
+		customerRepository:  customerRepository,
+		telegramBot:         telegramBot,
+		translation:         translation,
+		running:             make(map[int64]bool),
+		inputs:              make(map[int64]pendingInput),
+	}
+}
+
+func (s *Service) AwaitInput(adminID int64, step InputStep, broadcastID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inputs[adminID] = pendingInput{step: step, broadcastID: broadcastID}
+}
+
+func (s *Service) PendingInput(adminID int64) (InputStep, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	input, ok := s.inputs[adminID]
+	if !ok {
+		return InputNone, 0
+	}
+	return input.step, input.broadcastID
+}
+
+func (s *Service) ClearInput(adminID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inputs, adminID)
+}
+
+// CreateDraft stores the content of the admin message as a new broadcast draft.
+func (s *Service) CreateDraft(ctx context.Context, adminID int64, message *models.Message) (int64, error) {
+	draft := &database.Broadcast{CreatedBy: adminID}
+	var entities []models.MessageEntity
+
+	switch {
+	case len(message.Photo) > 0:
+		fileID := message.Photo[len(message.Photo)-1].FileID
+		draft.ContentType = database.BroadcastContentPhoto
+		draft.FileID = &fileID
+		draft.Text = message.Caption
+		entities = message.CaptionEntities
+	case message.Video != nil:
+		fileID := message.Video.FileID
+		draft.ContentType = database.BroadcastContentVideo
+		draft.FileID = &fileID
+		draft.Text = message.Caption
+		entities = message.CaptionEntities
+	case message.Text != "":
+		draft.ContentType = database.BroadcastContentText
+		draft.Text = message.Text
+		entities = message.Entities
+	default:
+		return 0, ErrUnsupportedContent
+	}
+
+	if len(entities) > 0 {
+		raw, err := json.Marshal(entities)
+		if err != nil {
+			return 0, err
+		}
+		draft.Entities = raw
+	}
+
+	return s.broadcastRepository.Create(ctx, draft)
+}
+
+// SetButtons parses one "Text | https://url" button per line and attaches them to the draft.
+func (s *Service) SetButtons(ctx context.Context, id int64, text string) error {
+	var buttons []Button
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "|", 2)
+		if len(parts) != 2 {
+			return ErrInvalidButtons
+		}
+		button := Button{Text: strings.TrimSpace(parts[0]), URL: strings.TrimSpace(parts[1])}
+		if button.Text == "" || !(strings.HasPrefix(button.URL, "https://") || strings.HasPrefix(button.URL, "http://") || strings.HasPrefix(button.URL, "tg://")) {
+			return ErrInvalidButtons
+		}
+		buttons = append(buttons, button)
+	}
+	if len(buttons) == 0 {
+		return ErrInvalidButtons
+	}
+
+	raw, err := json.Marshal(buttons)
+	if err != nil {
+		return err
+	}
+	return s.broadcastRepository.UpdateFields(ctx, id, map[string]interface{}{"buttons": string(raw)})
+}
+
+// SetSegment chooses the audience of the draft and returns the number of recipients.
+func (s *Service) SetSegment(ctx context.Context, id int64, segment database.CustomerSegment, language string) (int, error) {
+	total, err := s.customerRepository.CountBySegment(ctx, segment, language)
+	if err != nil {
+		return 0, err
+	}
+
+	var lang interface{}
+	if segment == database.CustomerSegmentLanguage {
+		lang = language
+	}
+	err = s.broadcastRepository.UpdateFields(ctx, id, map[string]interface{}{
+		"segment":  segment,
+		"language": lang,
+		"total":    total,
+	})
+	return total, err
+}
+
+func (s *Service) Find(ctx context.Context, id int64) (*database.Broadcast, error) {
+	return s.broadcastRepository.FindById(ctx, id)
+}
+
+func (s *Service) Languages(ctx context.Context) ([]string, error) {
+	return s.customerRepository.FindLanguages(ctx)
+}
+
+// Preview sends the broadcast content to the chat exactly as recipients will see it.
+func (s *Service) Preview(ctx context.Context, chatID int64, id int64) error {
+	broadcast, err := s.broadcastRepository.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if broadcast == nil {
+		return fmt.Errorf("broadcast %d not found", id)
+	}
+	return s.send(ctx, chatID, broadcast)
+}
+
+// Start launches a draft broadcast in the background.
+func (s *Service) Start(ctx context.Context, id int64) error {
+	broadcast, err := s.broadcastRepository.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if broadcast == nil || broadcast.Status != database.BroadcastStatusDraft {
+		return ErrNotDraft
+	}
+
+	err = s.broadcastRepository.UpdateFields(ctx, id, map[string]interface{}{
+		"status":     database.BroadcastStatusRunning,
+		"started_at": time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	go s.run(id)
+	return nil
+}
+
+// Cancel discards a draft or stops a running broadcast after the recipient being processed.
+func (s *Service) Cancel(ctx context.Context, id int64) error {
+	broadcast, err := s.broadcastRepository.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if broadcast == nil || (broadcast.Status != database.BroadcastStatusDraft && broadcast.Status != database.BroadcastStatusRunning) {
+		return nil
+	}
+	return s.broadcastRepository.UpdateFields(ctx, id, map[string]interface{}{
+		"status":      database.BroadcastStatusCancelled,
+		"finished_at": time.Now(),
+	})
+}
+
+// Resume continues broadcasts that were running when the bot stopped.
+func (s *Service) Resume(ctx context.Context) error {
+	broadcasts, err := s.broadcastRepository.FindByStatus(ctx, database.BroadcastStatusRunning)
+	if err != nil {
+		return err
+	}
+	for _, broadcast := range broadcasts {
+		slog.Info("Resuming broadcast", "broadcast_id", broadcast.ID, "last_customer_id", broadcast.LastCustomerID)
+		go s.run(broadcast.ID)
+	}
+	return nil
+}
+
+func (s *Service) run(id int64) {
+	s.mu.Lock()
+	if s.running[id] {
+		s.mu.Unlock()
+		return
+	}
+	s.running[id] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, id)
+		s.mu.Unlock()
+	}()
+
+	ctx := context.Background()
+	ticker := time.NewTicker(time.Second / time.Duration(config.BroadcastRate()))
+	defer ticker.Stop()
+
+	for {
+		broadcast, err := s.broadcastRepository.FindById(ctx, id)
+		if err != nil {
+			slog.Error("Error loading broadcast", "broadcast_id", id, "error", err)
+			return
+		}
+		if broadcast == nil || broadcast.Status != database.BroadcastStatusRunning {
+			slog.Info("Broadcast stopped", "broadcast_id", id)
+			return
+		}
+
+		language := ""
+		if broadcast.Language != nil {
+			language = *broadcast.Language
+		}
+		customers, err := s.customerRepository.FindBySegment(ctx, broadcast.Segment, language, broadcast.LastCustomerID, recipientsBatchSize)
+		if err != nil {
+			slog.Error("Error loading broadcast recipients", "broadcast_id", id, "error", err)
+			return
+		}
+		if len(customers) == 0 {
+			s.finish(ctx, id)
+			return
+		}
+
+		for _, customer := range customers {
+			<-ticker.C
+			delivered, failed, blocked := 0, 0, 0
+			err := s.sendWithRetry(ctx, customer.TelegramID, broadcast)
+			metrics.NotificationSent("broadcast", err)
+			switch {
+			case err == nil:
+				delivered = 1
+			case errors.Is(err, bot.ErrorForbidden):
+				blocked = 1
+				if err := s.customerRepository.MarkBotBlocked(ctx, customer.TelegramID); err != nil {
+					slog.Error("Error marking customer as blocked", "error", err)
+				}
+			default:
+				failed = 1
+				slog.Warn("Broadcast delivery failed", "broadcast_id", id, "telegram_id", utils.MaskHalfInt64(customer.TelegramID), "error", err)
+			}
+
+			if err := s.broadcastRepository.SaveProgress(ctx, id, customer.ID, delivered, failed, blocked); err != nil {
+				slog.Error("Error saving broadcast progress", "broadcast_id", id, "error", err)
+				return
+			}
+		}
+	}
+}
+
+func (s *Service) finish(ctx context.Context, id int64) {
+	err := s.broadcastRepository.UpdateFields(ctx, id, map[string]interface{}{
+		"status":      database.BroadcastStatusCompleted,
+		"finished_at": time.Now(),
+	})
+	if err != nil {
+		slog.Error("Error finishing broadcast", "broadcast_id", id, "error", err)
+		return
+	}
+
+	broadcast, err := s.broadcastRepository.FindById(ctx, id)
+	if err != nil || broadcast == nil {
+		slog.Error("Error loading finished broadcast", "broadcast_id", id, "error", err)
+		return
+	}
+	slog.Info("Broadcast completed", "broadcast_id", id, "delivered", broadcast.Delivered, "failed", broadcast.Failed, "blocked", broadcast.Blocked)
+
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    broadcast.CreatedBy,
+		ParseMode: models.ParseModeHTML,
+		Text: fmt.Sprintf(s.translation.GetText("", "broadcast_report"),
+			broadcast.ID, broadcast.Delivered, broadcast.Failed, broadcast.Blocked),
+	})
+	if err != nil {
+		slog.Error("Error sending broadcast report", "error", err)
+	}
+}
+
+func (s *Service) sendWithRetry(ctx context.Context, chatID int64, broadcast *database.Broadcast) error {
+	var err error
+	for attempt := 0; attempt < maxSendAttempts; attempt++ {
+		err = s.send(ctx, chatID, broadcast)
+		var tooMany *bot.TooManyRequestsError
+		if !errors.As(err, &tooMany) {
+			return err
+		}
+		time.Sleep(time.Duration(tooMany.RetryAfter+1) * time.Second)
+	}
+	return err
+}
+
+func (s *Service) send(ctx context.Context, chatID int64, broadcast *database.Broadcast) error {
+	var entities []models.MessageEntity
+	if len(broadcast.Entities) > 0 {
+		if err := json.Unmarshal(broadcast.Entities, &entities); err != nil {
+			return err
+		}
+	}
+
+	var markup models.ReplyMarkup
+	if len(broadcast.Buttons) > 0 {
+		var buttons []Button
+		if err := json.Unmarshal(broadcast.Buttons, &buttons); err != nil {
+			return err
+		}
+		keyboard := make([][]models.InlineKeyboardButton, 0, len(buttons))
+		for _, button := range buttons {
+			keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: button.Text, URL: button.URL}})
+		}
+		markup = models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+	}
+
+	var err error
+	switch broadcast.ContentType {
+	case database.BroadcastContentPhoto:
+		_, err = s.telegramBot.SendPhoto(ctx, &bot.SendPhotoParams{
+			ChatID:          chatID,
+			Photo:           &models.InputFileString{Data: *broadcast.FileID},
+			Caption:         broadcast.Text,
+			CaptionEntities: entities,
+			ReplyMarkup:     markup,
+		})
+	case database.BroadcastContentVideo:
+		_, err = s.telegramBot.SendVideo(ctx, &bot.SendVideoParams{
+			ChatID:          chatID,
+			Video:           &models.InputFileString{Data: *broadcast.FileID},
+			Caption:         broadcast.Text,
+			CaptionEntities: entities,
+			ReplyMarkup:     markup,
+		})
+	default:
+		_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:      chatID,
+			Text:        broadcast.Text,
+			Entities:    entities,
+			ReplyMarkup: markup,
+		})
+	}
+	return err
+}
@@ -0,0 +1,239 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/metrics"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/translation"
+	"remnawave-tg-shop-bot/utils"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrNotMember      = errors.New("not a member of the channel")
+	ErrBonusClaimed   = errors.New("channel bonus already claimed")
+	ErrNoSubscription = errors.New("customer has no subscription")
+)
+
+// Service checks membership of the CHANNEL_ID channel and manages the bonus days for staying in it.
+type Service struct {
+	customerRepository *database.CustomerRepository
+	eventRepository    *database.SubscriptionEventRepository
+	panels             *remnawave.Panels
+	telegramBot        *bot.Bot
+	translation        *translation.Manager
+}
+
+func NewService(customerRepository *database.CustomerRepository, eventRepository *database.SubscriptionEventRepository, panels *remnawave.Panels, telegramBot *bot.Bot, translation *translation.Manager) *Service {
+	return &Service{
+		customerRepository: customerRepository,
+		eventRepository:    eventRepository,
+		panels:             panels,
+		telegramBot:        telegramBot,
+		translation:        translation,
+	}
+}
+
+// IsMember asks Telegram whether the user is in the channel. The bot has to be an administrator of the channel.
+func (s *Service) IsMember(ctx context.Context, telegramID int64) (bool, error) {
+	member, err := s.telegramBot.GetChatMember(ctx, &bot.GetChatMemberParams{ChatID: chatID(config.ChannelID()), UserID: telegramID})
+	if err != nil {
+		return false, fmt.Errorf("failed to get channel member: %w", err)
+	}
+	return isMember(member), nil
+}
+
+// GrantBonus adds ChannelBonusDays to the subscription of a customer who is in the channel. The bonus is given once
+// until it is taken back by VerifyBonuses, and only to customers who already have a subscription, so that it does
+// not become a second trial.
+func (s *Service) GrantBonus(ctx context.Context, customer *database.Customer) error {
+	days := config.ChannelBonusDays()
+	if customer.IsBanned {
+		return database.ErrCustomerBanned
+	}
+	if customer.SubscriptionLink == nil || customer.ExpireAt == nil {
+		return ErrNoSubscription
+	}
+	member, err := s.IsMember(ctx, customer.TelegramID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return ErrNotMember
+	}
+
+	claimed, err := s.customerRepository.ClaimChannelBonus(ctx, customer.ID, days)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrBonusClaimed
+	}
+
+	panel := s.panels.Get(customer.Panel)
+	trafficLimit := config.TrafficLimit()
+	panelUser, err := panel.FindUser(ctx, customer.TelegramID, customer.PanelUUID)
+	if err == nil && panelUser != nil {
+		if limit, ok := panelUser.TrafficLimitBytes.Get(); ok {
+			trafficLimit = limit
+		}
+	}
+	user, err := panel.CreateOrUpdateUser(ctx, customer.ID, customer.TelegramID, customer.PanelUUID, trafficLimit, days)
+	if err != nil {
+		if releaseErr := s.customerRepository.ReleaseChannelBonus(ctx, customer.ID); releaseErr != nil {
+			slog.Error("Error releasing channel bonus", "error", releaseErr)
+		}
+		return err
+	}
+
+	err = s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
+		"subscription_link": user.GetSubscriptionUrl(),
+		"expire_at":         user.GetExpireAt(),
+		"panel_uuid":        user.UUID,
+		"panel_short_uuid":  user.ShortUuid,
+		"is_trial":          false,
+	})
+	if err != nil {
+		return err
+	}
+
+	limit := int64(trafficLimit)
+	s.eventRepository.Record(ctx, database.SubscriptionEvent{
+		CustomerID:       customer.ID,
+		TelegramID:       customer.TelegramID,
+		Source:           database.SubscriptionEventChannelBonus,
+		Actor:            database.ActorCustomer(customer.TelegramID),
+		PreviousExpireAt: customer.ExpireAt,
+		NewExpireAt:      &user.ExpireAt,
+		TrafficLimit:     &limit,
+	})
+
+	slog.Info("Channel bonus granted", "customer_id", utils.MaskHalfInt64(customer.ID), "days", days)
+	return nil
+}
+
+// VerifyBonuses checks every customer holding a channel bonus and takes the bonus days back from those who left
+// the channel. The days are only taken from a subscription that is still active. Customers whose membership cannot
+// be checked keep the bonus until the next run.
+func (s *Service) VerifyBonuses(ctx context.Context) error {
+	customers, err := s.customerRepository.FindWithChannelBonus(ctx)
+	if err != nil {
+		return err
+	}
+
+	revoked := 0
+	for i := range customers {
+		customer := &customers[i]
+		member, err := s.IsMember(ctx, customer.TelegramID)
+		if err != nil {
+			slog.Warn("Error checking channel membership", "customer_id", utils.MaskHalfInt64(customer.ID), "error", err)
+			continue
+		}
+		if member {
+			continue
+		}
+		if err := s.revokeBonus(ctx, customer); err != nil {
+			slog.Error("Error revoking channel bonus", "customer_id", utils.MaskHalfInt64(customer.ID), "error", err)
+			continue
+		}
+		revoked++
+	}
+
+	slog.Info(fmt.Sprintf("Verified %d channel bonuses, revoked %d", len(customers), revoked))
+	return nil
+}
+
+func (s *Service) revokeBonus(ctx context.Context, customer *database.Customer) error {
+	days := 0
+	if customer.ChannelBonusDays != nil {
+		days = *customer.ChannelBonusDays
+	}
+
+	if days > 0 && customer.ExpireAt != nil && customer.ExpireAt.After(time.Now()) {
+		expireAt, trafficLimit, err := takeBackDays(ctx, s.panels.Get(customer.Panel), customer, days)
+		if err != nil {
+			return err
+		}
+		if err := s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{"expire_at": expireAt}); err != nil {
+			return err
+		}
+		limit := int64(trafficLimit)
+		s.eventRepository.Record(ctx, database.SubscriptionEvent{
+			CustomerID:       customer.ID,
+			TelegramID:       customer.TelegramID,
+			Source:           database.SubscriptionEventChannelBonus,
+			Actor:            database.ActorSystem,
+			PreviousExpireAt: customer.ExpireAt,
+			NewExpireAt:      &expireAt,
+			TrafficLimit:     &limit,
+		})
+	}
+
+	if err := s.customerRepository.ReleaseChannelBonus(ctx, customer.ID); err != nil {
+		return err
+	}
+
+	_, err := s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		Text:      fmt.Sprintf(s.translation.GetText(customer.Language, "channel_bonus_revoked"), days),
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: s.translation.GetText(customer.Language, "channel_button"), URL: config.ChannelURL()}},
+		}},
+	})
+	metrics.NotificationSent("channel_bonus_revoked", err)
+	if err != nil {
+		slog.Warn("Error sending channel bonus message", "customer_id", utils.MaskHalfInt64(customer.ID), "error", err)
+	}
+
+	slog.Info("Channel bonus revoked", "customer_id", utils.MaskHalfInt64(customer.ID), "days", days)
+	return nil
+}
+
+// takeBackDays moves the expiration date of the panel user back by the bonus days, but not into the past, and keeps
+// its traffic limit. The days the customer paid for stay untouched.
+func takeBackDays(ctx context.Context, panel remnawave.Panel, customer *database.Customer, days int) (time.Time, int, error) {
+	panelUser, err := panel.FindUser(ctx, customer.TelegramID, customer.PanelUUID)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	if panelUser == nil {
+		return time.Time{}, 0, errors.New("user in remnawave not found")
+	}
+	trafficLimit := config.TrafficLimit()
+	if limit, ok := panelUser.TrafficLimitBytes.Get(); ok {
+		trafficLimit = limit
+	}
+	user, err := panel.SetExpire(ctx, customer.TelegramID, customer.PanelUUID, trafficLimit, remnawave.DecreasedExpire(panelUser.ExpireAt, days))
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return user.ExpireAt, trafficLimit, nil
+}
+
+// chatID turns a numeric CHANNEL_ID like -1001234567890 into a number and keeps an @username as it is.
+func chatID(id string) any {
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+		return n
+	}
+	return id
+}
+
+func isMember(member *models.ChatMember) bool {
+	switch member.Type {
+	case models.ChatMemberTypeOwner, models.ChatMemberTypeAdministrator, models.ChatMemberTypeMember:
+		return true
+	case models.ChatMemberTypeRestricted:
+		return member.Restricted != nil && member.Restricted.IsMember
+	default:
+		return false
+	}
+}
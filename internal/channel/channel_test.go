@@ -0,0 +1,71 @@
+package channel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+)
+
+func TestIsMember(t *testing.T) {
+	tests := []struct {
+		name   string
+		member models.ChatMember
+		want   bool
+	}{
+		{"member", models.ChatMember{Type: models.ChatMemberTypeMember}, true},
+		{"owner", models.ChatMember{Type: models.ChatMemberTypeOwner}, true},
+		{"restricted member", models.ChatMember{Type: models.ChatMemberTypeRestricted, Restricted: &models.ChatMemberRestricted{IsMember: true}}, true},
+		{"restricted non-member", models.ChatMember{Type: models.ChatMemberTypeRestricted, Restricted: &models.ChatMemberRestricted{}}, false},
+		{"left", models.ChatMember{Type: models.ChatMemberTypeLeft}, false},
+		{"banned", models.ChatMember{Type: models.ChatMemberTypeBanned}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isMember(&tt.member); got != tt.want {
+				t.Errorf("isMember = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatID(t *testing.T) {
+	if id, ok := chatID("-1001234567890").(int64); !ok || id != -1001234567890 {
+		t.Errorf("numeric id = %v", chatID("-1001234567890"))
+	}
+	if id := chatID("@news"); id != "@news" {
+		t.Errorf("username = %v", id)
+	}
+}
+
+func TestTakeBackDays(t *testing.T) {
+	ctx := context.Background()
+	panel := remnawave.NewFakePanel()
+	paid := time.Now().UTC().AddDate(0, 0, 60)
+	user := panel.AddUser(remapi.UserDto{TelegramId: remapi.NewNilInt(5), ExpireAt: paid.AddDate(0, 0, 3), TrafficLimitBytes: remapi.NewOptInt(1024)})
+	customer := &database.Customer{ID: 1, TelegramID: 5, PanelUUID: &user.UUID}
+
+	expireAt, trafficLimit, err := takeBackDays(ctx, panel, customer, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expireAt.Equal(paid) || !panel.User(user.UUID).ExpireAt.Equal(paid) {
+		t.Errorf("expire = %v, want the paid %v", expireAt, paid)
+	}
+	if trafficLimit != 1024 {
+		t.Errorf("traffic limit = %d, want 1024", trafficLimit)
+	}
+
+	expireAt, _, err = takeBackDays(ctx, panel, customer, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := time.Since(expireAt); diff < 0 || diff > time.Minute {
+		t.Errorf("expire = %v, want now", expireAt)
+	}
+}
@@ -6,15 +6,17 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type config struct {
 	telegramToken                                             string
 	price1, price3, price6, price12                           int
 	starsPrice1, starsPrice3, starsPrice6, starsPrice12       int
-	remnawaveUrl, remnawaveToken, remnawaveMode, remnawaveTag string
+	remnawavePanels                                           []RemnawavePanel
 	databaseURL                                               string
 	cryptoPayURL, cryptoPayToken                              string
 	botURL                                                    string
@@ -23,32 +25,93 @@ type config struct {
 	feedbackURL                                               string
 	channelURL                                                string
 	serverStatusURL                                           string
+	serverStatusEnabled                                       bool
 	supportURL                                                string
 	tosURL                                                    string
 	isYookasaEnabled                                          bool
 	isCryptoEnabled                                           bool
 	isTelegramStarsEnabled                                    bool
 	adminTelegramId                                           int64
+	admins                                                    map[int64]string
+	adminLogChatId                                            int64
+	adminLogTopics                                            map[string]int
+	adminAPIToken                                             string
 	trialDays                                                 int
-	squadUUIDs                                                map[uuid.UUID]uuid.UUID
 	referralDays                                              int
+	referralMilestones                                        []ReferralMilestone
 	miniApp                                                   string
 	enableAutoPayment                                         bool
 	healthCheckPort                                           int
 	tributeWebhookUrl, tributeAPIKey, tributePaymentUrl       string
 	isWebAppLinkEnabled                                       bool
-	xApiKey                                                   string
 	daysInMonth                                               int
+	broadcastRate                                             int
+	syncCron                                                  string
+	syncDryRun                                                bool
+	syncMissingUsers                                          string
+	remnawaveWebhookURL, remnawaveWebhookSecret               string
+	linkResetCooldown                                         int
+	expirationNotifyOffsets                                   []time.Duration
+	expirationNotifyCron                                      string
+	winbackSteps                                              []WinbackStep
+	trialOfferDiscount, trialOfferDays                        int
+	trialMinAccountAgeDays                                    int
+	trialRequirePhone                                         bool
+	phoneHashSecret                                           string
+	channelID                                                 string
+	trialRequireChannel                                       bool
+	channelBonusDays                                          int
 }
 
 var conf config
 
-func RemnawaveTag() string {
-	return conf.remnawaveTag
+// RemnawavePanel is one Remnawave installation. Customers are provisioned on the panel of the location they chose.
+type RemnawavePanel struct {
+	Name       string
+	Location   string
+	URL        string
+	Token      string
+	Mode       string
+	XApiKey    string
+	Tag        string
+	SquadUUIDs map[uuid.UUID]uuid.UUID
+	// Plans are the subscription lengths in months sold on the panel, empty when it sells every plan.
+	Plans map[int]bool
+}
+
+// SellsPlan tells whether the plan of the given months can be bought for this panel.
+func (p RemnawavePanel) SellsPlan(month int) bool {
+	return len(p.Plans) == 0 || p.Plans[month]
+}
+
+// RemnawavePanels returns the configured panels, the first one is the default for customers without a location.
+func RemnawavePanels() []RemnawavePanel {
+	return conf.remnawavePanels
+}
+
+// RemnawavePanelByName returns the panel with the name, the default panel for an empty or unknown name.
+func RemnawavePanelByName(name string) RemnawavePanel {
+	for _, panel := range conf.remnawavePanels {
+		if panel.Name == name {
+			return panel
+		}
+	}
+	return conf.remnawavePanels[0]
 }
 func GetTributeWebHookUrl() string {
 	return conf.tributeWebhookUrl
 }
+
+// RemnawaveWebhookURL is the path of the panel webhook, the webhook is disabled when it is empty.
+func RemnawaveWebhookURL() string {
+	return conf.remnawaveWebhookURL
+}
+
+// RemnawaveWebhookSecret signs panel webhooks, it is WEBHOOK_SECRET_HEADER of the panel.
+func RemnawaveWebhookSecret() string {
+	return conf.remnawaveWebhookSecret
+}
+
 func GetTributeAPIKey() string {
 	return conf.tributeAPIKey
 }
@@ -61,12 +124,21 @@ func GetReferralDays() int {
 	return conf.referralDays
 }
 
-func GetMiniAppURL() string {
-	return conf.miniApp
+type ReferralMilestone struct {
+	Referrals int
+	Days      int
+}
+
+func ReferralMilestones() []ReferralMilestone {
+	return conf.referralMilestones
+}
+
+func BroadcastRate() int {
+	return conf.broadcastRate
 }
 
-func SquadUUIDs() map[uuid.UUID]uuid.UUID {
-	return conf.squadUUIDs
+func GetMiniAppURL() string {
+	return conf.miniApp
 }
 
 func TrialTrafficLimit() int {
@@ -84,10 +156,33 @@ func ChannelURL() string {
 	return conf.channelURL
 }
 
+// ChannelID is the chat id or @username of the channel checked with getChatMember, empty when no check is set up.
+// The bot has to be an administrator of the channel.
+func ChannelID() string {
+	return conf.channelID
+}
+
+// TrialRequireChannel tells whether the customer has to join the channel before taking the trial.
+func TrialRequireChannel() bool {
+	return conf.trialRequireChannel
+}
+
+// ChannelBonusDays are the days given to customers who join the channel, taken back when they leave. Zero disables
+// the bonus.
+func ChannelBonusDays() int {
+	return conf.channelBonusDays
+}
+
 func ServerStatusURL() string {
 	return conf.serverStatusURL
 }
 
+// ServerStatusEnabled shows the built-in server status screen built from the panel nodes instead of the
+// SERVER_STATUS_URL link.
+func ServerStatusEnabled() bool {
+	return conf.serverStatusEnabled
+}
+
 func SupportURL() string {
 	return conf.supportURL
 }
@@ -152,18 +247,9 @@ func StarsPrice(month int) int {
 func TelegramToken() string {
 	return conf.telegramToken
 }
-func RemnawaveUrl() string {
-	return conf.remnawaveUrl
-}
 func DadaBaseUrl() string {
 	return conf.databaseURL
 }
-func RemnawaveToken() string {
-	return conf.remnawaveToken
-}
-func RemnawaveMode() string {
-	return conf.remnawaveMode
-}
 func CryptoPayUrl() string {
 	return conf.cryptoPayURL
 }
@@ -205,6 +291,97 @@ func GetAdminTelegramId() int64 {
 	return conf.adminTelegramId
 }
 
+// Admins returns additional admins from ADMINS mapped to their role. The owner from ADMIN_TELEGRAM_ID is not included.
+func Admins() map[int64]string {
+	return conf.admins
+}
+
+// AdminLogChatId is the chat receiving the admin event feed, 0 when the feed is disabled.
+func AdminLogChatId() int64 {
+	return conf.adminLogChatId
+}
+
+// AdminLogTopic returns the forum topic for the event type, 0 means the general chat.
+func AdminLogTopic(event string) int {
+	return conf.adminLogTopics[event]
+}
+
+// AdminAPIToken protects the admin REST API, the API is disabled when it is empty.
+func AdminAPIToken() string {
+	return conf.adminAPIToken
+}
+
+// SyncCron is the schedule of the panel synchronization, empty when sync only runs on demand.
+func SyncCron() string {
+	return conf.syncCron
+}
+
+// SyncDryRun makes the scheduled sync send the diff to the owner for approval instead of applying it.
+func SyncDryRun() bool {
+	return conf.syncDryRun
+}
+
+// SyncMissingUsers is what sync does with customers that are gone from the panel: archive, delete or keep.
+func SyncMissingUsers() string {
+	return conf.syncMissingUsers
+}
+
+// LinkResetCooldown is the minimum time between two self-service subscription link resets of a customer.
+func LinkResetCooldown() time.Duration {
+	return time.Duration(conf.linkResetCooldown) * time.Hour
+}
+
+// ExpirationNotifyOffsets are the times before expiration at which the customer is reminded, longest first. Zero
+// means the reminder sent when the subscription has expired.
+func ExpirationNotifyOffsets() []time.Duration {
+	return conf.expirationNotifyOffsets
+}
+
+// ExpirationNotifyCron is the schedule of the expiration reminder job. It has to run at least as often as the
+// shortest gap between the offsets.
+func ExpirationNotifyCron() string {
+	return conf.expirationNotifyCron
+}
+
+// WinbackStep is a message of the win-back sequence, sent Days after the subscription expired. With a discount the
+// customer gets DiscountPercent off purchases for DiscountDays after the message.
+type WinbackStep struct {
+	Days            int
+	DiscountPercent int
+	DiscountDays    int
+}
+
+// WinbackSteps returns the win-back sequence in order, empty when win-back is disabled.
+func WinbackSteps() []WinbackStep {
+	return conf.winbackSteps
+}
+
+// TrialOfferDiscount is the first-purchase discount in percent offered the day before the trial ends, 0 for none.
+func TrialOfferDiscount() int {
+	return conf.trialOfferDiscount
+}
+
+// TrialOfferDays is how many days the trial offer discount stays valid.
+func TrialOfferDays() int {
+	return conf.trialOfferDays
+}
+
+// TrialMinAccountAge is how old a Telegram account has to be, judging by its id, to take the trial. Zero disables
+// the check.
+func TrialMinAccountAge() time.Duration {
+	return time.Duration(conf.trialMinAccountAgeDays) * 24 * time.Hour
+}
+
+// TrialRequirePhone tells whether the customer has to share their phone number before taking the trial.
+func TrialRequirePhone() bool {
+	return conf.trialRequirePhone
+}
+
+// PhoneHashSecret is the HMAC key of the stored phone number hashes, required with TRIAL_REQUIRE_PHONE.
+func PhoneHashSecret() string {
+	return conf.phoneHashSecret
+}
+
 func GetHealthCheckPort() int {
 	return conf.healthCheckPort
 }
@@ -213,10 +390,6 @@ func IsWepAppLinkEnabled() bool {
 	return conf.isWebAppLinkEnabled
 }
 
-func GetXApiKey() string {
-	return conf.xApiKey
-}
-
 const bytesInGigabyte = 1073741824
 
 func mustEnv(key string) string {
@@ -248,6 +421,66 @@ func envIntDefault(key string, def int) int {
 	return i
 }
 
+// parseNotifyOffsets parses offsets like "7d,3d,1d,2h,30m,0" and returns them sorted longest first.
+func parseNotifyOffsets(v string) []time.Duration {
+	var offsets []time.Duration
+	seen := make(map[time.Duration]bool)
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var offset time.Duration
+		if item != "0" {
+			unit := map[byte]time.Duration{'d': 24 * time.Hour, 'h': time.Hour, 'm': time.Minute}[item[len(item)-1]]
+			n, err := strconv.Atoi(item[:len(item)-1])
+			if unit == 0 || err != nil || n <= 0 {
+				log.Panicf("invalid offset %q in EXPIRATION_NOTIFY_OFFSETS, use e.g. 7d, 2h, 30m or 0", item)
+			}
+			offset = time.Duration(n) * unit
+		}
+		if !seen[offset] {
+			seen[offset] = true
+			offsets = append(offsets, offset)
+		}
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] > offsets[j] })
+	return offsets
+}
+
+// parseWinbackSteps parses steps like "3,7:20:3,30:40:7", each "days[:discountPercent[:discountDays]]". The
+// discount is valid for 3 days when discountDays is omitted.
+func parseWinbackSteps(v string) []WinbackStep {
+	var steps []WinbackStep
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		values := []int{0, 0, 3}
+		if len(parts) > len(values) {
+			log.Panicf("invalid step %q in WINBACK_STEPS, use days[:discountPercent[:discountDays]]", item)
+		}
+		for i, part := range parts {
+			n, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || n < 0 {
+				log.Panicf("invalid step %q in WINBACK_STEPS, use days[:discountPercent[:discountDays]]", item)
+			}
+			values[i] = n
+		}
+		step := WinbackStep{Days: values[0], DiscountPercent: values[1], DiscountDays: values[2]}
+		if step.Days <= 0 || step.DiscountPercent > 99 || (step.DiscountPercent > 0 && step.DiscountDays == 0) {
+			log.Panicf("invalid step %q in WINBACK_STEPS", item)
+		}
+		if len(steps) > 0 && step.Days <= steps[len(steps)-1].Days {
+			log.Panicf("WINBACK_STEPS must be ordered by days, got %q", v)
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
 func envStringDefault(key string, def string) string {
 	v := os.Getenv(key)
 	if v == "" {
@@ -260,6 +493,158 @@ func envBool(key string) bool {
 	return os.Getenv(key) == "true"
 }
 
+// parseRemnawavePanels reads REMNAWAVE_<NAME>_URL, _TOKEN, _MODE, _X_API_KEY, _TAG, _SQUAD_UUIDS, _LOCATION and
+// _PLANS for every name in REMNAWAVE_PANELS. Without REMNAWAVE_PANELS there is a single "default" panel configured by
+// REMNAWAVE_URL, REMNAWAVE_TOKEN, REMNAWAVE_MODE, X_API_KEY, REMNAWAVE_TAG and SQUAD_UUIDS.
+func parseRemnawavePanels(v string) []RemnawavePanel {
+	if v == "" {
+		return []RemnawavePanel{loadRemnawavePanel("default", func(key string) string {
+			switch key {
+			case "X_API_KEY", "SQUAD_UUIDS":
+				return key
+			}
+			return "REMNAWAVE_" + key
+		})}
+	}
+
+	var panels []RemnawavePanel
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(v, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || strings.Trim(name, "abcdefghijklmnopqrstuvwxyz0123456789_") != "" {
+			log.Panicf("invalid panel name %q in REMNAWAVE_PANELS", name)
+		}
+		if seen[name] {
+			log.Panicf("duplicate panel name %q in REMNAWAVE_PANELS", name)
+		}
+		seen[name] = true
+		prefix := "REMNAWAVE_" + strings.ToUpper(name) + "_"
+		panels = append(panels, loadRemnawavePanel(name, func(key string) string {
+			return prefix + key
+		}))
+	}
+	return panels
+}
+
+func loadRemnawavePanel(name string, env func(key string) string) RemnawavePanel {
+	panel := RemnawavePanel{
+		Name:       name,
+		Location:   envStringDefault(env("LOCATION"), name),
+		URL:        mustEnv(env("URL")),
+		Token:      mustEnv(env("TOKEN")),
+		Mode:       envStringDefault(env("MODE"), "remote"),
+		XApiKey:    os.Getenv(env("X_API_KEY")),
+		Tag:        os.Getenv(env("TAG")),
+		SquadUUIDs: make(map[uuid.UUID]uuid.UUID),
+		Plans:      parsePanelPlans(env("PLANS"), os.Getenv(env("PLANS"))),
+	}
+	if panel.Mode != "remote" && panel.Mode != "local" {
+		log.Panicf("%s .env variable must be either 'remote' or 'local'", env("MODE"))
+	}
+
+	if v := os.Getenv(env("SQUAD_UUIDS")); v != "" {
+		uuids := strings.Split(v, ",")
+		for _, value := range uuids {
+			squad, err := uuid.Parse(strings.TrimSpace(value))
+			if err != nil {
+				panic(err)
+			}
+			panel.SquadUUIDs[squad] = squad
+		}
+		slog.Info("Loaded squad UUIDs", "panel", name, "uuids", uuids)
+	} else {
+		slog.Info("No squad UUIDs specified, all will be used", "panel", name)
+	}
+	return panel
+}
+
+// parsePanelPlans reads the comma-separated plans, in months, a panel sells, e.g. "1,3".
+func parsePanelPlans(key, v string) map[int]bool {
+	if v == "" {
+		return nil
+	}
+	plans := make(map[int]bool)
+	for _, value := range strings.Split(v, ",") {
+		month, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || (month != 1 && month != 3 && month != 6 && month != 12) {
+			log.Panicf("invalid plan %q in %s, expected 1, 3, 6 or 12", value, key)
+		}
+		plans[month] = true
+	}
+	return plans
+}
+
+func parseReferralMilestones(v string) []ReferralMilestone {
+	if v == "" {
+		return nil
+	}
+	var milestones []ReferralMilestone
+	for _, pair := range strings.Split(v, ",") {
+		parts := strings.Split(strings.TrimSpace(pair), ":")
+		if len(parts) != 2 {
+			log.Panicf("invalid milestone %q in REFERRAL_MILESTONES, expected referrals:days", pair)
+		}
+		referrals, err := strconv.Atoi(parts[0])
+		if err != nil || referrals <= 0 {
+			log.Panicf("invalid referrals count in REFERRAL_MILESTONES: %q", pair)
+		}
+		days, err := strconv.Atoi(parts[1])
+		if err != nil || days <= 0 {
+			log.Panicf("invalid days in REFERRAL_MILESTONES: %q", pair)
+		}
+		milestones = append(milestones, ReferralMilestone{Referrals: referrals, Days: days})
+	}
+	sort.Slice(milestones, func(i, j int) bool {
+		return milestones[i].Referrals < milestones[j].Referrals
+	})
+	slog.Info("Loaded referral milestones", "milestones", milestones)
+	return milestones
+}
+
+func parseAdmins(v string) map[int64]string {
+	admins := make(map[int64]string)
+	if v == "" {
+		return admins
+	}
+	for _, pair := range strings.Split(v, ",") {
+		parts := strings.Split(strings.TrimSpace(pair), ":")
+		if len(parts) != 2 {
+			log.Panicf("invalid admin %q in ADMINS, expected telegramId:role", pair)
+		}
+		telegramId, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			log.Panicf("invalid telegram id in ADMINS: %q", pair)
+		}
+		switch parts[1] {
+		case "owner", "support", "finance":
+		default:
+			log.Panicf("invalid role in ADMINS: %q, expected owner, support or finance", pair)
+		}
+		admins[telegramId] = parts[1]
+	}
+	slog.Info("Loaded admins", "count", len(admins))
+	return admins
+}
+
+func parseAdminLogTopics(v string) map[string]int {
+	topics := make(map[string]int)
+	if v == "" {
+		return topics
+	}
+	for _, pair := range strings.Split(v, ",") {
+		parts := strings.Split(strings.TrimSpace(pair), ":")
+		if len(parts) != 2 {
+			log.Panicf("invalid topic %q in ADMIN_LOG_TOPICS, expected event:topicId", pair)
+		}
+		topicId, err := strconv.Atoi(parts[1])
+		if err != nil || topicId < 0 {
+			log.Panicf("invalid topic id in ADMIN_LOG_TOPICS: %q", pair)
+		}
+		topics[parts[0]] = topicId
+	}
+	return topics
+}
+
 func InitConfig() {
 	if os.Getenv("DISABLE_ENV_FILE") != "true" {
 		if err := godotenv.Load(".env"); err != nil {
@@ -272,9 +657,18 @@ func InitConfig() {
 		panic("ADMIN_TELEGRAM_ID .env variable not set")
 	}
 
-	conf.telegramToken = mustEnv("TELEGRAM_TOKEN")
+	conf.admins = parseAdmins(os.Getenv("ADMINS"))
 
-	conf.xApiKey = os.Getenv("X_API_KEY")
+	if v := os.Getenv("ADMIN_LOG_CHAT_ID"); v != "" {
+		conf.adminLogChatId, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			panic("ADMIN_LOG_CHAT_ID .env variable must be a chat id")
+		}
+	}
+	conf.adminLogTopics = parseAdminLogTopics(os.Getenv("ADMIN_LOG_TOPICS"))
+	conf.adminAPIToken = os.Getenv("ADMIN_API_TOKEN")
+
+	conf.telegramToken = mustEnv("TELEGRAM_TOKEN")
 
 	conf.isWebAppLinkEnabled = func() bool {
 		isWebAppLinkEnabled := os.Getenv("IS_WEB_APP_LINK") == "true"
@@ -283,8 +677,6 @@ func InitConfig() {
 
 	conf.miniApp = envStringDefault("MINI_APP_URL", "")
 
-	conf.remnawaveTag = envStringDefault("REMNAWAVE_TAG", "")
-
 	conf.daysInMonth = envIntDefault("DAYS_IN_MONTH", 30)
 
 	conf.trialTrafficLimit = mustEnvInt("TRIAL_TRAFFIC_LIMIT")
@@ -309,22 +701,7 @@ func InitConfig() {
 
 	}
 
-	conf.remnawaveUrl = mustEnv("REMNAWAVE_URL")
-
-	conf.remnawaveMode = func() string {
-		v := os.Getenv("REMNAWAVE_MODE")
-		if v != "" {
-			if v != "remote" && v != "local" {
-				panic("REMNAWAVE_MODE .env variable must be either 'remote' or 'local'")
-			} else {
-				return v
-			}
-		} else {
-			return "remote"
-		}
-	}()
-
-	conf.remnawaveToken = mustEnv("REMNAWAVE_TOKEN")
+	conf.remnawavePanels = parseRemnawavePanels(os.Getenv("REMNAWAVE_PANELS"))
 
 	conf.databaseURL = mustEnv("DATABASE_URL")
 
@@ -344,33 +721,79 @@ func InitConfig() {
 
 	conf.trafficLimit = mustEnvInt("TRAFFIC_LIMIT")
 	conf.referralDays = mustEnvInt("REFERRAL_DAYS")
+	conf.referralMilestones = parseReferralMilestones(os.Getenv("REFERRAL_MILESTONES"))
+
+	conf.broadcastRate = envIntDefault("BROADCAST_RATE", 25)
+	if conf.broadcastRate <= 0 {
+		panic("BROADCAST_RATE .env variable must be positive")
+	}
+
+	conf.remnawaveWebhookURL = os.Getenv("REMNAWAVE_WEBHOOK_URL")
+	conf.remnawaveWebhookSecret = os.Getenv("REMNAWAVE_WEBHOOK_SECRET")
+	if conf.remnawaveWebhookURL != "" && conf.remnawaveWebhookSecret == "" {
+		panic("REMNAWAVE_WEBHOOK_SECRET .env variable must be set when REMNAWAVE_WEBHOOK_URL is set")
+	}
+
+	conf.linkResetCooldown = envIntDefault("LINK_RESET_COOLDOWN_HOURS", 24)
+	if conf.linkResetCooldown < 0 {
+		panic("LINK_RESET_COOLDOWN_HOURS .env variable must not be negative")
+	}
+
+	conf.expirationNotifyOffsets = parseNotifyOffsets(envStringDefault("EXPIRATION_NOTIFY_OFFSETS", "3d,2d,1d"))
+	conf.expirationNotifyCron = envStringDefault("EXPIRATION_NOTIFY_CRON", "*/10 * * * *")
+
+	conf.winbackSteps = parseWinbackSteps(os.Getenv("WINBACK_STEPS"))
+
+	conf.trialOfferDiscount = envIntDefault("TRIAL_OFFER_DISCOUNT", 0)
+	if conf.trialOfferDiscount < 0 || conf.trialOfferDiscount >= 100 {
+		panic("TRIAL_OFFER_DISCOUNT .env variable must be between 0 and 99")
+	}
+	conf.trialOfferDays = envIntDefault("TRIAL_OFFER_DAYS", 3)
+	if conf.trialOfferDays <= 0 {
+		panic("TRIAL_OFFER_DAYS .env variable must be positive")
+	}
+	conf.trialMinAccountAgeDays = envIntDefault("TRIAL_MIN_ACCOUNT_AGE_DAYS", 0)
+	if conf.trialMinAccountAgeDays < 0 {
+		panic("TRIAL_MIN_ACCOUNT_AGE_DAYS .env variable must not be negative")
+	}
+	conf.trialRequirePhone = envBool("TRIAL_REQUIRE_PHONE")
+	if conf.trialRequirePhone {
+		conf.phoneHashSecret = mustEnv("PHONE_HASH_SECRET")
+	}
+
+	conf.syncCron = os.Getenv("SYNC_CRON")
+	conf.syncDryRun = os.Getenv("SYNC_DRY_RUN") == "true"
+	conf.syncMissingUsers = os.Getenv("SYNC_MISSING_USERS")
+	switch conf.syncMissingUsers {
+	case "":
+		conf.syncMissingUsers = "archive"
+	case "archive", "delete", "keep":
+	default:
+		panic("SYNC_MISSING_USERS .env variable must be archive, delete or keep")
+	}
 
 	conf.serverStatusURL = os.Getenv("SERVER_STATUS_URL")
+	conf.serverStatusEnabled = envBool("SERVER_STATUS_ENABLED")
 	conf.supportURL = os.Getenv("SUPPORT_URL")
 	conf.feedbackURL = os.Getenv("FEEDBACK_URL")
 	conf.channelURL = os.Getenv("CHANNEL_URL")
+	conf.channelID = os.Getenv("CHANNEL_ID")
+	if conf.channelURL == "" && strings.HasPrefix(conf.channelID, "@") {
+		conf.channelURL = "https://t.me/" + strings.TrimPrefix(conf.channelID, "@")
+	}
+	conf.trialRequireChannel = envBool("TRIAL_REQUIRE_CHANNEL")
+	conf.channelBonusDays = envIntDefault("CHANNEL_BONUS_DAYS", 0)
+	if conf.channelBonusDays < 0 {
+		panic("CHANNEL_BONUS_DAYS .env variable must not be negative")
+	}
+	if (conf.trialRequireChannel || conf.channelBonusDays > 0) && conf.channelID == "" {
+		panic("CHANNEL_ID .env variable must be set when TRIAL_REQUIRE_CHANNEL or CHANNEL_BONUS_DAYS is set")
+	}
+	if (conf.trialRequireChannel || conf.channelBonusDays > 0) && conf.channelURL == "" {
+		panic("CHANNEL_URL .env variable must be set for a channel id that is not an @username")
+	}
 	conf.tosURL = os.Getenv("TOS_URL")
 
-	conf.squadUUIDs = func() map[uuid.UUID]uuid.UUID {
-		v := os.Getenv("SQUAD_UUIDS")
-		if v != "" {
-			uuids := strings.Split(v, ",")
-			var inboundsMap = make(map[uuid.UUID]uuid.UUID)
-			for _, value := range uuids {
-				uuid, err := uuid.Parse(value)
-				if err != nil {
-					panic(err)
-				}
-				inboundsMap[uuid] = uuid
-			}
-			slog.Info("Loaded squad UUIDs", "uuids", uuids)
-			return inboundsMap
-		} else {
-			slog.Info("No squad UUIDs specified, all will be used")
-			return map[uuid.UUID]uuid.UUID{}
-		}
-	}()
-
 	conf.tributeWebhookUrl = os.Getenv("TRIBUTE_WEBHOOK_URL")
 	if conf.tributeWebhookUrl != "" {
 		conf.tributeAPIKey = mustEnv("TRIBUTE_API_KEY")
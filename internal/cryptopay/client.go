@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"remnawave-tg-shop-bot/internal/metrics"
+	"time"
 )
 
 type CryptoPayApi interface {
@@ -27,7 +29,9 @@ func NewCryptoPayClient(url string, tokn string) *Client {
 	}
 }
 
-func (c *Client) CreateInvoice(invoiceReq *InvoiceRequest) (*InvoiceResponse, error) {
+func (c *Client) CreateInvoice(invoiceReq *InvoiceRequest) (_ *InvoiceResponse, err error) {
+	defer metrics.ObservePaymentProvider("cryptopay", "create_invoice", time.Now(), &err)
+
 	jsonData, err := json.Marshal(invoiceReq)
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling invoice: %w", err)
@@ -69,7 +73,9 @@ func (c *Client) CreateInvoice(invoiceReq *InvoiceRequest) (*InvoiceResponse, er
 	return &apiResp.Result, nil
 }
 
-func (c *Client) GetInvoices(status, fiat, asset, invoiceIds string, offset, limit int) (*[]InvoiceResponse, error) {
+func (c *Client) GetInvoices(status, fiat, asset, invoiceIds string, offset, limit int) (_ *[]InvoiceResponse, err error) {
+	defer metrics.ObservePaymentProvider("cryptopay", "get_invoices", time.Now(), &err)
+
 	endpoint := fmt.Sprintf("%s/api/getInvoices", c.baseURL)
 	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
 	if err != nil {
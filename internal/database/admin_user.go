@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+type AdminUser struct {
+	TelegramID int64     `db:"telegram_id"`
+	Role       string    `db:"role"`
+	AddedBy    int64     `db:"added_by"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+type AdminUserRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewAdminUserRepository(pool *pgxpool.Pool) *AdminUserRepository {
+	return &AdminUserRepository{pool: pool}
+}
+
+func (r *AdminUserRepository) FindByTelegramId(ctx context.Context, telegramID int64) (*AdminUser, error) {
+	query := sq.Select("telegram_id", "role", "added_by", "created_at").
+		From("admin_user").
+		Where(sq.Eq{"telegram_id": telegramID}).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select admin query: %w", err)
+	}
+
+	var admin AdminUser
+	err = r.pool.QueryRow(ctx, sql, args...).Scan(&admin.TelegramID, &admin.Role, &admin.AddedBy, &admin.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query admin: %w", err)
+	}
+	return &admin, nil
+}
+
+func (r *AdminUserRepository) FindAll(ctx context.Context) ([]AdminUser, error) {
+	query := sq.Select("telegram_id", "role", "added_by", "created_at").
+		From("admin_user").
+		OrderBy("created_at").
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select admins query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query admins: %w", err)
+	}
+	defer rows.Close()
+
+	var admins []AdminUser
+	for rows.Next() {
+		var admin AdminUser
+		if err := rows.Scan(&admin.TelegramID, &admin.Role, &admin.AddedBy, &admin.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan admin row: %w", err)
+		}
+		admins = append(admins, admin)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating admin rows: %w", rows.Err())
+	}
+	return admins, nil
+}
+
+// Save adds the admin or changes the role of an existing one.
+func (r *AdminUserRepository) Save(ctx context.Context, telegramID int64, role string, addedBy int64) error {
+	query := sq.Insert("admin_user").
+		Columns("telegram_id", "role", "added_by").
+		Values(telegramID, role, addedBy).
+		Suffix("ON CONFLICT (telegram_id) DO UPDATE SET role = EXCLUDED.role, added_by = EXCLUDED.added_by").
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build save admin query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to save admin: %w", err)
+	}
+	return nil
+}
+
+func (r *AdminUserRepository) Delete(ctx context.Context, telegramID int64) (bool, error) {
+	result, err := r.pool.Exec(ctx, "DELETE FROM admin_user WHERE telegram_id = $1", telegramID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete admin: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+type BroadcastStatus string
+
+const (
+	BroadcastStatusDraft     BroadcastStatus = "draft"
+	BroadcastStatusRunning   BroadcastStatus = "running"
+	BroadcastStatusCompleted BroadcastStatus = "completed"
+	BroadcastStatusCancelled BroadcastStatus = "cancelled"
+)
+
+type BroadcastContentType string
+
+const (
+	BroadcastContentText  BroadcastContentType = "text"
+	BroadcastContentPhoto BroadcastContentType = "photo"
+	BroadcastContentVideo BroadcastContentType = "video"
+)
+
+type Broadcast struct {
+	ID             int64                `db:"id"`
+	Status         BroadcastStatus      `db:"status"`
+	ContentType    BroadcastContentType `db:"content_type"`
+	Text           string               `db:"text"`
+	Entities       []byte               `db:"entities"`
+	FileID         *string              `db:"file_id"`
+	Buttons        []byte               `db:"buttons"`
+	Segment        CustomerSegment      `db:"segment"`
+	Language       *string              `db:"language"`
+	CreatedBy      int64                `db:"created_by"`
+	CreatedAt      time.Time            `db:"created_at"`
+	StartedAt      *time.Time           `db:"started_at"`
+	FinishedAt     *time.Time           `db:"finished_at"`
+	LastCustomerID int64                `db:"last_customer_id"`
+	Total          int                  `db:"total"`
+	Delivered      int                  `db:"delivered"`
+	Failed         int                  `db:"failed"`
+	Blocked        int                  `db:"blocked"`
+}
+
+type BroadcastRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewBroadcastRepository(pool *pgxpool.Pool) *BroadcastRepository {
+	return &BroadcastRepository{pool: pool}
+}
+
+var broadcastColumns = []string{
+	"id", "status", "content_type", "text", "entities", "file_id", "buttons", "segment", "language", "created_by",
+	"created_at", "started_at", "finished_at", "last_customer_id", "total", "delivered", "failed", "blocked",
+}
+
+func scanBroadcast(row pgx.Row) (*Broadcast, error) {
+	var b Broadcast
+	err := row.Scan(
+		&b.ID, &b.Status, &b.ContentType, &b.Text, &b.Entities, &b.FileID, &b.Buttons, &b.Segment, &b.Language, &b.CreatedBy,
+		&b.CreatedAt, &b.StartedAt, &b.FinishedAt, &b.LastCustomerID, &b.Total, &b.Delivered, &b.Failed, &b.Blocked,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r *BroadcastRepository) Create(ctx context.Context, broadcast *Broadcast) (int64, error) {
+	query := sq.Insert("broadcast").
+		Columns("status", "content_type", "text", "entities", "file_id", "created_by").
+		Values(BroadcastStatusDraft, broadcast.ContentType, broadcast.Text, nullableJSON(broadcast.Entities), broadcast.FileID, broadcast.CreatedBy).
+		Suffix("RETURNING id").
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build insert broadcast query: %w", err)
+	}
+
+	var id int64
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to insert broadcast: %w", err)
+	}
+	return id, nil
+}
+
+func (r *BroadcastRepository) FindById(ctx context.Context, id int64) (*Broadcast, error) {
+	query := sq.Select(broadcastColumns...).
+		From("broadcast").
+		Where(sq.Eq{"id": id}).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select broadcast query: %w", err)
+	}
+
+	broadcast, err := scanBroadcast(r.pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query broadcast: %w", err)
+	}
+	return broadcast, nil
+}
+
+func (r *BroadcastRepository) FindByStatus(ctx context.Context, status BroadcastStatus) ([]Broadcast, error) {
+	query := sq.Select(broadcastColumns...).
+		From("broadcast").
+		Where(sq.Eq{"status": status}).
+		OrderBy("id").
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select broadcasts query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query broadcasts: %w", err)
+	}
+	defer rows.Close()
+
+	var broadcasts []Broadcast
+	for rows.Next() {
+		broadcast, err := scanBroadcast(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan broadcast row: %w", err)
+		}
+		broadcasts = append(broadcasts, *broadcast)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating broadcast rows: %w", rows.Err())
+	}
+	return broadcasts, nil
+}
+
+func (r *BroadcastRepository) UpdateFields(ctx context.Context, id int64, updates map[string]interface{}) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	buildUpdate := sq.Update("broadcast").
+		PlaceholderFormat(sq.Dollar).
+		Where(sq.Eq{"id": id})
+
+	for field, value := range updates {
+		buildUpdate = buildUpdate.Set(field, value)
+	}
+
+	sql, args, err := buildUpdate.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update broadcast query: %w", err)
+	}
+
+	result, err := r.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update broadcast: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("no broadcast found with id: %d", id)
+	}
+	return nil
+}
+
+// SaveProgress stores the last processed customer together with delivery counters, so an interrupted
+// broadcast continues right after this customer.
+func (r *BroadcastRepository) SaveProgress(ctx context.Context, id int64, lastCustomerID int64, delivered, failed, blocked int) error {
+	query := sq.Update("broadcast").
+		Set("last_customer_id", lastCustomerID).
+		Set("delivered", sq.Expr("delivered + ?", delivered)).
+		Set("failed", sq.Expr("failed + ?", failed)).
+		Set("blocked", sq.Expr("blocked + ?", blocked)).
+		Where(sq.Eq{"id": id}).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build broadcast progress query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to save broadcast progress: %w", err)
+	}
+	return nil
+}
+
+func nullableJSON(value []byte) interface{} {
+	if len(value) == 0 {
+		return nil
+	}
+	return string(value)
+}
@@ -5,13 +5,20 @@ import (
 	"errors"
 	"fmt"
 	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"log/slog"
 	"remnawave-tg-shop-bot/utils"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// ErrCustomerBanned is returned when days would be added to the subscription of a banned customer. Adding days
+// would bring the disabled panel user back.
+var ErrCustomerBanned = errors.New("customer is banned")
+
 type CustomerRepository struct {
 	pool *pgxpool.Pool
 }
@@ -27,16 +34,49 @@ type Customer struct {
 	CreatedAt        time.Time  `db:"created_at"`
 	SubscriptionLink *string    `db:"subscription_link"`
 	Language         string     `db:"language"`
+	IsBanned         bool       `db:"is_banned"`
+	BanReason        *string    `db:"ban_reason"`
+	ArchivedAt       *time.Time `db:"archived_at"`
+	PanelUUID        *uuid.UUID `db:"panel_uuid"`
+	PanelShortUUID   *string    `db:"panel_short_uuid"`
+	// Panel is the name of the Remnawave panel holding the user, empty for the default panel.
+	Panel string `db:"panel"`
+	// IsTrial is set while the subscription comes from the free trial and cleared by anything else that adds days.
+	IsTrial bool `db:"is_trial"`
+	// TrialUsedAt is when the customer lost the right to the free trial, see the TrialSource* constants for why. It
+	// survives sync and panel-side deletions, unlike the subscription link.
+	TrialUsedAt *time.Time `db:"trial_used_at"`
+	TrialSource *string    `db:"trial_source"`
+	// PhoneHash is the HMAC-SHA256 of the phone number the customer shared to pass the trial phone check.
+	PhoneHash *string `db:"phone_hash"`
+	// ChannelBonusAt is when the customer got ChannelBonusDays for joining the channel, nil without a bonus.
+	ChannelBonusAt   *time.Time `db:"channel_bonus_at"`
+	ChannelBonusDays *int       `db:"channel_bonus_days"`
+}
+
+// Reasons a customer can no longer take the free trial.
+const (
+	TrialSourceBot      = "bot"
+	TrialSourcePurchase = "purchase"
+	TrialSourcePanel    = "panel"
+	TrialSourceLegacy   = "legacy"
+)
+
+// CanTakeTrial tells whether the customer may take the free trial: it has not been used, and there is no running
+// subscription the trial would replace. Admins give the trial back by clearing trial_used_at, see ResetTrial.
+func (c Customer) CanTakeTrial(now time.Time) bool {
+	return c.TrialUsedAt == nil && (c.ExpireAt == nil || !c.ExpireAt.After(now))
 }
 
 func (cr *CustomerRepository) FindByExpirationRange(ctx context.Context, startDate, endDate time.Time) (*[]Customer, error) {
-	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language").
+	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language", "is_banned", "ban_reason", "archived_at", "panel_uuid", "panel_short_uuid", "panel", "is_trial", "trial_used_at", "trial_source", "phone_hash", "channel_bonus_at", "channel_bonus_days").
 		From("customer").
 		Where(
 			sq.And{
 				sq.NotEq{"expire_at": nil},
 				sq.GtOrEq{"expire_at": startDate},
 				sq.LtOrEq{"expire_at": endDate},
+				sq.Eq{"archived_at": nil},
 			},
 		).
 		PlaceholderFormat(sq.Dollar)
@@ -62,6 +102,18 @@ func (cr *CustomerRepository) FindByExpirationRange(ctx context.Context, startDa
 			&customer.CreatedAt,
 			&customer.SubscriptionLink,
 			&customer.Language,
+			&customer.IsBanned,
+			&customer.BanReason,
+			&customer.ArchivedAt,
+			&customer.PanelUUID,
+			&customer.PanelShortUUID,
+			&customer.Panel,
+			&customer.IsTrial,
+			&customer.TrialUsedAt,
+			&customer.TrialSource,
+			&customer.PhoneHash,
+			&customer.ChannelBonusAt,
+			&customer.ChannelBonusDays,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan customer row: %w", err)
@@ -77,7 +129,7 @@ func (cr *CustomerRepository) FindByExpirationRange(ctx context.Context, startDa
 }
 
 func (cr *CustomerRepository) FindById(ctx context.Context, id int64) (*Customer, error) {
-	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language").
+	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language", "is_banned", "ban_reason", "archived_at", "panel_uuid", "panel_short_uuid", "panel", "is_trial", "trial_used_at", "trial_source", "phone_hash", "channel_bonus_at", "channel_bonus_days").
 		From("customer").
 		Where(sq.Eq{"id": id}).
 		PlaceholderFormat(sq.Dollar)
@@ -96,6 +148,18 @@ func (cr *CustomerRepository) FindById(ctx context.Context, id int64) (*Customer
 		&customer.CreatedAt,
 		&customer.SubscriptionLink,
 		&customer.Language,
+		&customer.IsBanned,
+		&customer.BanReason,
+		&customer.ArchivedAt,
+		&customer.PanelUUID,
+		&customer.PanelShortUUID,
+		&customer.Panel,
+		&customer.IsTrial,
+		&customer.TrialUsedAt,
+		&customer.TrialSource,
+		&customer.PhoneHash,
+		&customer.ChannelBonusAt,
+		&customer.ChannelBonusDays,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -107,7 +171,7 @@ func (cr *CustomerRepository) FindById(ctx context.Context, id int64) (*Customer
 }
 
 func (cr *CustomerRepository) FindByTelegramId(ctx context.Context, telegramId int64) (*Customer, error) {
-	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language").
+	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language", "is_banned", "ban_reason", "archived_at", "panel_uuid", "panel_short_uuid", "panel", "is_trial", "trial_used_at", "trial_source", "phone_hash", "channel_bonus_at", "channel_bonus_days").
 		From("customer").
 		Where(sq.Eq{"telegram_id": telegramId}).
 		PlaceholderFormat(sq.Dollar)
@@ -126,6 +190,18 @@ func (cr *CustomerRepository) FindByTelegramId(ctx context.Context, telegramId i
 		&customer.CreatedAt,
 		&customer.SubscriptionLink,
 		&customer.Language,
+		&customer.IsBanned,
+		&customer.BanReason,
+		&customer.ArchivedAt,
+		&customer.PanelUUID,
+		&customer.PanelShortUUID,
+		&customer.Panel,
+		&customer.IsTrial,
+		&customer.TrialUsedAt,
+		&customer.TrialSource,
+		&customer.PhoneHash,
+		&customer.ChannelBonusAt,
+		&customer.ChannelBonusDays,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -136,6 +212,51 @@ func (cr *CustomerRepository) FindByTelegramId(ctx context.Context, telegramId i
 	return &customer, nil
 }
 
+// FindByUsername looks the customer up by telegram username, case-insensitive and without the leading "@".
+func (cr *CustomerRepository) FindByUsername(ctx context.Context, username string) (*Customer, error) {
+	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language", "is_banned", "ban_reason", "archived_at", "panel_uuid", "panel_short_uuid", "panel", "is_trial", "trial_used_at", "trial_source", "phone_hash", "channel_bonus_at", "channel_bonus_days").
+		From("customer").
+		Where(sq.Expr("LOWER(username) = LOWER(?)", strings.TrimPrefix(username, "@"))).
+		OrderBy("id DESC").
+		Limit(1).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := buildSelect.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	var customer Customer
+
+	err = cr.pool.QueryRow(ctx, sql, args...).Scan(
+		&customer.ID,
+		&customer.TelegramID,
+		&customer.ExpireAt,
+		&customer.CreatedAt,
+		&customer.SubscriptionLink,
+		&customer.Language,
+		&customer.IsBanned,
+		&customer.BanReason,
+		&customer.ArchivedAt,
+		&customer.PanelUUID,
+		&customer.PanelShortUUID,
+		&customer.Panel,
+		&customer.IsTrial,
+		&customer.TrialUsedAt,
+		&customer.TrialSource,
+		&customer.PhoneHash,
+		&customer.ChannelBonusAt,
+		&customer.ChannelBonusDays,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query customer by username: %w", err)
+	}
+	return &customer, nil
+}
+
 func (cr *CustomerRepository) Create(ctx context.Context, customer *Customer) (*Customer, error) {
 	buildInsert := sq.Insert("customer").
 		Columns("telegram_id", "expire_at", "language").
@@ -203,7 +324,7 @@ func (cr *CustomerRepository) UpdateFields(ctx context.Context, id int64, update
 }
 
 func (cr *CustomerRepository) FindByTelegramIds(ctx context.Context, telegramIDs []int64) ([]Customer, error) {
-	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language").
+	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language", "is_banned", "ban_reason", "archived_at", "panel_uuid", "panel_short_uuid", "panel", "is_trial", "trial_used_at", "trial_source", "phone_hash", "channel_bonus_at", "channel_bonus_days").
 		From("customer").
 		Where(sq.Eq{"telegram_id": telegramIDs}).
 		PlaceholderFormat(sq.Dollar)
@@ -229,6 +350,18 @@ func (cr *CustomerRepository) FindByTelegramIds(ctx context.Context, telegramIDs
 			&customer.CreatedAt,
 			&customer.SubscriptionLink,
 			&customer.Language,
+			&customer.IsBanned,
+			&customer.BanReason,
+			&customer.ArchivedAt,
+			&customer.PanelUUID,
+			&customer.PanelShortUUID,
+			&customer.Panel,
+			&customer.IsTrial,
+			&customer.TrialUsedAt,
+			&customer.TrialSource,
+			&customer.PhoneHash,
+			&customer.ChannelBonusAt,
+			&customer.ChannelBonusDays,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan customer row: %w", err)
@@ -242,32 +375,35 @@ func (cr *CustomerRepository) FindByTelegramIds(ctx context.Context, telegramIDs
 	return customers, nil
 }
 
+// batchSize is the number of rows written by one statement of CreateBatch and UpdateBatch. It keeps the statements
+// well under the 65535 bind parameters Postgres allows.
+const batchSize = 1000
+
 func (cr *CustomerRepository) CreateBatch(ctx context.Context, customers []Customer) error {
 	if len(customers) == 0 {
 		return nil
 	}
-	builder := sq.Insert("customer").
-		Columns("telegram_id", "expire_at", "language", "subscription_link").
-		PlaceholderFormat(sq.Dollar)
-	for _, cust := range customers {
-		builder = builder.Values(cust.TelegramID, cust.ExpireAt, cust.Language, cust.SubscriptionLink)
-	}
-	sqlStr, args, err := builder.ToSql()
-	if err != nil {
-		return fmt.Errorf("failed to build batch insert query: %w", err)
-	}
 
 	tx, err := cr.pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	_, err = cr.pool.Exec(ctx, sqlStr, args...)
-	if err != nil {
-		if err := tx.Rollback(ctx); err != nil {
-			return fmt.Errorf("failed to rollback transaction: %w", err)
+	for start := 0; start < len(customers); start += batchSize {
+		builder := sq.Insert("customer").
+			Columns("telegram_id", "expire_at", "language", "subscription_link", "panel_uuid", "panel_short_uuid", "panel", "trial_used_at", "trial_source").
+			PlaceholderFormat(sq.Dollar)
+		for _, cust := range customers[start:min(start+batchSize, len(customers))] {
+			builder = builder.Values(cust.TelegramID, cust.ExpireAt, cust.Language, cust.SubscriptionLink, cust.PanelUUID, cust.PanelShortUUID, cust.Panel, cust.TrialUsedAt, cust.TrialSource)
+		}
+		sqlStr, args, err := builder.ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build batch insert query: %w", err)
+		}
+		if _, err := tx.Exec(ctx, sqlStr, args...); err != nil {
+			return fmt.Errorf("failed to execute batch insert: %w", err)
 		}
-		return fmt.Errorf("failed to execute batch insert: %w", err)
 	}
 
 	if err := tx.Commit(ctx); err != nil {
@@ -276,31 +412,34 @@ func (cr *CustomerRepository) CreateBatch(ctx context.Context, customers []Custo
 	return nil
 }
 
+// UpdateBatch writes the panel fields: expiration date, subscription link, panel and panel user, and restores
+// archived customers.
 func (cr *CustomerRepository) UpdateBatch(ctx context.Context, customers []Customer) error {
 	if len(customers) == 0 {
 		return nil
 	}
-	query := "UPDATE customer SET expire_at = c.expire_at, language = c.language, subscription_link = c.subscription_link FROM (VALUES "
-	var args []interface{}
-	for i, cust := range customers {
-		if i > 0 {
-			query += ", "
-		}
-		query += fmt.Sprintf("($%d::bigint, $%d::timestamp, $%d::text, $%d::text)", i*4+1, i*4+2, i*4+3, i*4+4)
-		args = append(args, cust.TelegramID, cust.ExpireAt, cust.Language, cust.SubscriptionLink)
-	}
-	query += ") AS c(telegram_id, expire_at, language, subscription_link) WHERE customer.telegram_id = c.telegram_id"
 
 	tx, err := cr.pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	_, err = cr.pool.Exec(ctx, query, args...)
-	if err != nil {
-		if err := tx.Rollback(ctx); err != nil {
-			return fmt.Errorf("failed to rollback transaction: %w", err)
+	defer tx.Rollback(ctx)
+
+	for start := 0; start < len(customers); start += batchSize {
+		query := "UPDATE customer SET expire_at = c.expire_at, subscription_link = c.subscription_link, panel_uuid = c.panel_uuid, panel_short_uuid = c.panel_short_uuid, panel = c.panel, archived_at = NULL FROM (VALUES "
+		var args []interface{}
+		for i, cust := range customers[start:min(start+batchSize, len(customers))] {
+			if i > 0 {
+				query += ", "
+			}
+			query += fmt.Sprintf("($%d::bigint, $%d::timestamp, $%d::text, $%d::uuid, $%d::text, $%d::text)", i*6+1, i*6+2, i*6+3, i*6+4, i*6+5, i*6+6)
+			args = append(args, cust.TelegramID, cust.ExpireAt, cust.SubscriptionLink, cust.PanelUUID, cust.PanelShortUUID, cust.Panel)
+		}
+		query += ") AS c(telegram_id, expire_at, subscription_link, panel_uuid, panel_short_uuid, panel) WHERE customer.telegram_id = c.telegram_id"
+
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to execute batch update: %w", err)
 		}
-		return fmt.Errorf("failed to execute batch update: %w", err)
 	}
 
 	if err := tx.Commit(ctx); err != nil {
@@ -309,26 +448,519 @@ func (cr *CustomerRepository) UpdateBatch(ctx context.Context, customers []Custo
 	return nil
 }
 
-func (cr *CustomerRepository) DeleteByNotInTelegramIds(ctx context.Context, telegramIDs []int64) error {
-	var buildDelete sq.DeleteBuilder
-	if len(telegramIDs) == 0 {
-		buildDelete = sq.Delete("customer")
-	} else {
-		buildDelete = sq.Delete("customer").
-			PlaceholderFormat(sq.Dollar).
-			Where(sq.NotEq{"telegram_id": telegramIDs})
+// FindMissingFromPanel returns customers who had a panel user and whose telegram id is not among the panel users.
+// Customers who never had a panel user, banned and already archived customers are left out.
+func (cr *CustomerRepository) FindMissingFromPanel(ctx context.Context, telegramIDs []int64) ([]Customer, error) {
+	conditions := sq.And{
+		sq.Eq{"is_banned": false},
+		sq.Eq{"archived_at": nil},
+		sq.Or{sq.NotEq{"panel_uuid": nil}, sq.NotEq{"subscription_link": nil}},
 	}
+	if len(telegramIDs) > 0 {
+		conditions = append(conditions, sq.Expr("telegram_id <> ALL(?)", telegramIDs))
+	}
+	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language", "is_banned", "ban_reason", "archived_at", "panel_uuid", "panel_short_uuid", "panel", "is_trial", "trial_used_at", "trial_source", "phone_hash", "channel_bonus_at", "channel_bonus_days").
+		From("customer").
+		Where(conditions).
+		OrderBy("id").
+		PlaceholderFormat(sq.Dollar)
 
-	sqlStr, args, err := buildDelete.ToSql()
+	sqlStr, args, err := buildSelect.ToSql()
 	if err != nil {
-		return fmt.Errorf("failed to build delete query: %w", err)
+		return nil, fmt.Errorf("failed to build select query: %w", err)
 	}
 
-	_, err = cr.pool.Exec(ctx, sqlStr, args...)
+	rows, err := cr.pool.Query(ctx, sqlStr, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customers missing from panel: %w", err)
+	}
+	defer rows.Close()
+
+	var customers []Customer
+	for rows.Next() {
+		var customer Customer
+		err := rows.Scan(
+			&customer.ID,
+			&customer.TelegramID,
+			&customer.ExpireAt,
+			&customer.CreatedAt,
+			&customer.SubscriptionLink,
+			&customer.Language,
+			&customer.IsBanned,
+			&customer.BanReason,
+			&customer.ArchivedAt,
+			&customer.PanelUUID,
+			&customer.PanelShortUUID,
+			&customer.Panel,
+			&customer.IsTrial,
+			&customer.TrialUsedAt,
+			&customer.TrialSource,
+			&customer.PhoneHash,
+			&customer.ChannelBonusAt,
+			&customer.ChannelBonusDays,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan customer row: %w", err)
+		}
+		customers = append(customers, customer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over customer rows: %w", err)
+	}
+
+	return customers, nil
+}
+
+// ArchiveByIds soft-deletes customers: purchases and referrals are kept, broadcasts and expiration
+// notifications skip them until sync sees them in the panel again.
+func (cr *CustomerRepository) ArchiveByIds(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := cr.pool.Exec(ctx, "UPDATE customer SET archived_at = NOW() WHERE id = ANY($1)", ids)
+	if err != nil {
+		return fmt.Errorf("failed to archive customers: %w", err)
+	}
+	return nil
+}
+
+func (cr *CustomerRepository) DeleteByIds(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := cr.pool.Exec(ctx, "DELETE FROM customer WHERE id = ANY($1)", ids)
 	if err != nil {
 		return fmt.Errorf("failed to delete customers: %w", err)
 	}
+	return nil
+}
+
+type CustomerStats struct {
+	Total        int
+	Active       int
+	ActiveTrials int
+}
+
+// Stats counts all customers, customers with an active subscription and active trials.
+func (cr *CustomerRepository) Stats(ctx context.Context) (*CustomerStats, error) {
+	query := `SELECT COUNT(*),
+       COUNT(*) FILTER (WHERE c.expire_at > NOW()),
+       COUNT(*) FILTER (WHERE c.expire_at > NOW() AND c.is_trial)
+FROM customer c`
+
+	var stats CustomerStats
+	err := cr.pool.QueryRow(ctx, query).Scan(&stats.Total, &stats.Active, &stats.ActiveTrials)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customer stats: %w", err)
+	}
+	return &stats, nil
+}
+
+type CustomerSegment string
+
+const (
+	CustomerSegmentAll       CustomerSegment = "all"
+	CustomerSegmentActive    CustomerSegment = "active"
+	CustomerSegmentExpired   CustomerSegment = "expired"
+	CustomerSegmentTrial     CustomerSegment = "trial"
+	CustomerSegmentNeverPaid CustomerSegment = "never_paid"
+	CustomerSegmentLanguage  CustomerSegment = "language"
+)
+
+func segmentCondition(segment CustomerSegment, language string) sq.Sqlizer {
+	neverPaid := sq.Expr("NOT EXISTS (SELECT 1 FROM purchase p WHERE p.customer_id = customer.id AND p.status = ?)", PurchaseStatusPaid)
+	conditions := sq.And{sq.Eq{"bot_blocked_at": nil}, sq.Eq{"archived_at": nil}}
+
+	switch segment {
+	case CustomerSegmentActive:
+		conditions = append(conditions, sq.Expr("expire_at > NOW()"))
+	case CustomerSegmentExpired:
+		conditions = append(conditions, sq.Expr("expire_at <= NOW()"))
+	case CustomerSegmentTrial:
+		conditions = append(conditions, sq.Expr("expire_at > NOW()"), sq.Eq{"is_trial": true})
+	case CustomerSegmentNeverPaid:
+		conditions = append(conditions, neverPaid)
+	case CustomerSegmentLanguage:
+		conditions = append(conditions, sq.Eq{"language": language})
+	}
+	return conditions
+}
+
+// FindBySegment returns up to limit customers of the segment with id greater than afterID, ordered by id.
+func (cr *CustomerRepository) FindBySegment(ctx context.Context, segment CustomerSegment, language string, afterID int64, limit uint64) ([]Customer, error) {
+	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language", "is_banned", "ban_reason", "archived_at", "panel_uuid", "panel_short_uuid", "panel", "is_trial", "trial_used_at", "trial_source", "phone_hash", "channel_bonus_at", "channel_bonus_days").
+		From("customer").
+		Where(sq.And{segmentCondition(segment, language), sq.Gt{"id": afterID}}).
+		OrderBy("id").
+		Limit(limit).
+		PlaceholderFormat(sq.Dollar)
+
+	sqlStr, args, err := buildSelect.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	rows, err := cr.pool.Query(ctx, sqlStr, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customers by segment: %w", err)
+	}
+	defer rows.Close()
+
+	var customers []Customer
+	for rows.Next() {
+		var customer Customer
+		err := rows.Scan(
+			&customer.ID,
+			&customer.TelegramID,
+			&customer.ExpireAt,
+			&customer.CreatedAt,
+			&customer.SubscriptionLink,
+			&customer.Language,
+			&customer.IsBanned,
+			&customer.BanReason,
+			&customer.ArchivedAt,
+			&customer.PanelUUID,
+			&customer.PanelShortUUID,
+			&customer.Panel,
+			&customer.IsTrial,
+			&customer.TrialUsedAt,
+			&customer.TrialSource,
+			&customer.PhoneHash,
+			&customer.ChannelBonusAt,
+			&customer.ChannelBonusDays,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan customer row: %w", err)
+		}
+		customers = append(customers, customer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over customer rows: %w", err)
+	}
+
+	return customers, nil
+}
+
+func (cr *CustomerRepository) CountBySegment(ctx context.Context, segment CustomerSegment, language string) (int, error) {
+	buildSelect := sq.Select("COUNT(*)").
+		From("customer").
+		Where(segmentCondition(segment, language)).
+		PlaceholderFormat(sq.Dollar)
 
+	sqlStr, args, err := buildSelect.ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build count query: %w", err)
+	}
+
+	var count int
+	if err := cr.pool.QueryRow(ctx, sqlStr, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count customers by segment: %w", err)
+	}
+	return count, nil
+}
+
+// FindLanguages returns the distinct languages of customers who can receive messages.
+func (cr *CustomerRepository) FindLanguages(ctx context.Context) ([]string, error) {
+	rows, err := cr.pool.Query(ctx, "SELECT DISTINCT language FROM customer WHERE language IS NOT NULL AND language <> '' AND bot_blocked_at IS NULL ORDER BY language")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customer languages: %w", err)
+	}
+	defer rows.Close()
+
+	var languages []string
+	for rows.Next() {
+		var language string
+		if err := rows.Scan(&language); err != nil {
+			return nil, fmt.Errorf("failed to scan customer language: %w", err)
+		}
+		languages = append(languages, language)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over customer languages: %w", err)
+	}
+	return languages, nil
+}
+
+// MarkBotBlocked excludes the customer from broadcasts until they talk to the bot again.
+func (cr *CustomerRepository) MarkBotBlocked(ctx context.Context, telegramID int64) error {
+	_, err := cr.pool.Exec(ctx, "UPDATE customer SET bot_blocked_at = NOW() WHERE telegram_id = $1", telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to mark customer as blocked: %w", err)
+	}
+	return nil
+}
+
+func searchCondition(search string) sq.Sqlizer {
+	search = strings.TrimPrefix(strings.TrimSpace(search), "@")
+	if search == "" {
+		return sq.Expr("TRUE")
+	}
+	like := sq.ILike{"username": "%" + search + "%"}
+	if telegramID, err := strconv.ParseInt(search, 10, 64); err == nil {
+		return sq.Or{sq.Eq{"telegram_id": telegramID}, like}
+	}
+	return like
+}
+
+// FindPage returns customers matching the telegram id or username search, newest first.
+func (cr *CustomerRepository) FindPage(ctx context.Context, search string, limit, offset uint64) ([]Customer, error) {
+	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language", "is_banned", "ban_reason", "archived_at", "panel_uuid", "panel_short_uuid", "panel", "is_trial", "trial_used_at", "trial_source", "phone_hash", "channel_bonus_at", "channel_bonus_days").
+		From("customer").
+		Where(searchCondition(search)).
+		OrderBy("id DESC").
+		Limit(limit).
+		Offset(offset).
+		PlaceholderFormat(sq.Dollar)
+
+	sqlStr, args, err := buildSelect.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	rows, err := cr.pool.Query(ctx, sqlStr, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customers page: %w", err)
+	}
+	defer rows.Close()
+
+	var customers []Customer
+	for rows.Next() {
+		var customer Customer
+		err := rows.Scan(
+			&customer.ID,
+			&customer.TelegramID,
+			&customer.ExpireAt,
+			&customer.CreatedAt,
+			&customer.SubscriptionLink,
+			&customer.Language,
+			&customer.IsBanned,
+			&customer.BanReason,
+			&customer.ArchivedAt,
+			&customer.PanelUUID,
+			&customer.PanelShortUUID,
+			&customer.Panel,
+			&customer.IsTrial,
+			&customer.TrialUsedAt,
+			&customer.TrialSource,
+			&customer.PhoneHash,
+			&customer.ChannelBonusAt,
+			&customer.ChannelBonusDays,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan customer row: %w", err)
+		}
+		customers = append(customers, customer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over customer rows: %w", err)
+	}
+
+	return customers, nil
+}
+
+func (cr *CustomerRepository) CountSearch(ctx context.Context, search string) (int, error) {
+	buildSelect := sq.Select("COUNT(*)").
+		From("customer").
+		Where(searchCondition(search)).
+		PlaceholderFormat(sq.Dollar)
+
+	sqlStr, args, err := buildSelect.ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build count query: %w", err)
+	}
+
+	var count int
+	if err := cr.pool.QueryRow(ctx, sqlStr, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count customers: %w", err)
+	}
+	return count, nil
+}
+
+// SetBanned bans or unbans the customer. Banned customers are kept by sync even when they are gone from the panel.
+func (cr *CustomerRepository) SetBanned(ctx context.Context, id int64, banned bool, reason *string) error {
+	var bannedAt interface{}
+	if banned {
+		bannedAt = time.Now()
+	}
+	return cr.UpdateFields(ctx, id, map[string]interface{}{
+		"is_banned":  banned,
+		"ban_reason": reason,
+		"banned_at":  bannedAt,
+	})
+}
+
+// FindBan reports whether the telegram account is banned and why. Unknown accounts are not banned.
+func (cr *CustomerRepository) FindBan(ctx context.Context, telegramID int64) (bool, *string, error) {
+	var banned bool
+	var reason *string
+	err := cr.pool.QueryRow(ctx, "SELECT is_banned, ban_reason FROM customer WHERE telegram_id = $1", telegramID).Scan(&banned, &reason)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to query customer ban: %w", err)
+	}
+	return banned, reason, nil
+}
+
+// ClaimLinkReset marks a self-service link reset and reports false when the previous one was less than cooldown ago.
+func (cr *CustomerRepository) ClaimLinkReset(ctx context.Context, id int64, cooldown time.Duration) (bool, error) {
+	result, err := cr.pool.Exec(ctx,
+		"UPDATE customer SET link_reset_at = NOW() WHERE id = $1 AND (link_reset_at IS NULL OR link_reset_at <= $2)",
+		id, time.Now().Add(-cooldown))
+	if err != nil {
+		return false, fmt.Errorf("failed to claim link reset: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// ReleaseLinkReset gives the claim back when the reset failed, so the customer can try again right away.
+func (cr *CustomerRepository) ReleaseLinkReset(ctx context.Context, id int64) error {
+	_, err := cr.pool.Exec(ctx, "UPDATE customer SET link_reset_at = NULL WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to release link reset: %w", err)
+	}
+	return nil
+}
+
+// ClaimTrial marks the trial of the customer as used and reports false when it already was.
+func (cr *CustomerRepository) ClaimTrial(ctx context.Context, id int64, source string) (bool, error) {
+	result, err := cr.pool.Exec(ctx,
+		"UPDATE customer SET trial_used_at = NOW(), trial_source = $2 WHERE id = $1 AND trial_used_at IS NULL", id, source)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim trial: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// ResetTrial lets the customer take the trial again. It is used when the activation failed and by admins.
+func (cr *CustomerRepository) ResetTrial(ctx context.Context, id int64) error {
+	_, err := cr.pool.Exec(ctx, "UPDATE customer SET trial_used_at = NULL, trial_source = NULL WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to reset trial: %w", err)
+	}
+	return nil
+}
+
+// SetPhoneHash stores the hash of the phone number shared by the customer.
+func (cr *CustomerRepository) SetPhoneHash(ctx context.Context, id int64, phoneHash string) error {
+	return cr.UpdateFields(ctx, id, map[string]interface{}{"phone_hash": phoneHash})
+}
+
+// PhoneTrialUsed reports whether another customer with the same phone number has already used the trial.
+func (cr *CustomerRepository) PhoneTrialUsed(ctx context.Context, phoneHash string, exceptID int64) (bool, error) {
+	var used bool
+	err := cr.pool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM customer WHERE phone_hash = $1 AND id <> $2 AND trial_used_at IS NOT NULL)",
+		phoneHash, exceptID).Scan(&used)
+	if err != nil {
+		return false, fmt.Errorf("failed to query phone trial: %w", err)
+	}
+	return used, nil
+}
+
+// ClaimChannelBonus records the channel bonus of the customer and reports false when they already have one.
+func (cr *CustomerRepository) ClaimChannelBonus(ctx context.Context, id int64, days int) (bool, error) {
+	result, err := cr.pool.Exec(ctx,
+		"UPDATE customer SET channel_bonus_at = NOW(), channel_bonus_days = $2 WHERE id = $1 AND channel_bonus_at IS NULL", id, days)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim channel bonus: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// ReleaseChannelBonus clears the channel bonus when granting it failed or it was taken back.
+func (cr *CustomerRepository) ReleaseChannelBonus(ctx context.Context, id int64) error {
+	_, err := cr.pool.Exec(ctx, "UPDATE customer SET channel_bonus_at = NULL, channel_bonus_days = NULL WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to release channel bonus: %w", err)
+	}
 	return nil
+}
+
+// FindWithChannelBonus returns the customers holding a channel bonus. Banned and archived customers are left out.
+func (cr *CustomerRepository) FindWithChannelBonus(ctx context.Context) ([]Customer, error) {
+	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language", "is_banned", "ban_reason", "archived_at", "panel_uuid", "panel_short_uuid", "panel", "is_trial", "trial_used_at", "trial_source", "phone_hash", "channel_bonus_at", "channel_bonus_days").
+		From("customer").
+		Where(sq.And{sq.NotEq{"channel_bonus_at": nil}, sq.Eq{"is_banned": false}, sq.Eq{"archived_at": nil}}).
+		OrderBy("id").
+		PlaceholderFormat(sq.Dollar)
+
+	sqlStr, args, err := buildSelect.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	rows, err := cr.pool.Query(ctx, sqlStr, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customers with channel bonus: %w", err)
+	}
+	defer rows.Close()
+
+	var customers []Customer
+	for rows.Next() {
+		var customer Customer
+		err := rows.Scan(
+			&customer.ID,
+			&customer.TelegramID,
+			&customer.ExpireAt,
+			&customer.CreatedAt,
+			&customer.SubscriptionLink,
+			&customer.Language,
+			&customer.IsBanned,
+			&customer.BanReason,
+			&customer.ArchivedAt,
+			&customer.PanelUUID,
+			&customer.PanelShortUUID,
+			&customer.Panel,
+			&customer.IsTrial,
+			&customer.TrialUsedAt,
+			&customer.TrialSource,
+			&customer.PhoneHash,
+			&customer.ChannelBonusAt,
+			&customer.ChannelBonusDays,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan customer row: %w", err)
+		}
+		customers = append(customers, customer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over customer rows: %w", err)
+	}
+
+	return customers, nil
+}
 
+// FindWithoutPanelUUID returns the panel names of customers whose panel user is not stored yet, keyed by
+// telegram id.
+func (cr *CustomerRepository) FindWithoutPanelUUID(ctx context.Context) (map[int64]string, error) {
+	rows, err := cr.pool.Query(ctx, "SELECT telegram_id, panel FROM customer WHERE panel_uuid IS NULL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customers without panel uuid: %w", err)
+	}
+	defer rows.Close()
+
+	panels := make(map[int64]string)
+	for rows.Next() {
+		var telegramID int64
+		var panel string
+		if err := rows.Scan(&telegramID, &panel); err != nil {
+			return nil, fmt.Errorf("failed to scan customer panel: %w", err)
+		}
+		panels[telegramID] = panel
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over customer panels: %w", err)
+	}
+	return panels, nil
+}
+
+// SetPanelUser stores the panel user of the customer.
+func (cr *CustomerRepository) SetPanelUser(ctx context.Context, telegramID int64, panelUUID uuid.UUID, shortUUID string) error {
+	_, err := cr.pool.Exec(ctx, "UPDATE customer SET panel_uuid = $2, panel_short_uuid = $3 WHERE telegram_id = $1", telegramID, panelUUID, shortUUID)
+	if err != nil {
+		return fmt.Errorf("failed to set panel user: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+// NotificationLogRepository records which scheduled notifications a customer got for a subscription period. The
+// period is identified by the expiration date, so a renewal starts a new one.
+type NotificationLogRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewNotificationLogRepository(pool *pgxpool.Pool) *NotificationLogRepository {
+	return &NotificationLogRepository{pool: pool}
+}
+
+// Claim records the notification before it is sent and returns false when it was already recorded, so that
+// concurrent or repeated runs send it once.
+func (r *NotificationLogRepository) Claim(ctx context.Context, customerID int64, kind string, expireAt time.Time) (bool, error) {
+	tag, err := r.pool.Exec(ctx, `INSERT INTO notification_log (customer_id, kind, expire_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (customer_id, kind, expire_at) DO NOTHING`, customerID, kind, expireAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim notification: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Release removes a claimed notification that could not be sent, so the next run tries again.
+func (r *NotificationLogRepository) Release(ctx context.Context, customerID int64, kind string, expireAt time.Time) error {
+	_, err := r.pool.Exec(ctx, "DELETE FROM notification_log WHERE customer_id = $1 AND kind = $2 AND expire_at = $3", customerID, kind, expireAt)
+	if err != nil {
+		return fmt.Errorf("failed to release notification: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"strings"
+	"time"
+)
+
+type PromoCode struct {
+	ID             int64      `db:"id"`
+	Code           string     `db:"code"`
+	Days           int        `db:"days"`
+	MaxActivations int        `db:"max_activations"`
+	Activations    int        `db:"activations"`
+	IsActive       bool       `db:"is_active"`
+	CreatedAt      time.Time  `db:"created_at"`
+	ExpiresAt      *time.Time `db:"expires_at"`
+}
+
+var (
+	ErrPromoCodeAlreadyExists = errors.New("promo code already exists")
+	ErrPromoCodeAlreadyUsed   = errors.New("promo code already used by customer")
+	ErrPromoCodeUnavailable   = errors.New("promo code is expired, disabled or exhausted")
+)
+
+type PromoCodeRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPromoCodeRepository(pool *pgxpool.Pool) *PromoCodeRepository {
+	return &PromoCodeRepository{pool: pool}
+}
+
+var promoCodeColumns = []string{"id", "code", "days", "max_activations", "activations", "is_active", "created_at", "expires_at"}
+
+func scanPromoCode(row pgx.Row) (*PromoCode, error) {
+	var p PromoCode
+	if err := row.Scan(&p.ID, &p.Code, &p.Days, &p.MaxActivations, &p.Activations, &p.IsActive, &p.CreatedAt, &p.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *PromoCodeRepository) Create(ctx context.Context, promo *PromoCode) (*PromoCode, error) {
+	query := sq.Insert("promo_code").
+		Columns("code", "days", "max_activations", "expires_at").
+		Values(strings.ToUpper(promo.Code), promo.Days, promo.MaxActivations, promo.ExpiresAt).
+		Suffix("ON CONFLICT (code) DO NOTHING RETURNING " + strings.Join(promoCodeColumns, ", ")).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build insert promo code query: %w", err)
+	}
+
+	created, err := scanPromoCode(r.pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrPromoCodeAlreadyExists
+		}
+		return nil, fmt.Errorf("failed to insert promo code: %w", err)
+	}
+	return created, nil
+}
+
+func (r *PromoCodeRepository) FindByCode(ctx context.Context, code string) (*PromoCode, error) {
+	query := sq.Select(promoCodeColumns...).
+		From("promo_code").
+		Where(sq.Eq{"code": strings.ToUpper(code)}).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select promo code query: %w", err)
+	}
+
+	promo, err := scanPromoCode(r.pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query promo code: %w", err)
+	}
+	return promo, nil
+}
+
+func (r *PromoCodeRepository) FindLatest(ctx context.Context, limit, offset int) ([]PromoCode, error) {
+	query := sq.Select(promoCodeColumns...).
+		From("promo_code").
+		OrderBy("created_at DESC").
+		Limit(uint64(limit)).
+		Offset(uint64(offset)).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select promo codes query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query promo codes: %w", err)
+	}
+	defer rows.Close()
+
+	var promos []PromoCode
+	for rows.Next() {
+		promo, err := scanPromoCode(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan promo code row: %w", err)
+		}
+		promos = append(promos, *promo)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating promo code rows: %w", rows.Err())
+	}
+	return promos, nil
+}
+
+func (r *PromoCodeRepository) SetActive(ctx context.Context, code string, active bool) error {
+	query := sq.Update("promo_code").
+		Set("is_active", active).
+		Where(sq.Eq{"code": strings.ToUpper(code)}).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update promo code query: %w", err)
+	}
+
+	res, err := r.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update promo code: %w", err)
+	}
+	if res.RowsAffected() == 0 {
+		return errors.New("no promo code updated")
+	}
+	return nil
+}
+
+// Activate records the activation of the promo code by the customer and increments its counter.
+// It fails with ErrPromoCodeAlreadyUsed or ErrPromoCodeUnavailable without changing anything.
+func (r *PromoCodeRepository) Activate(ctx context.Context, promoCodeID, customerID int64) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	insert := sq.Insert("promo_code_activation").
+		Columns("promo_code_id", "customer_id").
+		Values(promoCodeID, customerID).
+		Suffix("ON CONFLICT (promo_code_id, customer_id) DO NOTHING").
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := insert.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build insert promo activation query: %w", err)
+	}
+	res, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("failed to insert promo activation: %w", err)
+	}
+	if res.RowsAffected() == 0 {
+		return ErrPromoCodeAlreadyUsed
+	}
+
+	update := sq.Update("promo_code").
+		Set("activations", sq.Expr("activations + 1")).
+		Where(sq.And{
+			sq.Eq{"id": promoCodeID},
+			sq.Eq{"is_active": true},
+			sq.Or{sq.Eq{"max_activations": 0}, sq.Expr("activations < max_activations")},
+			sq.Or{sq.Eq{"expires_at": nil}, sq.Expr("expires_at > NOW()")},
+		}).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err = update.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update promo code query: %w", err)
+	}
+	res, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update promo code: %w", err)
+	}
+	if res.RowsAffected() == 0 {
+		return ErrPromoCodeUnavailable
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Release reverts an activation, used when the reward could not be delivered.
+func (r *PromoCodeRepository) Release(ctx context.Context, promoCodeID, customerID int64) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM promo_code_activation WHERE promo_code_id = $1 AND customer_id = $2", promoCodeID, customerID); err != nil {
+		return fmt.Errorf("failed to delete promo activation: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "UPDATE promo_code SET activations = activations - 1 WHERE id = $1 AND activations > 0", promoCodeID); err != nil {
+		return fmt.Errorf("failed to update promo code: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+type ProvisioningJobStatus string
+
+const (
+	ProvisioningJobPending ProvisioningJobStatus = "pending"
+	ProvisioningJobDone    ProvisioningJobStatus = "done"
+	ProvisioningJobFailed  ProvisioningJobStatus = "failed"
+)
+
+// ProvisioningJob retries creating or extending the panel user of a paid purchase until the panel accepts it.
+type ProvisioningJob struct {
+	ID         int64                 `db:"id"`
+	PurchaseID int64                 `db:"purchase_id"`
+	Status     ProvisioningJobStatus `db:"status"`
+	Attempts   int                   `db:"attempts"`
+	LastError  *string               `db:"last_error"`
+	NextRunAt  time.Time             `db:"next_run_at"`
+	CreatedAt  time.Time             `db:"created_at"`
+}
+
+type ProvisioningJobRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewProvisioningJobRepository(pool *pgxpool.Pool) *ProvisioningJobRepository {
+	return &ProvisioningJobRepository{pool: pool}
+}
+
+// Enqueue schedules provisioning of the purchase after delay. A purchase has at most one job.
+func (r *ProvisioningJobRepository) Enqueue(ctx context.Context, purchaseID int64, delay time.Duration, lastError string) error {
+	_, err := r.pool.Exec(ctx, `INSERT INTO provisioning_job (purchase_id, attempts, last_error, next_run_at)
+VALUES ($1, 1, $2, $3)
+ON CONFLICT (purchase_id) DO NOTHING`, purchaseID, lastError, time.Now().Add(delay))
+	if err != nil {
+		return fmt.Errorf("failed to enqueue provisioning job: %w", err)
+	}
+	return nil
+}
+
+// EnqueueOrphaned queues the paid_unprovisioned purchases paid more than olderThan ago that have no job, because
+// queueing it right after the payment failed. It returns the number of queued purchases.
+func (r *ProvisioningJobRepository) EnqueueOrphaned(ctx context.Context, olderThan time.Duration) (int64, error) {
+	result, err := r.pool.Exec(ctx, `INSERT INTO provisioning_job (purchase_id, attempts, last_error, next_run_at)
+SELECT p.id, 1, 'provisioning job was not queued', NOW()
+FROM purchase p
+WHERE p.status = $1
+  AND p.paid_at < $2
+  AND NOT EXISTS (SELECT 1 FROM provisioning_job j WHERE j.purchase_id = p.id)
+ON CONFLICT (purchase_id) DO NOTHING`, PurchaseStatusPaidUnprovisioned, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue orphaned purchases: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// Claim locks up to limit due jobs with FOR UPDATE SKIP LOCKED, so several workers never take the same job, and
+// leases them: the attempt is counted and the job is hidden for lease. A worker that dies mid-job only delays it.
+func (r *ProvisioningJobRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]ProvisioningJob, error) {
+	rows, err := r.pool.Query(ctx, `UPDATE provisioning_job
+SET attempts = attempts + 1, next_run_at = $3, updated_at = NOW()
+WHERE id IN (SELECT id
+             FROM provisioning_job
+             WHERE status = $1 AND next_run_at <= NOW()
+             ORDER BY next_run_at
+             LIMIT $2 FOR UPDATE SKIP LOCKED)
+RETURNING id, purchase_id, status, attempts, last_error, next_run_at, created_at`,
+		ProvisioningJobPending, limit, time.Now().Add(lease))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim provisioning jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []ProvisioningJob
+	for rows.Next() {
+		var job ProvisioningJob
+		if err := rows.Scan(&job.ID, &job.PurchaseID, &job.Status, &job.Attempts, &job.LastError, &job.NextRunAt, &job.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan provisioning job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over provisioning jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (r *ProvisioningJobRepository) MarkDone(ctx context.Context, id int64) error {
+	return r.update(ctx, id, ProvisioningJobDone, nil, nil)
+}
+
+// Retry records the error and schedules the next attempt.
+func (r *ProvisioningJobRepository) Retry(ctx context.Context, id int64, nextRunAt time.Time, lastError string) error {
+	return r.update(ctx, id, ProvisioningJobPending, &lastError, &nextRunAt)
+}
+
+// MarkFailed stops retrying, the purchase stays paid_unprovisioned until an admin resolves it.
+func (r *ProvisioningJobRepository) MarkFailed(ctx context.Context, id int64, lastError string) error {
+	return r.update(ctx, id, ProvisioningJobFailed, &lastError, nil)
+}
+
+func (r *ProvisioningJobRepository) update(ctx context.Context, id int64, status ProvisioningJobStatus, lastError *string, nextRunAt *time.Time) error {
+	_, err := r.pool.Exec(ctx, `UPDATE provisioning_job
+SET status = $2, last_error = COALESCE($3, last_error), next_run_at = COALESCE($4, next_run_at), updated_at = NOW()
+WHERE id = $1`, id, status, lastError, nextRunAt)
+	if err != nil {
+		return fmt.Errorf("failed to update provisioning job: %w", err)
+	}
+	return nil
+}
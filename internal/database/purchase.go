@@ -27,6 +27,8 @@ const (
 	PurchaseStatusPending PurchaseStatus = "pending"
 	PurchaseStatusPaid    PurchaseStatus = "paid"
 	PurchaseStatusCancel  PurchaseStatus = "cancel"
+	// PurchaseStatusPaidUnprovisioned is a confirmed payment whose panel user is not created or extended yet.
+	PurchaseStatusPaidUnprovisioned PurchaseStatus = "paid_unprovisioned"
 )
 
 type Purchase struct {
@@ -37,7 +39,7 @@ type Purchase struct {
 	Month             int            `db:"month"`
 	PaidAt            *time.Time     `db:"paid_at"`
 	Currency          string         `db:"currency"`
-	ExpireAt          *time.Time     `db:"expire_at"`
+	ExpireAt          *time.Time     `db:"expire_at"` // the subscription end paid for, stored before provisioning
 	Status            PurchaseStatus `db:"status"`
 	InvoiceType       InvoiceType    `db:"invoice_type"`
 	CryptoInvoiceID   *int64         `db:"crypto_invoice_id"`
@@ -199,17 +201,23 @@ func (p *PurchaseRepository) UpdateFields(ctx context.Context, id int64, updates
 	return nil
 }
 
-func (pr *PurchaseRepository) MarkAsPaid(ctx context.Context, purchaseID int64) error {
-	currentTime := time.Now()
-
+// MarkAsPaidUnprovisioned records the confirmed payment before the panel is called.
+func (pr *PurchaseRepository) MarkAsPaidUnprovisioned(ctx context.Context, purchaseID int64) error {
 	updates := map[string]interface{}{
-		"status":  PurchaseStatusPaid,
-		"paid_at": currentTime,
+		"status":  PurchaseStatusPaidUnprovisioned,
+		"paid_at": time.Now(),
 	}
 
 	return pr.UpdateFields(ctx, purchaseID, updates)
 }
 
+// MarkAsProvisioned completes a paid_unprovisioned purchase and keeps the payment time.
+func (pr *PurchaseRepository) MarkAsProvisioned(ctx context.Context, purchaseID int64) error {
+	return pr.UpdateFields(ctx, purchaseID, map[string]interface{}{
+		"status": PurchaseStatusPaid,
+	})
+}
+
 func (pr *PurchaseRepository) FindTributesByCustomerIDs(
 	ctx context.Context,
 	customerIDs []int64,
@@ -296,3 +304,167 @@ func (pr *PurchaseRepository) FindByCustomerIDAndInvoiceTypeLast(
 
 	return p, nil
 }
+
+// FindByCustomerID returns the latest purchases of the customer, newest first.
+func (pr *PurchaseRepository) FindByCustomerID(ctx context.Context, customerID int64, limit uint64) ([]Purchase, error) {
+	query := sq.Select("*").
+		From("purchase").
+		Where(sq.Eq{"customer_id": customerID}).
+		OrderBy("created_at DESC").
+		Limit(limit).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	rows, err := pr.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query purchases: %w", err)
+	}
+	defer rows.Close()
+
+	var purchases []Purchase
+	for rows.Next() {
+		var p Purchase
+		if err := rows.Scan(
+			&p.ID, &p.Amount, &p.CustomerID, &p.CreatedAt, &p.Month,
+			&p.PaidAt, &p.Currency, &p.ExpireAt, &p.Status, &p.InvoiceType,
+			&p.CryptoInvoiceID, &p.CryptoInvoiceLink, &p.YookasaURL, &p.YookasaID,
+		); err != nil {
+			return nil, fmt.Errorf("scan purchase: %w", err)
+		}
+		purchases = append(purchases, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	return purchases, nil
+}
+
+// PurchaseFilter narrows FindPage and Count, zero values match everything.
+type PurchaseFilter struct {
+	CustomerID  int64
+	Status      PurchaseStatus
+	InvoiceType InvoiceType
+}
+
+func (f PurchaseFilter) condition() sq.And {
+	where := sq.And{}
+	if f.CustomerID != 0 {
+		where = append(where, sq.Eq{"customer_id": f.CustomerID})
+	}
+	if f.Status != "" {
+		where = append(where, sq.Eq{"status": f.Status})
+	}
+	if f.InvoiceType != "" {
+		where = append(where, sq.Eq{"invoice_type": f.InvoiceType})
+	}
+	return where
+}
+
+// FindPage returns purchases matching the filter, newest first.
+func (pr *PurchaseRepository) FindPage(ctx context.Context, filter PurchaseFilter, limit, offset uint64) ([]Purchase, error) {
+	query := sq.Select("*").
+		From("purchase").
+		Where(filter.condition()).
+		OrderBy("created_at DESC", "id DESC").
+		Limit(limit).
+		Offset(offset).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	rows, err := pr.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query purchases: %w", err)
+	}
+	defer rows.Close()
+
+	var purchases []Purchase
+	for rows.Next() {
+		var p Purchase
+		if err := rows.Scan(
+			&p.ID, &p.Amount, &p.CustomerID, &p.CreatedAt, &p.Month,
+			&p.PaidAt, &p.Currency, &p.ExpireAt, &p.Status, &p.InvoiceType,
+			&p.CryptoInvoiceID, &p.CryptoInvoiceLink, &p.YookasaURL, &p.YookasaID,
+		); err != nil {
+			return nil, fmt.Errorf("scan purchase: %w", err)
+		}
+		purchases = append(purchases, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	return purchases, nil
+}
+
+func (pr *PurchaseRepository) Count(ctx context.Context, filter PurchaseFilter) (int, error) {
+	query := sq.Select("COUNT(*)").
+		From("purchase").
+		Where(filter.condition()).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("build query: %w", err)
+	}
+
+	var count int
+	if err := pr.pool.QueryRow(ctx, sql, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count purchases: %w", err)
+	}
+	return count, nil
+}
+
+type Revenue struct {
+	InvoiceType InvoiceType
+	Currency    string
+	Amount      float64
+	Count       int
+}
+
+// RevenueSince sums paid purchases since the given moment grouped by invoice type and currency.
+func (pr *PurchaseRepository) RevenueSince(ctx context.Context, since time.Time) ([]Revenue, error) {
+	query := sq.Select("invoice_type", "COALESCE(currency, '')", "COALESCE(SUM(amount), 0)", "COUNT(*)").
+		From("purchase").
+		Where(sq.And{
+			sq.Eq{"status": PurchaseStatusPaid},
+			sq.GtOrEq{"paid_at": since},
+		}).
+		GroupBy("invoice_type", "currency").
+		OrderBy("invoice_type", "currency").
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	rows, err := pr.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query revenue: %w", err)
+	}
+	defer rows.Close()
+
+	var revenue []Revenue
+	for rows.Next() {
+		var r Revenue
+		if err := rows.Scan(&r.InvoiceType, &r.Currency, &r.Amount, &r.Count); err != nil {
+			return nil, fmt.Errorf("scan revenue: %w", err)
+		}
+		revenue = append(revenue, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+	return revenue, nil
+}
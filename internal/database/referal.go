@@ -122,6 +122,7 @@ func (r *ReferralRepository) FindByReferee(ctx context.Context, refereeID int64)
 func (r *ReferralRepository) MarkBonusGranted(ctx context.Context, referralID int64) error {
 	query := sq.Update("referral").
 		Set("bonus_granted", true).
+		Set("bonus_granted_at", sq.Expr("NOW()")).
 		Where(sq.Eq{"id": referralID}).
 		PlaceholderFormat(sq.Dollar)
 
@@ -139,3 +140,64 @@ func (r *ReferralRepository) MarkBonusGranted(ctx context.Context, referralID in
 	}
 	return nil
 }
+
+func (r *ReferralRepository) CountPaidByReferrer(ctx context.Context, referrerID int64) (int, error) {
+	query := sq.Select("COUNT(*)").
+		From("referral").
+		Where(sq.And{
+			sq.Eq{"referrer_id": referrerID},
+			sq.Eq{"bonus_granted": true},
+		}).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build count paid referrals query: %w", err)
+	}
+
+	var count int
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to scan count of paid referrals: %w", err)
+	}
+	return count, nil
+}
+
+// ClaimMilestoneReward records that the referrer reached the milestone. It returns false
+// when the reward for this milestone has already been claimed.
+func (r *ReferralRepository) ClaimMilestoneReward(ctx context.Context, referrerID int64, referrals int, days int) (bool, error) {
+	query := sq.Insert("referral_milestone_reward").
+		Columns("referrer_id", "referrals", "days").
+		Values(referrerID, referrals, days).
+		Suffix("ON CONFLICT (referrer_id, referrals) DO NOTHING").
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build insert milestone reward query: %w", err)
+	}
+
+	res, err := r.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to insert milestone reward: %w", err)
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+func (r *ReferralRepository) ReleaseMilestoneReward(ctx context.Context, referrerID int64, referrals int) error {
+	query := sq.Delete("referral_milestone_reward").
+		Where(sq.And{
+			sq.Eq{"referrer_id": referrerID},
+			sq.Eq{"referrals": referrals},
+		}).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build delete milestone reward query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to delete milestone reward: %w", err)
+	}
+	return nil
+}
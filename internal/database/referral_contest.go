@@ -0,0 +1,303 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+type ReferralContestStatus string
+
+const (
+	ReferralContestStatusActive   ReferralContestStatus = "active"
+	ReferralContestStatusFinished ReferralContestStatus = "finished"
+)
+
+type ReferralContest struct {
+	ID         int64                 `db:"id"`
+	Status     ReferralContestStatus `db:"status"`
+	PrizeDays  []int                 `db:"prize_days"`
+	StartedAt  time.Time             `db:"started_at"`
+	EndsAt     time.Time             `db:"ends_at"`
+	FinishedAt *time.Time            `db:"finished_at"`
+}
+
+// End returns the moment referrals stop counting towards the contest.
+func (c ReferralContest) End() time.Time {
+	if c.FinishedAt != nil && c.FinishedAt.Before(c.EndsAt) {
+		return *c.FinishedAt
+	}
+	return c.EndsAt
+}
+
+type ReferralContestWinner struct {
+	ID         int64      `db:"id"`
+	ContestID  int64      `db:"contest_id"`
+	Place      int        `db:"place"`
+	ReferrerID int64      `db:"referrer_id"`
+	Referrals  int        `db:"referrals"`
+	Days       int        `db:"days"`
+	RewardedAt *time.Time `db:"rewarded_at"`
+	// Attempts counts the failed reward deliveries. FailedAt is set when the reward is given up on.
+	Attempts  int        `db:"attempts"`
+	LastError *string    `db:"last_error"`
+	FailedAt  *time.Time `db:"failed_at"`
+}
+
+type LeaderboardEntry struct {
+	ReferrerID int64 `db:"referrer_id"`
+	Referrals  int   `db:"referrals"`
+}
+
+var ErrReferralContestAlreadyActive = errors.New("referral contest already active")
+
+type ReferralContestRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewReferralContestRepository(pool *pgxpool.Pool) *ReferralContestRepository {
+	return &ReferralContestRepository{pool: pool}
+}
+
+var referralContestColumns = []string{"id", "status", "prize_days", "started_at", "ends_at", "finished_at"}
+
+func scanReferralContest(row pgx.Row) (*ReferralContest, error) {
+	var contest ReferralContest
+	err := row.Scan(
+		&contest.ID,
+		&contest.Status,
+		&contest.PrizeDays,
+		&contest.StartedAt,
+		&contest.EndsAt,
+		&contest.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &contest, nil
+}
+
+func (r *ReferralContestRepository) Create(ctx context.Context, endsAt time.Time, prizeDays []int) (*ReferralContest, error) {
+	active, err := r.FindActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil {
+		return nil, ErrReferralContestAlreadyActive
+	}
+
+	query := sq.Insert("referral_contest").
+		Columns("status", "prize_days", "ends_at").
+		Values(ReferralContestStatusActive, prizeDays, endsAt).
+		Suffix("RETURNING id, status, prize_days, started_at, ends_at, finished_at").
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build insert referral contest query: %w", err)
+	}
+
+	contest, err := scanReferralContest(r.pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert referral contest: %w", err)
+	}
+	return contest, nil
+}
+
+func (r *ReferralContestRepository) FindActive(ctx context.Context) (*ReferralContest, error) {
+	query := sq.Select(referralContestColumns...).
+		From("referral_contest").
+		Where(sq.Eq{"status": ReferralContestStatusActive}).
+		Limit(1).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select active referral contest query: %w", err)
+	}
+
+	contest, err := scanReferralContest(r.pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query active referral contest: %w", err)
+	}
+	return contest, nil
+}
+
+// Finish moves the contest to the finished state and stores its winners in one transaction.
+// It returns false if the contest was already finished by a concurrent caller.
+func (r *ReferralContestRepository) Finish(ctx context.Context, contestID int64, finishedAt time.Time, winners []ReferralContestWinner) (bool, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	update := sq.Update("referral_contest").
+		Set("status", ReferralContestStatusFinished).
+		Set("finished_at", finishedAt).
+		Where(sq.And{
+			sq.Eq{"id": contestID},
+			sq.Eq{"status": ReferralContestStatusActive},
+		}).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := update.ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build finish referral contest query: %w", err)
+	}
+
+	res, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to finish referral contest: %w", err)
+	}
+	if res.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if len(winners) > 0 {
+		insert := sq.Insert("referral_contest_winner").
+			Columns("contest_id", "place", "referrer_id", "referrals", "days").
+			PlaceholderFormat(sq.Dollar)
+		for _, winner := range winners {
+			insert = insert.Values(contestID, winner.Place, winner.ReferrerID, winner.Referrals, winner.Days)
+		}
+
+		sql, args, err = insert.ToSql()
+		if err != nil {
+			return false, fmt.Errorf("failed to build insert contest winners query: %w", err)
+		}
+		if _, err := tx.Exec(ctx, sql, args...); err != nil {
+			return false, fmt.Errorf("failed to insert contest winners: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// ClaimWinnerReward marks the prize of the winner as rewarded before it is granted and reports false when it
+// already was, so two runs never grant the same prize.
+func (r *ReferralContestRepository) ClaimWinnerReward(ctx context.Context, winnerID int64) (bool, error) {
+	query := sq.Update("referral_contest_winner").
+		Set("rewarded_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": winnerID, "rewarded_at": nil, "failed_at": nil}).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build update contest winner query: %w", err)
+	}
+
+	result, err := r.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to update contest winner: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// MarkWinnerAttemptFailed records a failed reward delivery and releases ClaimWinnerReward. With failed set the
+// reward is given up on and the winner is no longer returned by FindUnrewardedWinners.
+func (r *ReferralContestRepository) MarkWinnerAttemptFailed(ctx context.Context, winnerID int64, lastError string, failed bool) error {
+	query := sq.Update("referral_contest_winner").
+		Set("rewarded_at", nil).
+		Set("attempts", sq.Expr("attempts + 1")).
+		Set("last_error", lastError).
+		Where(sq.Eq{"id": winnerID}).
+		PlaceholderFormat(sq.Dollar)
+	if failed {
+		query = query.Set("failed_at", sq.Expr("NOW()"))
+	}
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update contest winner query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to update contest winner: %w", err)
+	}
+	return nil
+}
+
+// FindUnrewardedWinners returns winners of finished contests whose reward has not been delivered or given up on yet.
+func (r *ReferralContestRepository) FindUnrewardedWinners(ctx context.Context) ([]ReferralContestWinner, error) {
+	query := sq.Select("id", "contest_id", "place", "referrer_id", "referrals", "days", "rewarded_at", "attempts", "last_error", "failed_at").
+		From("referral_contest_winner").
+		Where(sq.Eq{"rewarded_at": nil, "failed_at": nil}).
+		OrderBy("contest_id", "place").
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select contest winners query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query contest winners: %w", err)
+	}
+	defer rows.Close()
+
+	var winners []ReferralContestWinner
+	for rows.Next() {
+		var w ReferralContestWinner
+		if err := rows.Scan(&w.ID, &w.ContestID, &w.Place, &w.ReferrerID, &w.Referrals, &w.Days, &w.RewardedAt, &w.Attempts, &w.LastError, &w.FailedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan contest winner row: %w", err)
+		}
+		winners = append(winners, w)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating contest winner rows: %w", rows.Err())
+	}
+	return winners, nil
+}
+
+// Leaderboard counts paid referrals per referrer inside the contest window.
+func (r *ReferralContestRepository) Leaderboard(ctx context.Context, contest *ReferralContest, limit int) ([]LeaderboardEntry, error) {
+	query := sq.Select("referrer_id", "COUNT(*) AS referrals").
+		From("referral").
+		Where(sq.And{
+			sq.Eq{"bonus_granted": true},
+			sq.GtOrEq{"bonus_granted_at": contest.StartedAt},
+			sq.Lt{"bonus_granted_at": contest.End()},
+		}).
+		GroupBy("referrer_id").
+		OrderBy("referrals DESC", "MAX(bonus_granted_at) ASC").
+		PlaceholderFormat(sq.Dollar)
+	if limit > 0 {
+		query = query.Limit(uint64(limit))
+	}
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build leaderboard query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query leaderboard: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []LeaderboardEntry
+	for rows.Next() {
+		var entry LeaderboardEntry
+		if err := rows.Scan(&entry.ReferrerID, &entry.Referrals); err != nil {
+			return nil, fmt.Errorf("failed to scan leaderboard row: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating leaderboard rows: %w", rows.Err())
+	}
+	return entries, nil
+}
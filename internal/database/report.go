@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type ReportGranularity string
+
+const (
+	ReportGranularityDay   ReportGranularity = "day"
+	ReportGranularityWeek  ReportGranularity = "week"
+	ReportGranularityMonth ReportGranularity = "month"
+)
+
+// RevenueRow is the revenue of one period for one invoice type and currency. Stars are a separate currency
+// and are never summed together with money.
+type RevenueRow struct {
+	Period      time.Time
+	InvoiceType InvoiceType
+	Currency    string
+	Amount      float64
+	Count       int
+	New         int
+	Renewal     int
+}
+
+// CurrencyAmount is a sum in a single currency.
+type CurrencyAmount struct {
+	Currency string
+	Amount   float64
+}
+
+type Churn struct {
+	Churned int
+	Base    int
+}
+
+// RevenueByPeriod groups paid purchases in [from, to) by period, invoice type and currency. A purchase is
+// counted as new when it is the first paid purchase of the customer, otherwise it is a renewal.
+func (pr *PurchaseRepository) RevenueByPeriod(ctx context.Context, granularity ReportGranularity, from, to time.Time) ([]RevenueRow, error) {
+	query := `WITH paid AS (
+    SELECT p.*, ROW_NUMBER() OVER (PARTITION BY p.customer_id ORDER BY p.paid_at, p.id) AS n
+    FROM purchase p
+    WHERE p.status = $1
+)
+SELECT date_trunc($2, paid_at), invoice_type, COALESCE(currency, ''), COALESCE(SUM(amount), 0), COUNT(*),
+       COUNT(*) FILTER (WHERE n = 1)
+FROM paid
+WHERE paid_at >= $3 AND paid_at < $4
+GROUP BY 1, 2, 3
+ORDER BY 1, 2, 3`
+
+	rows, err := pr.pool.Query(ctx, query, PurchaseStatusPaid, string(granularity), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query revenue by period: %w", err)
+	}
+	defer rows.Close()
+
+	var result []RevenueRow
+	for rows.Next() {
+		var r RevenueRow
+		if err := rows.Scan(&r.Period, &r.InvoiceType, &r.Currency, &r.Amount, &r.Count, &r.New); err != nil {
+			return nil, fmt.Errorf("failed to scan revenue row: %w", err)
+		}
+		r.Renewal = r.Count - r.New
+		result = append(result, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate revenue rows: %w", err)
+	}
+	return result, nil
+}
+
+// MRR normalizes paid purchases that still cover the current moment to a monthly amount, per currency.
+func (pr *PurchaseRepository) MRR(ctx context.Context) ([]CurrencyAmount, error) {
+	query := `SELECT COALESCE(currency, ''), COALESCE(SUM(amount / GREATEST(month, 1)), 0)
+FROM purchase
+WHERE status = $1 AND paid_at + make_interval(months => month) > NOW()
+GROUP BY 1
+ORDER BY 1`
+
+	rows, err := pr.pool.Query(ctx, query, PurchaseStatusPaid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query mrr: %w", err)
+	}
+	defer rows.Close()
+
+	var result []CurrencyAmount
+	for rows.Next() {
+		var c CurrencyAmount
+		if err := rows.Scan(&c.Currency, &c.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan mrr: %w", err)
+		}
+		result = append(result, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate mrr rows: %w", err)
+	}
+	return result, nil
+}
+
+// Churn counts paying customers whose subscription ended in [from, to) and was not renewed, against all
+// paying customers whose subscription was still running at the start of the period.
+func (pr *PurchaseRepository) Churn(ctx context.Context, from, to time.Time) (*Churn, error) {
+	query := `SELECT COUNT(*) FILTER (WHERE c.expire_at >= $2 AND c.expire_at < $3 AND c.expire_at < NOW()),
+       COUNT(*) FILTER (WHERE c.expire_at >= $2)
+FROM customer c
+WHERE EXISTS (SELECT 1 FROM purchase p WHERE p.customer_id = c.id AND p.status = $1)`
+
+	var churn Churn
+	err := pr.pool.QueryRow(ctx, query, PurchaseStatusPaid, from, to).Scan(&churn.Churned, &churn.Base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query churn: %w", err)
+	}
+	return &churn, nil
+}
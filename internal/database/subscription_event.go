@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+type SubscriptionEventSource string
+
+const (
+	SubscriptionEventPurchase          SubscriptionEventSource = "purchase"
+	SubscriptionEventTrial             SubscriptionEventSource = "trial"
+	SubscriptionEventReferralBonus     SubscriptionEventSource = "referral_bonus"
+	SubscriptionEventReferralMilestone SubscriptionEventSource = "referral_milestone"
+	SubscriptionEventReferralContest   SubscriptionEventSource = "referral_contest"
+	SubscriptionEventPromoCode         SubscriptionEventSource = "promo_code"
+	SubscriptionEventTributeCancel     SubscriptionEventSource = "tribute_cancel"
+	SubscriptionEventSync              SubscriptionEventSource = "sync"
+	SubscriptionEventAdmin             SubscriptionEventSource = "admin"
+	SubscriptionEventChannelBonus      SubscriptionEventSource = "channel_bonus"
+	SubscriptionEventPanelWebhook      SubscriptionEventSource = "panel_webhook"
+	SubscriptionEventRefund            SubscriptionEventSource = "refund"
+)
+
+const (
+	ActorSystem  = "system"
+	ActorSync    = "sync"
+	ActorAPI     = "api"
+	ActorTribute = "tribute"
+)
+
+func ActorCustomer(telegramID int64) string {
+	return "customer:" + strconv.FormatInt(telegramID, 10)
+}
+
+func ActorAdmin(telegramID int64) string {
+	return "admin:" + strconv.FormatInt(telegramID, 10)
+}
+
+// SubscriptionEvent is one entry of the append-only audit log of subscription changes.
+type SubscriptionEvent struct {
+	ID               int64                   `db:"id"`
+	CustomerID       int64                   `db:"customer_id"`
+	TelegramID       int64                   `db:"telegram_id"`
+	Source           SubscriptionEventSource `db:"source"`
+	Actor            string                  `db:"actor"`
+	PreviousExpireAt *time.Time              `db:"previous_expire_at"`
+	NewExpireAt      *time.Time              `db:"new_expire_at"`
+	TrafficLimit     *int64                  `db:"traffic_limit"`
+	PurchaseID       *int64                  `db:"purchase_id"`
+	CreatedAt        time.Time               `db:"created_at"`
+}
+
+var subscriptionEventColumns = []string{"customer_id", "telegram_id", "source", "actor", "previous_expire_at", "new_expire_at", "traffic_limit", "purchase_id"}
+
+type SubscriptionEventRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewSubscriptionEventRepository(pool *pgxpool.Pool) *SubscriptionEventRepository {
+	return &SubscriptionEventRepository{pool: pool}
+}
+
+func (r *SubscriptionEventRepository) Create(ctx context.Context, event *SubscriptionEvent) error {
+	query := sq.Insert("subscription_event").
+		Columns(subscriptionEventColumns...).
+		Values(event.CustomerID, event.TelegramID, event.Source, event.Actor, event.PreviousExpireAt, event.NewExpireAt, event.TrafficLimit, event.PurchaseID).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build insert subscription event query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to insert subscription event: %w", err)
+	}
+	return nil
+}
+
+// Record writes the event and only logs a failure: the subscription has already been changed in the panel
+// at this point, so failing the whole operation would make callers retry and extend twice.
+func (r *SubscriptionEventRepository) Record(ctx context.Context, event SubscriptionEvent) {
+	if err := r.Create(ctx, &event); err != nil {
+		slog.Error("Error recording subscription event", "source", event.Source, "customer_id", event.CustomerID, "error", err)
+	}
+}
+
+func (r *SubscriptionEventRepository) CreateBatch(ctx context.Context, events []SubscriptionEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	rows := make([][]interface{}, 0, len(events))
+	for _, e := range events {
+		rows = append(rows, []interface{}{e.CustomerID, e.TelegramID, string(e.Source), e.Actor, e.PreviousExpireAt, e.NewExpireAt, e.TrafficLimit, e.PurchaseID})
+	}
+
+	_, err := r.pool.CopyFrom(ctx, pgx.Identifier{"subscription_event"}, subscriptionEventColumns, pgx.CopyFromRows(rows))
+	if err != nil {
+		return fmt.Errorf("failed to copy subscription events: %w", err)
+	}
+	return nil
+}
+
+// FindByTelegramId returns the latest events of the telegram account, newest first. Events are looked up by
+// telegram id so the history survives the customer row being recreated by sync.
+func (r *SubscriptionEventRepository) FindByTelegramId(ctx context.Context, telegramID int64, limit uint64) ([]SubscriptionEvent, error) {
+	query := sq.Select("id", "customer_id", "telegram_id", "source", "actor", "previous_expire_at", "new_expire_at", "traffic_limit", "purchase_id", "created_at").
+		From("subscription_event").
+		Where(sq.Eq{"telegram_id": telegramID}).
+		OrderBy("created_at DESC", "id DESC").
+		Limit(limit).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select subscription events query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subscription events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []SubscriptionEvent
+	for rows.Next() {
+		var e SubscriptionEvent
+		if err := rows.Scan(&e.ID, &e.CustomerID, &e.TelegramID, &e.Source, &e.Actor, &e.PreviousExpireAt, &e.NewExpireAt, &e.TrafficLimit, &e.PurchaseID, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan subscription event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate subscription events: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+// Offer campaigns stored in winback_offer.
+const (
+	OfferCampaignWinback = "winback"
+	OfferCampaignTrial   = "trial"
+)
+
+// WinbackOffer is a message with an optional personal discount: a win-back step sent to a customer whose
+// subscription lapsed, or the first-purchase offer at the end of the trial. ExpireAt is the expiration date of the
+// subscription it is about, so a customer gets each step of a campaign once per subscription period.
+type WinbackOffer struct {
+	ID                int64      `db:"id"`
+	Campaign          string     `db:"campaign"`
+	CustomerID        int64      `db:"customer_id"`
+	Step              int        `db:"step"`
+	ExpireAt          time.Time  `db:"expire_at"`
+	DiscountPercent   int        `db:"discount_percent"`
+	DiscountExpiresAt *time.Time `db:"discount_expires_at"`
+	SentAt            time.Time  `db:"sent_at"`
+	ConvertedAt       *time.Time `db:"converted_at"`
+	PurchaseID        *int64     `db:"purchase_id"`
+}
+
+// WinbackStepStats is the conversion of a campaign step: how many customers got it and how many of them paid
+// afterwards.
+type WinbackStepStats struct {
+	Campaign  string
+	Step      int
+	Sent      int
+	Converted int
+}
+
+type WinbackRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewWinbackRepository(pool *pgxpool.Pool) *WinbackRepository {
+	return &WinbackRepository{pool: pool}
+}
+
+// Claim records the offer before it is sent and returns false when the customer already got this step of the
+// campaign for the subscription period. An empty campaign is the win-back one.
+func (r *WinbackRepository) Claim(ctx context.Context, offer *WinbackOffer) (bool, error) {
+	if offer.Campaign == "" {
+		offer.Campaign = OfferCampaignWinback
+	}
+	err := r.pool.QueryRow(ctx, `INSERT INTO winback_offer (campaign, customer_id, step, expire_at, discount_percent, discount_expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (campaign, customer_id, expire_at, step) DO NOTHING
+RETURNING id, sent_at`, offer.Campaign, offer.CustomerID, offer.Step, offer.ExpireAt, offer.DiscountPercent, offer.DiscountExpiresAt).
+		Scan(&offer.ID, &offer.SentAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim winback offer: %w", err)
+	}
+	return true, nil
+}
+
+// Delete removes a claimed offer that could not be sent.
+func (r *WinbackRepository) Delete(ctx context.Context, id int64) error {
+	_, err := r.pool.Exec(ctx, "DELETE FROM winback_offer WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete winback offer: %w", err)
+	}
+	return nil
+}
+
+// FindActiveDiscount returns the largest discount of the customer that has not expired or been used, nil when
+// there is none.
+func (r *WinbackRepository) FindActiveDiscount(ctx context.Context, customerID int64) (*WinbackOffer, error) {
+	var offer WinbackOffer
+	err := r.pool.QueryRow(ctx, `SELECT id, campaign, customer_id, step, expire_at, discount_percent, discount_expires_at, sent_at, converted_at, purchase_id
+FROM winback_offer
+WHERE customer_id = $1 AND discount_percent > 0 AND discount_expires_at > NOW() AND converted_at IS NULL
+ORDER BY discount_percent DESC, discount_expires_at DESC
+LIMIT 1`, customerID).Scan(&offer.ID, &offer.Campaign, &offer.CustomerID, &offer.Step, &offer.ExpireAt, &offer.DiscountPercent,
+		&offer.DiscountExpiresAt, &offer.SentAt, &offer.ConvertedAt, &offer.PurchaseID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query winback discount: %w", err)
+	}
+	return &offer, nil
+}
+
+// MarkConverted attributes a paid purchase to the last offer the customer got for the subscription that expires or
+// expired at expireAt. It does nothing when the customer got no offer for it.
+func (r *WinbackRepository) MarkConverted(ctx context.Context, customerID int64, expireAt time.Time, purchaseID int64) error {
+	_, err := r.pool.Exec(ctx, `UPDATE winback_offer
+SET converted_at = NOW(), purchase_id = $3
+WHERE id = (SELECT id
+            FROM winback_offer
+            WHERE customer_id = $1 AND expire_at = $2 AND converted_at IS NULL
+            ORDER BY sent_at DESC, id DESC
+            LIMIT 1)`, customerID, expireAt, purchaseID)
+	if err != nil {
+		return fmt.Errorf("failed to mark winback offer as converted: %w", err)
+	}
+	return nil
+}
+
+// Stats returns the conversion of every campaign step sent since the given time.
+func (r *WinbackRepository) Stats(ctx context.Context, since time.Time) ([]WinbackStepStats, error) {
+	rows, err := r.pool.Query(ctx, `SELECT campaign, step, COUNT(*), COUNT(converted_at)
+FROM winback_offer
+WHERE sent_at >= $1
+GROUP BY campaign, step
+ORDER BY campaign DESC, step`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query winback stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []WinbackStepStats
+	for rows.Next() {
+		var s WinbackStepStats
+		if err := rows.Scan(&s.Campaign, &s.Step, &s.Sent, &s.Converted); err != nil {
+			return nil, fmt.Errorf("failed to scan winback stats: %w", err)
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over winback stats: %w", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/admin"
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+func (h Handler) AdminCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    update.Message.Chat.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      h.translation.GetText(langCode, "admin_menu"),
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: h.buildAdminMenuKeyboard(langCode, admin.RoleFromContext(ctx)),
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending /admin message", "error", err)
+	}
+}
+
+func (h Handler) AdminCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	h.editAdminScreen(ctx, b, update, h.translation.GetText(langCode, "admin_menu"), h.buildAdminMenuKeyboard(langCode, admin.RoleFromContext(ctx)))
+}
+
+func (h Handler) AdminStatsCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	text, err := h.buildAdminStatsText(ctx, langCode)
+	if err != nil {
+		slog.Error("Error building admin stats", "error", err)
+		return
+	}
+
+	h.editAdminScreen(ctx, b, update, text, [][]models.InlineKeyboardButton{
+		{{Text: h.translation.GetText(langCode, "admin_refresh_button"), CallbackData: CallbackAdminStats}},
+		{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackAdmin}},
+	})
+}
+
+func (h Handler) AdminUsersCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	h.editAdminScreen(ctx, b, update, h.translation.GetText(langCode, "admin_users_text"), h.adminBackKeyboard(langCode))
+}
+
+// buildAdminMenuKeyboard shows only the sections the admin's role has access to.
+func (h Handler) buildAdminMenuKeyboard(langCode string, role admin.Role) [][]models.InlineKeyboardButton {
+	sections := []struct {
+		permission admin.Permission
+		key        string
+		callback   string
+	}{
+		{admin.PermissionStats, "admin_stats_button", CallbackAdminStats},
+		{admin.PermissionUsersView, "admin_users_button", CallbackAdminUsers},
+		{admin.PermissionPromo, "admin_promo_button", CallbackAdminPromo},
+		{admin.PermissionBroadcast, "admin_broadcast_button", CallbackAdminBroadcast},
+		{admin.PermissionSync, "admin_sync_button", CallbackAdminSync},
+	}
+
+	var keyboard [][]models.InlineKeyboardButton
+	for _, section := range sections {
+		if role.Can(section.permission) {
+			keyboard = append(keyboard, []models.InlineKeyboardButton{
+				{Text: h.translation.GetText(langCode, section.key), CallbackData: section.callback},
+			})
+		}
+	}
+	return keyboard
+}
+
+func (h Handler) adminBackKeyboard(langCode string) [][]models.InlineKeyboardButton {
+	return [][]models.InlineKeyboardButton{
+		{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackAdmin}},
+	}
+}
+
+func (h Handler) editAdminScreen(ctx context.Context, b *bot.Bot, update *models.Update, text string, keyboard [][]models.InlineKeyboardButton) {
+	callback := update.CallbackQuery.Message.Message
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: keyboard,
+		},
+	})
+	if err != nil {
+		slog.Error("Error editing admin message", "error", err)
+	}
+}
+
+func (h Handler) buildAdminStatsText(ctx context.Context, langCode string) (string, error) {
+	stats, err := h.customerRepository.Stats(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_stats_customers"), stats.Total, stats.Active, stats.ActiveTrials))
+
+	now := time.Now()
+	periods := []struct {
+		key   string
+		since time.Time
+	}{
+		{"admin_stats_revenue_today", time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())},
+		{"admin_stats_revenue_week", now.AddDate(0, 0, -7)},
+		{"admin_stats_revenue_month", now.AddDate(0, -1, 0)},
+	}
+
+	for _, period := range periods {
+		revenue, err := h.purchaseRepository.RevenueSince(ctx, period.since)
+		if err != nil {
+			return "", err
+		}
+		text.WriteString("\n\n")
+		text.WriteString(h.translation.GetText(langCode, period.key))
+		text.WriteString(formatRevenue(revenue, h.translation.GetText(langCode, "admin_stats_no_revenue")))
+	}
+
+	winback, err := h.winbackRepository.Stats(ctx, now.AddDate(0, -1, 0))
+	if err != nil {
+		return "", err
+	}
+	if len(winback) > 0 {
+		text.WriteString("\n\n")
+		text.WriteString(h.translation.GetText(langCode, "admin_stats_winback"))
+		for _, step := range winback {
+			rate := float64(step.Converted) * 100 / float64(step.Sent)
+			text.WriteString("\n")
+			if step.Campaign == database.OfferCampaignTrial {
+				text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_stats_trial_offer"), step.Sent, step.Converted, rate))
+				continue
+			}
+			text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_stats_winback_step"), step.Step, step.Sent, step.Converted, rate))
+		}
+	}
+	return text.String(), nil
+}
+
+func formatRevenue(revenue []database.Revenue, empty string) string {
+	if len(revenue) == 0 {
+		return "\n" + empty
+	}
+	var text strings.Builder
+	for _, r := range revenue {
+		text.WriteString(fmt.Sprintf("\n• %s: <b>%.2f %s</b> (%d)", r.InvoiceType, r.Amount, r.Currency, r.Count))
+	}
+	return text.String()
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/admin"
+)
+
+// AdminMiddleware lets the update through only for admins whose role grants the permission. Regular customers
+// are ignored, admins without the permission are told so.
+func (h Handler) AdminMiddleware(permission admin.Permission) bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			var from *models.User
+			if update.Message != nil {
+				from = update.Message.From
+			} else if update.CallbackQuery != nil {
+				from = &update.CallbackQuery.From
+			}
+			if from == nil {
+				return
+			}
+
+			role, ok, err := h.accessService.RoleOf(ctx, from.ID)
+			if err != nil {
+				slog.Error("Error resolving admin role", "error", err)
+				return
+			}
+			if !ok {
+				return
+			}
+
+			if !role.Can(permission) {
+				h.denyAdminAction(ctx, b, update, from.LanguageCode)
+				return
+			}
+
+			next(admin.WithRole(ctx, role), b, update)
+		}
+	}
+}
+
+func (h Handler) denyAdminAction(ctx context.Context, b *bot.Bot, update *models.Update, langCode string) {
+	text := h.translation.GetText(langCode, "admin_forbidden")
+	if update.CallbackQuery != nil {
+		_, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			Text:            text,
+			ShowAlert:       true,
+		})
+		if err != nil {
+			slog.Error("Error answering callback query", "error", err)
+		}
+		return
+	}
+	h.sendText(ctx, b, update.Message.Chat.ID, text)
+}
+
+// AdminsCommandHandler handles "/admins" and lists admins with their roles.
+func (h Handler) AdminsCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+
+	admins, err := h.accessService.List(ctx)
+	if err != nil {
+		slog.Error("Error listing admins", "error", err)
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString(h.translation.GetText(langCode, "admin_admins_text"))
+	for _, a := range admins {
+		text.WriteString(fmt.Sprintf("\n• <code>%d</code> — %s", a.TelegramID, a.Role))
+	}
+	h.sendText(ctx, b, update.Message.Chat.ID, text.String())
+}
+
+// AdminAddCommandHandler handles "/admin_add <telegramId> <owner|support|finance>".
+func (h Handler) AdminAddCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	args := strings.Fields(update.Message.Text)
+	if len(args) != 3 {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_add_usage"))
+		return
+	}
+
+	telegramID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_add_usage"))
+		return
+	}
+	role, err := admin.ParseRole(args[2])
+	if err != nil {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_add_usage"))
+		return
+	}
+
+	err = h.accessService.Add(ctx, telegramID, role, update.Message.From.ID)
+	if errors.Is(err, admin.ErrOwnerManaged) {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_owner_managed"))
+		return
+	}
+	if err != nil {
+		slog.Error("Error adding admin", "error", err)
+		return
+	}
+	h.sendText(ctx, b, update.Message.Chat.ID, fmt.Sprintf(h.translation.GetText(langCode, "admin_added"), telegramID, role))
+}
+
+// AdminRemoveCommandHandler handles "/admin_remove <telegramId>".
+func (h Handler) AdminRemoveCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	args := strings.Fields(update.Message.Text)
+	if len(args) != 2 {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_remove_usage"))
+		return
+	}
+
+	telegramID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_remove_usage"))
+		return
+	}
+
+	removed, err := h.accessService.Remove(ctx, telegramID)
+	if errors.Is(err, admin.ErrOwnerManaged) {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_owner_managed"))
+		return
+	}
+	if err != nil {
+		slog.Error("Error removing admin", "error", err)
+		return
+	}
+	if !removed {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_not_found"))
+		return
+	}
+	h.sendText(ctx, b, update.Message.Chat.ID, fmt.Sprintf(h.translation.GetText(langCode, "admin_removed"), telegramID))
+}
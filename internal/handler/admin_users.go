@@ -0,0 +1,474 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/admin"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+var adminExtendDays = []int{7, 30, 90}
+
+const subscriptionHistorySize = 20
+
+// UserCommandHandler handles "/user <telegramId|@username|panelUsername>" and shows what the bot and the panel
+// know about the customer.
+func (h Handler) UserCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	args := strings.Fields(update.Message.Text)
+	if len(args) != 2 {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_users_text"))
+		return
+	}
+
+	customer, err := h.adminService.FindCustomer(ctx, args[1])
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_user_not_found"))
+		return
+	}
+
+	text, keyboard, err := h.buildCustomerScreen(ctx, customer, langCode)
+	if err != nil {
+		slog.Error("Error building customer info", "error", err)
+		return
+	}
+
+	isDisabled := true
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    update.Message.Chat.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text,
+		LinkPreviewOptions: &models.LinkPreviewOptions{
+			IsDisabled: &isDisabled,
+		},
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: keyboard,
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending customer info", "error", err)
+	}
+}
+
+// ExtendCommandHandler handles "/extend <telegramId|@username|panelUsername> <days>".
+func (h Handler) ExtendCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	args := strings.Fields(update.Message.Text)
+	if len(args) != 3 {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_extend_usage"))
+		return
+	}
+	days, err := strconv.Atoi(args[2])
+	if err != nil || days <= 0 {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_extend_usage"))
+		return
+	}
+
+	customer, err := h.adminService.FindCustomer(ctx, args[1])
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_user_not_found"))
+		return
+	}
+
+	err = h.adminService.Extend(ctx, customer, days, database.ActorAdmin(update.Message.From.ID))
+	if errors.Is(err, database.ErrCustomerBanned) {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_user_extend_banned"))
+		return
+	}
+	if err != nil {
+		slog.Error("Error extending subscription", "error", err)
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_user_action_failed"))
+		return
+	}
+	h.sendText(ctx, b, update.Message.Chat.ID, fmt.Sprintf(h.translation.GetText(langCode, "admin_user_extended"), days))
+}
+
+func (h Handler) AdminUserInfoCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	customer, ok := h.customerFromCallback(ctx, update)
+	if !ok {
+		return
+	}
+	h.refreshCustomerScreen(ctx, b, update, customer, "")
+}
+
+func (h Handler) AdminUserExtendCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	customer, ok := h.customerFromCallback(ctx, update)
+	if !ok {
+		return
+	}
+	days, err := strconv.Atoi(parseCallbackData(update.CallbackQuery.Data)["days"])
+	if err != nil || days <= 0 {
+		return
+	}
+
+	err = h.adminService.Extend(ctx, customer, days, database.ActorAdmin(update.CallbackQuery.From.ID))
+	if errors.Is(err, database.ErrCustomerBanned) {
+		h.refreshCustomerScreen(ctx, b, update, customer, h.translation.GetText(langCode, "admin_user_extend_banned"))
+		return
+	}
+	if err != nil {
+		slog.Error("Error extending subscription", "error", err)
+		h.refreshCustomerScreen(ctx, b, update, customer, h.translation.GetText(langCode, "admin_user_action_failed"))
+		return
+	}
+
+	customer, ok = h.customerFromCallback(ctx, update)
+	if !ok {
+		return
+	}
+	h.refreshCustomerScreen(ctx, b, update, customer, fmt.Sprintf(h.translation.GetText(langCode, "admin_user_extended"), days))
+}
+
+func (h Handler) AdminUserResetTrafficCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	customer, ok := h.customerFromCallback(ctx, update)
+	if !ok {
+		return
+	}
+	h.runCustomerAction(ctx, b, update, customer, "admin_user_traffic_reset", h.adminService.ResetTraffic(ctx, customer))
+}
+
+func (h Handler) AdminUserResetTrialCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	customer, ok := h.customerFromCallback(ctx, update)
+	if !ok {
+		return
+	}
+	h.runCustomerAction(ctx, b, update, customer, "admin_user_trial_reset", h.adminService.ResetTrial(ctx, customer))
+}
+
+func (h Handler) AdminUserDisableCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	customer, ok := h.customerFromCallback(ctx, update)
+	if !ok {
+		return
+	}
+	h.runCustomerAction(ctx, b, update, customer, "admin_user_disabled", h.adminService.SetEnabled(ctx, customer, false))
+}
+
+func (h Handler) AdminUserEnableCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	customer, ok := h.customerFromCallback(ctx, update)
+	if !ok {
+		return
+	}
+	h.runCustomerAction(ctx, b, update, customer, "admin_user_enabled", h.adminService.SetEnabled(ctx, customer, true))
+}
+
+func (h Handler) AdminUserRegenerateLinkCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	customer, ok := h.customerFromCallback(ctx, update)
+	if !ok {
+		return
+	}
+	h.runCustomerAction(ctx, b, update, customer, "admin_user_link_regenerated", h.adminService.RegenerateLink(ctx, customer))
+}
+
+func (h Handler) AdminUserResendConnectCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	customer, ok := h.customerFromCallback(ctx, update)
+	if !ok {
+		return
+	}
+	h.runCustomerAction(ctx, b, update, customer, "admin_user_connect_sent", h.sendConnectMessage(ctx, b, customer))
+}
+
+// sendConnectMessage sends the connect screen to the customer in their own language.
+// AdminUserHistoryCallbackHandler shows the subscription audit log of the customer.
+func (h Handler) AdminUserHistoryCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	customer, ok := h.customerFromCallback(ctx, update)
+	if !ok {
+		return
+	}
+
+	events, err := h.adminService.History(ctx, customer, subscriptionHistorySize)
+	if err != nil {
+		slog.Error("Error loading subscription history", "error", err)
+		return
+	}
+
+	h.editAdminScreen(ctx, b, update, h.buildSubscriptionHistoryText(customer, events, langCode), [][]models.InlineKeyboardButton{
+		{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: fmt.Sprintf("%s?id=%d", CallbackAdminUserInfo, customer.TelegramID)}},
+	})
+}
+
+func (h Handler) sendConnectMessage(ctx context.Context, b *bot.Bot, customer *database.Customer) error {
+	isDisabled := true
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text:      buildConnectText(customer, customer.Language),
+		LinkPreviewOptions: &models.LinkPreviewOptions{
+			IsDisabled: &isDisabled,
+		},
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: h.createConnectKeyboard(customer.Language),
+		},
+	})
+	return err
+}
+
+func (h Handler) runCustomerAction(ctx context.Context, b *bot.Bot, update *models.Update, customer *database.Customer, successKey string, err error) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	notice := h.translation.GetText(langCode, successKey)
+	switch {
+	case errors.Is(err, admin.ErrPanelUserNotFound):
+		notice = h.translation.GetText(langCode, "admin_user_panel_not_found")
+	case err != nil:
+		slog.Error("Error running admin action", "action", successKey, "error", err)
+		notice = h.translation.GetText(langCode, "admin_user_action_failed")
+	}
+	h.usageCache.Invalidate(customer.TelegramID)
+	h.refreshCustomerScreen(ctx, b, update, customer, notice)
+}
+
+func (h Handler) refreshCustomerScreen(ctx context.Context, b *bot.Bot, update *models.Update, customer *database.Customer, notice string) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	text, keyboard, err := h.buildCustomerScreen(ctx, customer, langCode)
+	if err != nil {
+		slog.Error("Error building customer info", "error", err)
+		return
+	}
+	if notice != "" {
+		text = notice + "\n\n" + text
+	}
+	h.editAdminScreen(ctx, b, update, text, keyboard)
+}
+
+func (h Handler) customerFromCallback(ctx context.Context, update *models.Update) (*database.Customer, bool) {
+	telegramID, err := strconv.ParseInt(parseCallbackData(update.CallbackQuery.Data)["id"], 10, 64)
+	if err != nil {
+		slog.Error("Invalid customer id in callback", "data", update.CallbackQuery.Data)
+		return nil, false
+	}
+	customer, err := h.customerRepository.FindByTelegramId(ctx, telegramID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return nil, false
+	}
+	if customer == nil {
+		return nil, false
+	}
+	return customer, true
+}
+
+func (h Handler) buildCustomerScreen(ctx context.Context, customer *database.Customer, langCode string) (string, [][]models.InlineKeyboardButton, error) {
+	info, err := h.adminService.Lookup(ctx, customer)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var text strings.Builder
+	text.WriteString(h.buildCustomerInfoText(customer, langCode))
+	text.WriteString("\n\n")
+	text.WriteString(h.buildPanelUserText(info, langCode))
+	text.WriteString("\n\n")
+	text.WriteString(h.buildPurchaseHistoryText(info.Purchases, langCode))
+	text.WriteString("\n\n")
+	text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_user_referrals"), info.Referrals, info.PaidReferrals))
+	if info.ReferredBy != nil {
+		text.WriteString("\n")
+		text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_user_referred_by"), *info.ReferredBy))
+	}
+
+	id := strconv.FormatInt(customer.TelegramID, 10)
+	refresh := []models.InlineKeyboardButton{
+		{Text: h.translation.GetText(langCode, "admin_refresh_button"), CallbackData: CallbackAdminUserInfo + "?id=" + id},
+		{Text: h.translation.GetText(langCode, "admin_user_history_button"), CallbackData: CallbackAdminUserHistory + "?id=" + id},
+	}
+	if !admin.RoleFromContext(ctx).Can(admin.PermissionUsersManage) {
+		return text.String(), [][]models.InlineKeyboardButton{refresh}, nil
+	}
+
+	var extendRow []models.InlineKeyboardButton
+	for _, days := range adminExtendDays {
+		extendRow = append(extendRow, models.InlineKeyboardButton{
+			Text:         fmt.Sprintf(h.translation.GetText(langCode, "admin_user_extend_button"), days),
+			CallbackData: fmt.Sprintf("%s?id=%s&days=%d", CallbackAdminUserExtend, id, days),
+		})
+	}
+
+	toggle := models.InlineKeyboardButton{Text: h.translation.GetText(langCode, "admin_user_disable_button"), CallbackData: CallbackAdminUserDisable + "?id=" + id}
+	if info.PanelUser != nil && info.PanelUser.Status.Value == remapi.UserDtoStatusDISABLED {
+		toggle = models.InlineKeyboardButton{Text: h.translation.GetText(langCode, "admin_user_enable_button"), CallbackData: CallbackAdminUserEnable + "?id=" + id}
+	}
+
+	keyboard := [][]models.InlineKeyboardButton{
+		extendRow,
+		{
+			{Text: h.translation.GetText(langCode, "admin_user_reset_traffic_button"), CallbackData: CallbackAdminUserResetTraffic + "?id=" + id},
+			toggle,
+		},
+		{
+			{Text: h.translation.GetText(langCode, "admin_user_regenerate_link_button"), CallbackData: CallbackAdminUserRegenerateLink + "?id=" + id},
+			{Text: h.translation.GetText(langCode, "admin_user_resend_connect_button"), CallbackData: CallbackAdminUserResendConnect + "?id=" + id},
+		},
+	}
+	if customer.TrialUsedAt != nil {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{
+			{Text: h.translation.GetText(langCode, "admin_user_reset_trial_button"), CallbackData: CallbackAdminUserResetTrial + "?id=" + id},
+		})
+	}
+	keyboard = append(keyboard, refresh)
+	return text.String(), keyboard, nil
+}
+
+func (h Handler) buildCustomerInfoText(customer *database.Customer, langCode string) string {
+	expireAt := "—"
+	if customer.ExpireAt != nil {
+		expireAt = customer.ExpireAt.Format("02.01.2006 15:04")
+	}
+	subscriptionLink := "—"
+	if customer.SubscriptionLink != nil && *customer.SubscriptionLink != "" {
+		subscriptionLink = *customer.SubscriptionLink
+	}
+
+	text := fmt.Sprintf(h.translation.GetText(langCode, "admin_user_info"),
+		customer.ID,
+		customer.TelegramID,
+		customer.Language,
+		customer.CreatedAt.Format("02.01.2006 15:04"),
+		expireAt,
+		subscriptionLink,
+	)
+	if customer.IsBanned {
+		reason := "—"
+		if customer.BanReason != nil && *customer.BanReason != "" {
+			reason = html.EscapeString(*customer.BanReason)
+		}
+		text += "\n" + fmt.Sprintf(h.translation.GetText(langCode, "admin_user_ban_status"), reason)
+	}
+	if customer.TrialUsedAt != nil {
+		source := "—"
+		if customer.TrialSource != nil {
+			source = *customer.TrialSource
+		}
+		text += "\n" + fmt.Sprintf(h.translation.GetText(langCode, "admin_user_trial_used"), customer.TrialUsedAt.Format("02.01.2006 15:04"), source)
+	} else {
+		text += "\n" + h.translation.GetText(langCode, "admin_user_trial_available")
+	}
+	if customer.PhoneHash != nil {
+		text += "\n" + h.translation.GetText(langCode, "admin_user_phone_verified")
+	}
+	if len(config.RemnawavePanels()) > 1 {
+		text += "\n" + fmt.Sprintf(h.translation.GetText(langCode, "admin_user_location"), html.EscapeString(config.RemnawavePanelByName(customer.Panel).Location))
+	}
+	return text
+}
+
+func (h Handler) buildPanelUserText(info *admin.CustomerInfo, langCode string) string {
+	if info.PanelError != nil {
+		return fmt.Sprintf(h.translation.GetText(langCode, "admin_user_panel_error"), html.EscapeString(info.PanelError.Error()))
+	}
+	user := info.PanelUser
+	if user == nil {
+		return h.translation.GetText(langCode, "admin_user_panel_not_found")
+	}
+
+	trafficLimit := "∞"
+	if limit, ok := user.TrafficLimitBytes.Get(); ok && limit > 0 {
+		trafficLimit = formatBytes(float64(limit))
+	}
+	devices := "—"
+	if limit, ok := user.HwidDeviceLimit.Get(); ok {
+		devices = strconv.Itoa(limit)
+	}
+	lastNode := "—"
+	if node, ok := user.LastConnectedNode.Get(); ok {
+		lastNode = html.EscapeString(node.NodeName)
+	}
+
+	return fmt.Sprintf(h.translation.GetText(langCode, "admin_user_panel"),
+		html.EscapeString(user.Username),
+		user.Status.Value,
+		user.ExpireAt.Format("02.01.2006 15:04"),
+		formatBytes(user.UsedTrafficBytes),
+		trafficLimit,
+		formatNilTime(user.OnlineAt),
+		formatNilTime(user.FirstConnectedAt),
+		lastNode,
+		devices,
+	)
+}
+
+func (h Handler) buildPurchaseHistoryText(purchases []database.Purchase, langCode string) string {
+	var text strings.Builder
+	text.WriteString(h.translation.GetText(langCode, "admin_user_purchases"))
+	if len(purchases) == 0 {
+		text.WriteString("\n")
+		text.WriteString(h.translation.GetText(langCode, "admin_user_no_purchases"))
+		return text.String()
+	}
+	for _, p := range purchases {
+		text.WriteString(fmt.Sprintf("\n• #%d %s %s <b>%.2f %s</b> %dm — %s",
+			p.ID, p.CreatedAt.Format("02.01.2006"), p.InvoiceType, p.Amount, p.Currency, p.Month, p.Status))
+	}
+	return text.String()
+}
+
+func (h Handler) buildSubscriptionHistoryText(customer *database.Customer, events []database.SubscriptionEvent, langCode string) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_user_history"), customer.TelegramID))
+	if len(events) == 0 {
+		text.WriteString("\n")
+		text.WriteString(h.translation.GetText(langCode, "admin_user_no_history"))
+		return text.String()
+	}
+	for _, e := range events {
+		text.WriteString(fmt.Sprintf("\n\n• %s <b>%s</b> — %s\n  %s → %s",
+			e.CreatedAt.Format("02.01.2006 15:04"), e.Source, html.EscapeString(e.Actor),
+			formatExpireAt(e.PreviousExpireAt), formatExpireAt(e.NewExpireAt)))
+		if e.TrafficLimit != nil {
+			trafficLimit := "∞"
+			if *e.TrafficLimit > 0 {
+				trafficLimit = formatBytes(float64(*e.TrafficLimit))
+			}
+			text.WriteString(", " + trafficLimit)
+		}
+		if e.PurchaseID != nil {
+			text.WriteString(fmt.Sprintf(", #%d", *e.PurchaseID))
+		}
+	}
+	return text.String()
+}
+
+func formatExpireAt(t *time.Time) string {
+	if t == nil {
+		return "—"
+	}
+	return t.In(time.Local).Format("02.01.2006 15:04")
+}
+
+func formatNilTime(t remapi.NilDateTime) string {
+	value, ok := t.Get()
+	if !ok {
+		return "—"
+	}
+	return value.In(time.Local).Format("02.01.2006 15:04")
+}
+
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for bytes >= 1024 && i < len(units)-1 {
+		bytes /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.2f %s", bytes, units[i])
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/admin"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/translation"
+)
+
+// BanMiddleware stops banned customers before any handler runs. It is installed on the bot itself, so it is a
+// plain function and not a Handler method. Successful payments are let through: the money is already charged.
+func BanMiddleware(customerRepository *database.CustomerRepository, tm *translation.Manager) bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			var from *models.User
+			switch {
+			case update.Message != nil && update.Message.SuccessfulPayment != nil:
+			case update.Message != nil:
+				from = update.Message.From
+			case update.CallbackQuery != nil:
+				from = &update.CallbackQuery.From
+			case update.PreCheckoutQuery != nil:
+				from = update.PreCheckoutQuery.From
+			}
+			if from == nil {
+				next(ctx, b, update)
+				return
+			}
+
+			banned, reason, err := customerRepository.FindBan(ctx, from.ID)
+			if err != nil {
+				slog.Error("Error checking customer ban", "error", err)
+				return
+			}
+			if !banned {
+				next(ctx, b, update)
+				return
+			}
+
+			text := tm.GetText(from.LanguageCode, "banned_message")
+			if reason != nil && *reason != "" {
+				text += "\n" + fmt.Sprintf(tm.GetText(from.LanguageCode, "banned_reason"), html.EscapeString(*reason))
+			}
+			answerBanned(ctx, b, update, text)
+		}
+	}
+}
+
+func answerBanned(ctx context.Context, b *bot.Bot, update *models.Update, text string) {
+	var err error
+	switch {
+	case update.CallbackQuery != nil:
+		_, err = b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			Text:            text,
+			ShowAlert:       true,
+		})
+	case update.PreCheckoutQuery != nil:
+		_, err = b.AnswerPreCheckoutQuery(ctx, &bot.AnswerPreCheckoutQueryParams{
+			PreCheckoutQueryID: update.PreCheckoutQuery.ID,
+			OK:                 false,
+			ErrorMessage:       text,
+		})
+	default:
+		_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:    update.Message.Chat.ID,
+			ParseMode: models.ParseModeHTML,
+			Text:      text,
+		})
+	}
+	if err != nil {
+		slog.Error("Error answering banned customer", "error", err)
+	}
+}
+
+// BanCommandHandler handles "/ban <telegramId|@username|panelUsername> [reason]".
+func (h Handler) BanCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	args := strings.Fields(update.Message.Text)
+	if len(args) < 2 {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "ban_usage"))
+		return
+	}
+
+	customer, ok := h.findCustomerForCommand(ctx, b, update, args[1])
+	if !ok {
+		return
+	}
+
+	var reason *string
+	if len(args) > 2 {
+		r := strings.Join(args[2:], " ")
+		reason = &r
+	}
+
+	err := h.adminService.Ban(ctx, customer, reason)
+	if errors.Is(err, admin.ErrBanAdmin) {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "ban_admin_forbidden"))
+		return
+	}
+	if err != nil {
+		slog.Error("Error banning customer", "error", err)
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_user_action_failed"))
+		return
+	}
+	h.sendText(ctx, b, update.Message.Chat.ID, fmt.Sprintf(h.translation.GetText(langCode, "admin_user_banned"), customer.TelegramID))
+}
+
+// UnbanCommandHandler handles "/unban <telegramId|@username|panelUsername>".
+func (h Handler) UnbanCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	args := strings.Fields(update.Message.Text)
+	if len(args) != 2 {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "unban_usage"))
+		return
+	}
+
+	customer, ok := h.findCustomerForCommand(ctx, b, update, args[1])
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.Unban(ctx, customer); err != nil {
+		slog.Error("Error unbanning customer", "error", err)
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_user_action_failed"))
+		return
+	}
+	h.sendText(ctx, b, update.Message.Chat.ID, fmt.Sprintf(h.translation.GetText(langCode, "admin_user_unbanned"), customer.TelegramID))
+}
+
+func (h Handler) findCustomerForCommand(ctx context.Context, b *bot.Bot, update *models.Update, query string) (*database.Customer, bool) {
+	customer, err := h.adminService.FindCustomer(ctx, query)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return nil, false
+	}
+	if customer == nil {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(update.Message.From.LanguageCode, "admin_user_not_found"))
+		return nil, false
+	}
+	return customer, true
+}
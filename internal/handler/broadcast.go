@@ -0,0 +1,270 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/broadcast"
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+var broadcastSegments = []database.CustomerSegment{
+	database.CustomerSegmentAll,
+	database.CustomerSegmentActive,
+	database.CustomerSegmentExpired,
+	database.CustomerSegmentTrial,
+	database.CustomerSegmentNeverPaid,
+}
+
+// BroadcastCommandHandler handles "/broadcast" and waits for the message to send.
+func (h Handler) BroadcastCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	h.broadcastService.AwaitInput(update.Message.From.ID, broadcast.InputContent, 0)
+	h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "broadcast_send_content"))
+}
+
+func (h Handler) AdminBroadcastCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	h.broadcastService.AwaitInput(update.CallbackQuery.From.ID, broadcast.InputContent, 0)
+	h.editAdminScreen(ctx, b, update, h.translation.GetText(langCode, "broadcast_send_content"), h.adminBackKeyboard(langCode))
+}
+
+// BroadcastInputHandler receives the broadcast content and buttons typed by the admin.
+func (h Handler) BroadcastInputHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	message := update.Message
+	langCode := message.From.LanguageCode
+	step, broadcastID := h.broadcastService.PendingInput(message.From.ID)
+
+	if message.Text == "/cancel" {
+		h.broadcastService.ClearInput(message.From.ID)
+		h.sendText(ctx, b, message.Chat.ID, h.translation.GetText(langCode, "broadcast_input_cancelled"))
+		return
+	}
+
+	switch step {
+	case broadcast.InputContent:
+		id, err := h.broadcastService.CreateDraft(ctx, message.From.ID, message)
+		if errors.Is(err, broadcast.ErrUnsupportedContent) {
+			h.sendText(ctx, b, message.Chat.ID, h.translation.GetText(langCode, "broadcast_unsupported"))
+			return
+		}
+		if err != nil {
+			slog.Error("Error creating broadcast draft", "error", err)
+			return
+		}
+		if _, err := h.broadcastService.SetSegment(ctx, id, database.CustomerSegmentAll, ""); err != nil {
+			slog.Error("Error setting broadcast segment", "error", err)
+			return
+		}
+		broadcastID = id
+	case broadcast.InputButtons:
+		err := h.broadcastService.SetButtons(ctx, broadcastID, message.Text)
+		if errors.Is(err, broadcast.ErrInvalidButtons) {
+			h.sendText(ctx, b, message.Chat.ID, h.translation.GetText(langCode, "broadcast_buttons_invalid"))
+			return
+		}
+		if err != nil {
+			slog.Error("Error setting broadcast buttons", "error", err)
+			return
+		}
+	default:
+		return
+	}
+	h.broadcastService.ClearInput(message.From.ID)
+
+	if err := h.broadcastService.Preview(ctx, message.Chat.ID, broadcastID); err != nil {
+		slog.Error("Error sending broadcast preview", "error", err)
+		h.sendText(ctx, b, message.Chat.ID, h.translation.GetText(langCode, "broadcast_preview_failed"))
+	}
+
+	text, keyboard, err := h.buildBroadcastScreen(ctx, broadcastID, langCode)
+	if err != nil {
+		slog.Error("Error building broadcast screen", "error", err)
+		return
+	}
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    message.Chat.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: keyboard,
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending broadcast draft message", "error", err)
+	}
+}
+
+func (h Handler) BroadcastButtonsCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	id, ok := broadcastIDFromCallback(update)
+	if !ok {
+		return
+	}
+	h.broadcastService.AwaitInput(update.CallbackQuery.From.ID, broadcast.InputButtons, id)
+	h.editAdminScreen(ctx, b, update, h.translation.GetText(langCode, "broadcast_send_buttons"), h.adminBackKeyboard(langCode))
+}
+
+func (h Handler) BroadcastSegmentCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	id, ok := broadcastIDFromCallback(update)
+	if !ok {
+		return
+	}
+	data := parseCallbackData(update.CallbackQuery.Data)
+
+	if _, err := h.broadcastService.SetSegment(ctx, id, database.CustomerSegment(data["s"]), data["lang"]); err != nil {
+		slog.Error("Error setting broadcast segment", "error", err)
+		return
+	}
+	h.refreshBroadcastScreen(ctx, b, update, id, langCode)
+}
+
+func (h Handler) BroadcastStartCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	id, ok := broadcastIDFromCallback(update)
+	if !ok {
+		return
+	}
+
+	if err := h.broadcastService.Start(ctx, id); err != nil && !errors.Is(err, broadcast.ErrNotDraft) {
+		slog.Error("Error starting broadcast", "error", err)
+		return
+	}
+	h.refreshBroadcastScreen(ctx, b, update, id, langCode)
+}
+
+func (h Handler) BroadcastStatusCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	id, ok := broadcastIDFromCallback(update)
+	if !ok {
+		return
+	}
+	h.refreshBroadcastScreen(ctx, b, update, id, langCode)
+}
+
+func (h Handler) BroadcastCancelCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	id, ok := broadcastIDFromCallback(update)
+	if !ok {
+		return
+	}
+
+	if err := h.broadcastService.Cancel(ctx, id); err != nil {
+		slog.Error("Error cancelling broadcast", "error", err)
+		return
+	}
+	h.refreshBroadcastScreen(ctx, b, update, id, langCode)
+}
+
+func (h Handler) refreshBroadcastScreen(ctx context.Context, b *bot.Bot, update *models.Update, id int64, langCode string) {
+	text, keyboard, err := h.buildBroadcastScreen(ctx, id, langCode)
+	if err != nil {
+		slog.Error("Error building broadcast screen", "error", err)
+		return
+	}
+	h.editAdminScreen(ctx, b, update, text, keyboard)
+}
+
+func (h Handler) buildBroadcastScreen(ctx context.Context, id int64, langCode string) (string, [][]models.InlineKeyboardButton, error) {
+	current, err := h.broadcastService.Find(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	if current == nil {
+		return "", nil, fmt.Errorf("broadcast %d not found", id)
+	}
+
+	audience := h.translation.GetText(langCode, "broadcast_segment_"+string(current.Segment))
+	if current.Segment == database.CustomerSegmentLanguage && current.Language != nil {
+		audience = fmt.Sprintf(audience, *current.Language)
+	}
+
+	text := fmt.Sprintf(h.translation.GetText(langCode, "broadcast_info"),
+		current.ID,
+		h.translation.GetText(langCode, "broadcast_status_"+string(current.Status)),
+		audience,
+		current.Delivered,
+		current.Total,
+		current.Failed,
+		current.Blocked,
+	)
+
+	idParam := strconv.FormatInt(current.ID, 10)
+	var keyboard [][]models.InlineKeyboardButton
+
+	switch current.Status {
+	case database.BroadcastStatusDraft:
+		languages, err := h.broadcastService.Languages(ctx)
+		if err != nil {
+			return "", nil, err
+		}
+
+		var row []models.InlineKeyboardButton
+		for _, segment := range broadcastSegments {
+			label := h.translation.GetText(langCode, "broadcast_segment_"+string(segment))
+			if current.Segment == segment {
+				label = "✅ " + label
+			}
+			row = append(row, models.InlineKeyboardButton{
+				Text:         label,
+				CallbackData: fmt.Sprintf("%s?id=%s&s=%s", CallbackBroadcastSegment, idParam, segment),
+			})
+			if len(row) == 2 {
+				keyboard = append(keyboard, row)
+				row = nil
+			}
+		}
+		if len(row) > 0 {
+			keyboard = append(keyboard, row)
+		}
+
+		row = nil
+		for _, language := range languages {
+			label := "🌐 " + language
+			if current.Segment == database.CustomerSegmentLanguage && current.Language != nil && *current.Language == language {
+				label = "✅ " + label
+			}
+			row = append(row, models.InlineKeyboardButton{
+				Text:         label,
+				CallbackData: fmt.Sprintf("%s?id=%s&s=%s&lang=%s", CallbackBroadcastSegment, idParam, database.CustomerSegmentLanguage, language),
+			})
+		}
+		if len(row) > 0 {
+			keyboard = append(keyboard, row)
+		}
+
+		keyboard = append(keyboard,
+			[]models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "broadcast_buttons_button"), CallbackData: CallbackBroadcastButtons + "?id=" + idParam}},
+			[]models.InlineKeyboardButton{
+				{Text: h.translation.GetText(langCode, "broadcast_start_button"), CallbackData: CallbackBroadcastStart + "?id=" + idParam},
+				{Text: h.translation.GetText(langCode, "broadcast_cancel_button"), CallbackData: CallbackBroadcastCancel + "?id=" + idParam},
+			},
+		)
+	case database.BroadcastStatusRunning:
+		keyboard = append(keyboard, []models.InlineKeyboardButton{
+			{Text: h.translation.GetText(langCode, "admin_refresh_button"), CallbackData: CallbackBroadcastStatus + "?id=" + idParam},
+			{Text: h.translation.GetText(langCode, "broadcast_stop_button"), CallbackData: CallbackBroadcastCancel + "?id=" + idParam},
+		})
+	default:
+		keyboard = h.adminBackKeyboard(langCode)
+	}
+
+	return text, keyboard, nil
+}
+
+func broadcastIDFromCallback(update *models.Update) (int64, bool) {
+	data := parseCallbackData(update.CallbackQuery.Data)
+	id, err := strconv.ParseInt(data["id"], 10, 64)
+	if err != nil {
+		slog.Error("Invalid broadcast id in callback", "data", update.CallbackQuery.Data)
+		return 0, false
+	}
+	return id, true
+}
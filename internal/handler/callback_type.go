@@ -1,5 +1,7 @@
 package handler
 
+import "remnawave-tg-shop-bot/internal/sync"
+
 const (
 	CallbackBuy           = "buy"
 	CallbackSell          = "sell"
@@ -8,5 +10,40 @@ const (
 	CallbackPayment       = "payment"
 	CallbackTrial         = "trial"
 	CallbackActivateTrial = "activate_trial"
+	CallbackTrialChannel  = "trial_channel_check"
 	CallbackReferral      = "referral"
+	CallbackResetLink     = "reset_link"
+	CallbackResetLinkDo   = "reset_link_confirm"
+	CallbackLocation      = "location"
+	CallbackLocationSet   = "location_set"
+	CallbackServerStatus  = "server_status"
+	CallbackChannelBonus  = "channel_bonus"
+	CallbackChannelCheck  = "channel_bonus_check"
+)
+
+const (
+	CallbackAdmin      = "admin"
+	CallbackAdminStats = "admin_stats"
+	CallbackAdminUsers = "admin_users"
+	CallbackAdminPromo = "admin_promo"
+	CallbackAdminSync  = "admin_sync"
+
+	CallbackAdminSyncApply = sync.CallbackApply
+
+	CallbackAdminUserInfo           = "admin_user_info"
+	CallbackAdminUserExtend         = "admin_user_extend"
+	CallbackAdminUserResetTraffic   = "admin_user_reset_traffic"
+	CallbackAdminUserResetTrial     = "admin_user_reset_trial"
+	CallbackAdminUserDisable        = "admin_user_disable"
+	CallbackAdminUserEnable         = "admin_user_enable"
+	CallbackAdminUserRegenerateLink = "admin_user_regenerate_link"
+	CallbackAdminUserResendConnect  = "admin_user_resend_connect"
+	CallbackAdminUserHistory        = "admin_user_history"
+
+	CallbackAdminBroadcast   = "admin_broadcast"
+	CallbackBroadcastButtons = "broadcast_buttons"
+	CallbackBroadcastSegment = "broadcast_segment"
+	CallbackBroadcastStart   = "broadcast_start"
+	CallbackBroadcastStatus  = "broadcast_status"
+	CallbackBroadcastCancel  = "broadcast_cancel"
 )
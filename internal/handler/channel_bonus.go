@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/channel"
+	"remnawave-tg-shop-bot/internal/config"
+)
+
+// ChannelBonusCallbackHandler gives ChannelBonusDays to a customer who joined the channel. Customers who have not
+// joined yet get the channel link and a button to check again.
+func (h Handler) ChannelBonusCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if config.ChannelBonusDays() == 0 {
+		return
+	}
+	langCode := update.CallbackQuery.From.LanguageCode
+	customer, err := h.customerRepository.FindByTelegramId(ctx, update.CallbackQuery.From.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		return
+	}
+
+	err = h.channelService.GrantBonus(ctx, customer)
+	switch {
+	case errors.Is(err, channel.ErrNotMember):
+		if update.CallbackQuery.Data == CallbackChannelCheck {
+			h.answerAlert(ctx, b, update, h.translation.GetText(langCode, "channel_not_joined"))
+			return
+		}
+		h.showChannelJoin(ctx, b, update, fmt.Sprintf(h.translation.GetText(langCode, "channel_bonus_text"), config.ChannelBonusDays()), CallbackChannelCheck)
+		return
+	case errors.Is(err, channel.ErrBonusClaimed):
+		h.answerAlert(ctx, b, update, h.translation.GetText(langCode, "channel_bonus_claimed"))
+		return
+	case errors.Is(err, channel.ErrNoSubscription):
+		h.answerAlert(ctx, b, update, h.translation.GetText(langCode, "channel_bonus_no_subscription"))
+		return
+	case err != nil:
+		slog.Error("Error granting channel bonus", "error", err)
+		h.answerAlert(ctx, b, update, h.translation.GetText(langCode, "channel_bonus_failed"))
+		return
+	}
+	h.usageCache.Invalidate(customer.TelegramID)
+
+	callback := update.CallbackQuery.Message.Message
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      callback.Chat.ID,
+		MessageID:   callback.ID,
+		Text:        fmt.Sprintf(h.translation.GetText(langCode, "channel_bonus_granted"), config.ChannelBonusDays()),
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: h.createConnectKeyboard(langCode)},
+	})
+	if err != nil {
+		slog.Error("Error sending channel bonus message", "error", err)
+	}
+}
+
+// showChannelJoin replaces the message with the channel link and a button that runs the check again.
+func (h Handler) showChannelJoin(ctx context.Context, b *bot.Bot, update *models.Update, text string, checkCallback string) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	callback := update.CallbackQuery.Message.Message
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: h.translation.GetText(langCode, "channel_join_button"), URL: config.ChannelURL()}},
+			{{Text: h.translation.GetText(langCode, "channel_check_button"), CallbackData: checkCallback}},
+			{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackStart}},
+		}},
+	})
+	if err != nil {
+		slog.Error("Error sending channel join message", "error", err)
+	}
+}
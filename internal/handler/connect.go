@@ -3,10 +3,13 @@ package handler
 import (
 	"context"
 	"fmt"
+	"html"
 	"remnawave-tg-shop-bot/internal/config"
+	"strconv"
 	"strings"
 	"time"
 
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"log/slog"
@@ -32,15 +35,14 @@ func (h Handler) ConnectCommandHandler(ctx context.Context, b *bot.Bot, update *
 	isDisabled := true
 	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:    update.Message.Chat.ID,
-		Text:      buildConnectText(customer, langCode),
+		Text:      buildConnectText(customer, langCode) + h.buildUsageText(ctx, customer, langCode),
 		ParseMode: models.ParseModeHTML,
 		LinkPreviewOptions: &models.LinkPreviewOptions{
 			IsDisabled: &isDisabled,
 		},
 		ReplyMarkup: models.InlineKeyboardMarkup{
-			InlineKeyboard: [][]models.InlineKeyboardButton{
-				{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackStart}},
-			},
+			InlineKeyboard: append(h.resetLinkKeyboard(customer, langCode),
+				[]models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackStart}}),
 		},
 	})
 
@@ -63,6 +65,12 @@ func (h Handler) ConnectCallbackHandler(ctx context.Context, b *bot.Bot, update
 	}
 
 	langCode := update.CallbackQuery.From.LanguageCode
+	h.editConnectScreen(ctx, b, update, customer, langCode, "")
+}
+
+// editConnectScreen turns the callback message into the connect screen, with an optional notice on top.
+func (h Handler) editConnectScreen(ctx context.Context, b *bot.Bot, update *models.Update, customer *database.Customer, langCode string, notice string) {
+	callback := update.CallbackQuery.Message.Message
 
 	var markup [][]models.InlineKeyboardButton
 	if config.IsWepAppLinkEnabled() {
@@ -73,14 +81,20 @@ func (h Handler) ConnectCallbackHandler(ctx context.Context, b *bot.Bot, update
 				}}})
 		}
 	}
+	markup = append(markup, h.resetLinkKeyboard(customer, langCode)...)
 	markup = append(markup, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackStart}})
 
+	text := buildConnectText(customer, langCode) + h.buildUsageText(ctx, customer, langCode)
+	if notice != "" {
+		text = notice + "\n\n" + text
+	}
+
 	isDisabled := true
-	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
 		ChatID:    callback.Chat.ID,
 		MessageID: callback.ID,
 		ParseMode: models.ParseModeHTML,
-		Text:      buildConnectText(customer, langCode),
+		Text:      text,
 		LinkPreviewOptions: &models.LinkPreviewOptions{
 			IsDisabled: &isDisabled,
 		},
@@ -94,6 +108,110 @@ func (h Handler) ConnectCallbackHandler(ctx context.Context, b *bot.Bot, update
 	}
 }
 
+// StatusCommandHandler handles "/status": the subscription and live usage from the panel without the link.
+func (h Handler) StatusCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	customer, err := h.customerRepository.FindByTelegramId(ctx, update.Message.Chat.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		slog.Error("customer not exist", "telegramId", utils.MaskHalfInt64(update.Message.Chat.ID))
+		return
+	}
+
+	langCode := update.Message.From.LanguageCode
+	text := h.translation.GetText(langCode, "no_subscription")
+	if customer.ExpireAt != nil && customer.ExpireAt.After(time.Now()) {
+		text = fmt.Sprintf(h.translation.GetText(langCode, "subscription_active"), customer.ExpireAt.Format("02.01.2006 15:04"))
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    update.Message.Chat.ID,
+		Text:      text + h.buildUsageText(ctx, customer, langCode),
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{{Text: h.translation.GetText(langCode, "connect_button"), CallbackData: CallbackConnect}},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending status message", "error", err)
+	}
+}
+
+// buildUsageText renders traffic, the next reset, online status, plan and devices of the panel user. It is empty
+// without an active subscription or when the panel cannot be reached, the connect screen must work regardless.
+func (h Handler) buildUsageText(ctx context.Context, customer *database.Customer, langCode string) string {
+	if customer.ExpireAt == nil || customer.ExpireAt.Before(time.Now()) {
+		return ""
+	}
+	usage, err := h.usageCache.Get(ctx, customer.Panel, customer.TelegramID, customer.PanelUUID)
+	if err != nil {
+		slog.Error("Error getting panel usage", "error", err)
+		return ""
+	}
+	if usage == nil {
+		return ""
+	}
+	user := usage.User
+
+	var text strings.Builder
+	text.WriteString("\n\n")
+	if limit, ok := user.TrafficLimitBytes.Get(); ok && limit > 0 {
+		percent := int(user.UsedTrafficBytes * 100 / float64(limit))
+		text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "usage_traffic"),
+			formatBytes(user.UsedTrafficBytes), formatBytes(float64(limit)), progressBar(percent), percent))
+	} else {
+		text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "usage_traffic_unlimited"), formatBytes(user.UsedTrafficBytes)))
+	}
+	if reset := usage.NextTrafficReset(time.Now()); reset != nil {
+		text.WriteString("\n" + fmt.Sprintf(h.translation.GetText(langCode, "usage_traffic_reset"), reset.In(time.Local).Format("02.01.2006 15:04")))
+	}
+
+	onlineAt, connected := user.OnlineAt.Get()
+	switch {
+	case connected && time.Since(onlineAt) < onlineWindow:
+		text.WriteString("\n" + h.translation.GetText(langCode, "usage_online"))
+	case connected:
+		text.WriteString("\n" + fmt.Sprintf(h.translation.GetText(langCode, "usage_last_seen"), onlineAt.In(time.Local).Format("02.01.2006 15:04")))
+	default:
+		text.WriteString("\n" + h.translation.GetText(langCode, "usage_never_connected"))
+	}
+
+	if plan := planName(user); plan != "" {
+		text.WriteString("\n" + fmt.Sprintf(h.translation.GetText(langCode, "usage_plan"), html.EscapeString(plan)))
+	}
+
+	devices := strconv.Itoa(usage.Devices)
+	if limit, ok := user.HwidDeviceLimit.Get(); ok && limit > 0 {
+		devices += " / " + strconv.Itoa(limit)
+	}
+	text.WriteString("\n" + fmt.Sprintf(h.translation.GetText(langCode, "usage_devices"), devices))
+	return text.String()
+}
+
+// onlineWindow is how recent the last activity must be for the user to be shown as online.
+const onlineWindow = 2 * time.Minute
+
+// planName is the panel tag, or the internal squads when the user has no tag.
+func planName(user *remapi.UserDto) string {
+	if tag, ok := user.Tag.Get(); ok && tag != "" {
+		return tag
+	}
+	var squads []string
+	for _, squad := range user.ActiveInternalSquads {
+		squads = append(squads, squad.Name)
+	}
+	return strings.Join(squads, ", ")
+}
+
+func progressBar(percent int) string {
+	filled := min(max(percent, 0), 100) / 10
+	return strings.Repeat("▰", filled) + strings.Repeat("▱", 10-filled)
+}
+
 func buildConnectText(customer *database.Customer, langCode string) string {
 	var info strings.Builder
 
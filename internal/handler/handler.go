@@ -1,10 +1,18 @@
 package handler
 
 import (
+	"remnawave-tg-shop-bot/internal/admin"
+	"remnawave-tg-shop-bot/internal/broadcast"
 	"remnawave-tg-shop-bot/internal/cache"
+	"remnawave-tg-shop-bot/internal/channel"
 	"remnawave-tg-shop-bot/internal/cryptopay"
 	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/notifier"
 	"remnawave-tg-shop-bot/internal/payment"
+	"remnawave-tg-shop-bot/internal/promo"
+	"remnawave-tg-shop-bot/internal/referral"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/report"
 	"remnawave-tg-shop-bot/internal/sync"
 	"remnawave-tg-shop-bot/internal/translation"
 	"remnawave-tg-shop-bot/internal/yookasa"
@@ -13,12 +21,23 @@ import (
 type Handler struct {
 	customerRepository *database.CustomerRepository
 	purchaseRepository *database.PurchaseRepository
+	winbackRepository  *database.WinbackRepository
 	cryptoPayClient    *cryptopay.Client
 	yookasaClient      *yookasa.Client
 	translation        *translation.Manager
 	paymentService     *payment.PaymentService
 	syncService        *sync.SyncService
 	referralRepository *database.ReferralRepository
+	referralService    *referral.Service
+	promoService       *promo.Service
+	broadcastService   *broadcast.Service
+	adminService       *admin.Service
+	accessService      *admin.AccessService
+	notifier           *notifier.Notifier
+	reportService      *report.Service
+	usageCache         *remnawave.UsageCache
+	nodeStatus         *remnawave.NodeStatusCache
+	channelService     *channel.Service
 	cache              *cache.Cache
 }
 
@@ -28,17 +47,29 @@ func NewHandler(
 	translation *translation.Manager,
 	customerRepository *database.CustomerRepository,
 	purchaseRepository *database.PurchaseRepository,
+	winbackRepository *database.WinbackRepository,
 	cryptoPayClient *cryptopay.Client,
-	yookasaClient *yookasa.Client, referralRepository *database.ReferralRepository, cache *cache.Cache) *Handler {
+	yookasaClient *yookasa.Client, referralRepository *database.ReferralRepository, referralService *referral.Service, promoService *promo.Service, broadcastService *broadcast.Service, adminService *admin.Service, accessService *admin.AccessService, notifier *notifier.Notifier, reportService *report.Service, usageCache *remnawave.UsageCache, nodeStatus *remnawave.NodeStatusCache, channelService *channel.Service, cache *cache.Cache) *Handler {
 	return &Handler{
 		syncService:        syncService,
 		paymentService:     paymentService,
 		customerRepository: customerRepository,
 		purchaseRepository: purchaseRepository,
+		winbackRepository:  winbackRepository,
 		cryptoPayClient:    cryptoPayClient,
 		yookasaClient:      yookasaClient,
 		translation:        translation,
 		referralRepository: referralRepository,
+		referralService:    referralService,
+		promoService:       promoService,
+		broadcastService:   broadcastService,
+		adminService:       adminService,
+		accessService:      accessService,
+		notifier:           notifier,
+		reportService:      reportService,
+		usageCache:         usageCache,
+		nodeStatus:         nodeStatus,
+		channelService:     channelService,
 		cache:              cache,
 	}
 }
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+// locationKeyboard shows the current location on the pricing screen when more than one panel is configured.
+func (h Handler) locationKeyboard(customer *database.Customer, langCode string) [][]models.InlineKeyboardButton {
+	if customer == nil || len(config.RemnawavePanels()) < 2 {
+		return nil
+	}
+	location := config.RemnawavePanelByName(customer.Panel).Location
+	return [][]models.InlineKeyboardButton{
+		{{Text: fmt.Sprintf(h.translation.GetText(langCode, "location_button"), location), CallbackData: CallbackLocation}},
+	}
+}
+
+// sellsPlan tells whether the plan can be bought for the location of the customer, see REMNAWAVE_<NAME>_PLANS.
+func sellsPlan(customer *database.Customer, month int) bool {
+	var panel string
+	if customer != nil {
+		panel = customer.Panel
+	}
+	return config.RemnawavePanelByName(panel).SellsPlan(month)
+}
+
+// LocationCallbackHandler lists the locations, one per configured panel.
+func (h Handler) LocationCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	customer, err := h.customerRepository.FindByTelegramId(ctx, update.CallbackQuery.From.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		return
+	}
+
+	current := config.RemnawavePanelByName(customer.Panel).Name
+	var keyboard [][]models.InlineKeyboardButton
+	for _, panel := range config.RemnawavePanels() {
+		text := panel.Location
+		if panel.Name == current {
+			text = "✅ " + text
+		}
+		keyboard = append(keyboard, []models.InlineKeyboardButton{
+			{Text: text, CallbackData: fmt.Sprintf("%s?panel=%s", CallbackLocationSet, panel.Name)},
+		})
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{
+		{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackBuy},
+	})
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      callback.Chat.ID,
+		MessageID:   callback.ID,
+		ParseMode:   models.ParseModeHTML,
+		Text:        fmt.Sprintf(h.translation.GetText(langCode, "location_choose"), html.EscapeString(config.RemnawavePanelByName(current).Location)),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+	if err != nil {
+		slog.Error("Error sending location message", "error", err)
+	}
+}
+
+// LocationSetCallbackHandler moves the customer to another panel. The user is created there with the next
+// purchase, so the location can only change while there is no active subscription in the current panel.
+func (h Handler) LocationSetCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	name := parseCallbackData(update.CallbackQuery.Data)["panel"]
+
+	panel := config.RemnawavePanelByName(name)
+	if panel.Name != name {
+		return
+	}
+
+	customer, err := h.customerRepository.FindByTelegramId(ctx, update.CallbackQuery.From.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		return
+	}
+
+	if config.RemnawavePanelByName(customer.Panel).Name != panel.Name {
+		if customer.ExpireAt != nil && customer.ExpireAt.After(time.Now()) {
+			h.answerAlert(ctx, b, update, h.translation.GetText(langCode, "location_change_active"))
+			return
+		}
+		err = h.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
+			"panel":            panel.Name,
+			"panel_uuid":       nil,
+			"panel_short_uuid": nil,
+		})
+		if err != nil {
+			slog.Error("Error changing customer location", "error", err)
+			return
+		}
+		h.usageCache.Invalidate(customer.TelegramID)
+		slog.Info("Customer location changed", "customer_id", customer.ID, "panel", panel.Name)
+	}
+
+	h.BuyCallbackHandler(ctx, b, update)
+}
@@ -13,13 +13,15 @@ import (
 func (h Handler) CreateCustomerIfNotExistMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
 	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
 		var telegramId int64
-		var langCode string
+		var langCode, username string
 		if update.Message != nil {
 			telegramId = update.Message.From.ID
 			langCode = update.Message.From.LanguageCode
+			username = update.Message.From.Username
 		} else if update.CallbackQuery != nil {
 			telegramId = update.CallbackQuery.From.ID
 			langCode = update.CallbackQuery.From.LanguageCode
+			username = update.CallbackQuery.From.Username
 		}
 		existingCustomer, err := h.customerRepository.FindByTelegramId(ctx, telegramId)
 		if err != nil {
@@ -36,9 +38,12 @@ func (h Handler) CreateCustomerIfNotExistMiddleware(next bot.HandlerFunc) bot.Ha
 				slog.Error("error creating customer", err)
 				return
 			}
+			h.notifier.NewCustomer(telegramId, username)
 		} else {
 			updates := map[string]interface{}{
-				"language": langCode,
+				"language":       langCode,
+				"username":       username,
+				"bot_blocked_at": nil,
 			}
 
 			err = h.customerRepository.UpdateFields(ctx, existingCustomer.ID, updates)
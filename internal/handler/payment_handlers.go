@@ -19,30 +19,35 @@ func (h Handler) BuyCallbackHandler(ctx context.Context, b *bot.Bot, update *mod
 	callback := update.CallbackQuery.Message.Message
 	langCode := update.CallbackQuery.From.LanguageCode
 
+	customer, err := h.customerRepository.FindByTelegramId(ctx, update.CallbackQuery.From.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+	}
+
 	var priceButtons []models.InlineKeyboardButton
 
-	if config.Price1() > 0 {
+	if config.Price1() > 0 && sellsPlan(customer, 1) {
 		priceButtons = append(priceButtons, models.InlineKeyboardButton{
 			Text:         h.translation.GetText(langCode, "month_1"),
 			CallbackData: fmt.Sprintf("%s?month=%d&amount=%d", CallbackSell, 1, config.Price1()),
 		})
 	}
 
-	if config.Price3() > 0 {
+	if config.Price3() > 0 && sellsPlan(customer, 3) {
 		priceButtons = append(priceButtons, models.InlineKeyboardButton{
 			Text:         h.translation.GetText(langCode, "month_3"),
 			CallbackData: fmt.Sprintf("%s?month=%d&amount=%d", CallbackSell, 3, config.Price3()),
 		})
 	}
 
-	if config.Price6() > 0 {
+	if config.Price6() > 0 && sellsPlan(customer, 6) {
 		priceButtons = append(priceButtons, models.InlineKeyboardButton{
 			Text:         h.translation.GetText(langCode, "month_6"),
 			CallbackData: fmt.Sprintf("%s?month=%d&amount=%d", CallbackSell, 6, config.Price6()),
 		})
 	}
 
-	if config.Price12() > 0 {
+	if config.Price12() > 0 && sellsPlan(customer, 12) {
 		priceButtons = append(priceButtons, models.InlineKeyboardButton{
 			Text:         h.translation.GetText(langCode, "month_12"),
 			CallbackData: fmt.Sprintf("%s?month=%d&amount=%d", CallbackSell, 12, config.Price12()),
@@ -58,18 +63,32 @@ func (h Handler) BuyCallbackHandler(ctx context.Context, b *bot.Bot, update *mod
 		keyboard = append(keyboard, priceButtons)
 	}
 
+	keyboard = append(keyboard, h.locationKeyboard(customer, langCode)...)
+
+	text := h.translation.GetText(langCode, "pricing_info")
+	if customer != nil {
+		offer, err := h.paymentService.ActiveDiscount(ctx, customer)
+		if err != nil {
+			slog.Error("Error finding winback discount", "error", err)
+		}
+		if offer != nil {
+			text += "\n\n" + fmt.Sprintf(h.translation.GetText(langCode, "pricing_discount"),
+				offer.DiscountPercent, offer.DiscountExpiresAt.In(time.Local).Format("02.01.2006 15:04"))
+		}
+	}
+
 	keyboard = append(keyboard, []models.InlineKeyboardButton{
 		{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackStart},
 	})
 
-	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
 		ChatID:    callback.Chat.ID,
 		MessageID: callback.ID,
 		ParseMode: models.ParseModeHTML,
 		ReplyMarkup: models.InlineKeyboardMarkup{
 			InlineKeyboard: keyboard,
 		},
-		Text: h.translation.GetText(langCode, "pricing_info"),
+		Text: text,
 	})
 
 	if err != nil {
@@ -156,6 +175,10 @@ func (h Handler) PaymentCallbackHandler(ctx context.Context, b *bot.Bot, update
 		slog.Error("customer not exist", "chatID", callback.Chat.ID, "error", err)
 		return
 	}
+	if !sellsPlan(customer, month) {
+		h.answerAlert(ctx, b, update, h.translation.GetText(update.CallbackQuery.From.LanguageCode, "location_plan_unavailable"))
+		return
+	}
 
 	ctxWithUsername := context.WithValue(ctx, "username", update.CallbackQuery.From.Username)
 	paymentURL, purchaseId, err := h.paymentService.CreatePurchase(ctxWithUsername, float64(price), month, customer, invoiceType)
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/promo"
+	"remnawave-tg-shop-bot/utils"
+)
+
+const promoListSize = 10
+
+// PromoCommandHandler handles "/promo <code>" sent by a customer.
+func (h Handler) PromoCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	args := strings.Fields(update.Message.Text)
+	if len(args) != 2 {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "promo_usage"))
+		return
+	}
+
+	customer, err := h.customerRepository.FindByTelegramId(ctx, update.Message.From.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		slog.Error("customer not exist", "telegramId", utils.MaskHalfInt64(update.Message.From.ID))
+		return
+	}
+
+	ctxWithUsername := context.WithValue(ctx, "username", update.Message.From.Username)
+	promoCode, err := h.promoService.Redeem(ctxWithUsername, customer, args[1])
+
+	var text string
+	switch {
+	case errors.Is(err, promo.ErrPromoCodeNotFound), errors.Is(err, database.ErrPromoCodeUnavailable):
+		text = h.translation.GetText(langCode, "promo_invalid")
+	case errors.Is(err, database.ErrPromoCodeAlreadyUsed):
+		text = h.translation.GetText(langCode, "promo_already_used")
+	case err != nil:
+		slog.Error("Error redeeming promo code", "error", err)
+		text = h.translation.GetText(langCode, "promo_error")
+	default:
+		text = fmt.Sprintf(h.translation.GetText(langCode, "promo_activated"), promoCode.Days)
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    update.Message.Chat.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: h.createConnectKeyboard(langCode),
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending promo message", "error", err)
+	}
+}
+
+// PromoCreateCommandHandler handles "/promo_create <code> <days> [maxActivations] [validDays]".
+func (h Handler) PromoCreateCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	args := strings.Fields(update.Message.Text)
+	if len(args) < 3 || len(args) > 5 {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_promo_create_usage"))
+		return
+	}
+
+	numbers := make([]int, 3)
+	for i, arg := range args[2:] {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_promo_create_usage"))
+			return
+		}
+		numbers[i] = n
+	}
+	if numbers[0] == 0 {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_promo_create_usage"))
+		return
+	}
+
+	created, err := h.promoService.Create(ctx, args[1], numbers[0], numbers[1], numbers[2])
+	if errors.Is(err, database.ErrPromoCodeAlreadyExists) {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_promo_exists"))
+		return
+	}
+	if err != nil {
+		slog.Error("Error creating promo code", "error", err)
+		return
+	}
+
+	h.sendText(ctx, b, update.Message.Chat.ID, fmt.Sprintf(h.translation.GetText(langCode, "admin_promo_created"), formatPromoCode(created)))
+}
+
+// PromoDisableCommandHandler handles "/promo_disable <code>".
+func (h Handler) PromoDisableCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	args := strings.Fields(update.Message.Text)
+	if len(args) != 2 {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_promo_text"))
+		return
+	}
+
+	if err := h.promoService.SetActive(ctx, args[1], false); err != nil {
+		slog.Error("Error disabling promo code", "error", err)
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "promo_invalid"))
+		return
+	}
+	h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_promo_disabled"))
+}
+
+func (h Handler) AdminPromoCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	promos, err := h.promoService.List(ctx, promoListSize, 0)
+	if err != nil {
+		slog.Error("Error listing promo codes", "error", err)
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString(h.translation.GetText(langCode, "admin_promo_text"))
+	for _, p := range promos {
+		text.WriteString("\n")
+		text.WriteString(formatPromoCode(&p))
+	}
+
+	h.editAdminScreen(ctx, b, update, text.String(), h.adminBackKeyboard(langCode))
+}
+
+func formatPromoCode(p *database.PromoCode) string {
+	status := "🟢"
+	if !p.IsActive {
+		status = "🔴"
+	}
+	limit := "∞"
+	if p.MaxActivations > 0 {
+		limit = strconv.Itoa(p.MaxActivations)
+	}
+	expires := "∞"
+	if p.ExpiresAt != nil {
+		expires = p.ExpiresAt.Format("02.01.2006")
+	}
+	return fmt.Sprintf("%s <code>%s</code> +%d, %d/%s, %s", status, p.Code, p.Days, p.Activations, limit, expires)
+}
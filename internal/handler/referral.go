@@ -21,6 +21,12 @@ func (h Handler) ReferralCallbackHandler(ctx context.Context, b *bot.Bot, update
 		return
 	}
 	text := fmt.Sprintf(h.translation.GetText(langCode, "referral_text"), count)
+	contestText, err := h.buildContestText(ctx, langCode, customer.TelegramID, true)
+	if err != nil {
+		slog.Error("error building contest leaderboard", "error", err)
+	} else if contestText != "" {
+		text += "\n\n" + contestText
+	}
 	callbackMessage := update.CallbackQuery.Message.Message
 	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
 		ChatID:    callbackMessage.Chat.ID,
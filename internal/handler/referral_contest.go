@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/utils"
+)
+
+const leaderboardSize = 10
+
+// ContestStartCommandHandler handles "/contest_start <days> <prize1,prize2,...>", where prizes are
+// subscription days for the first, second, ... place.
+func (h Handler) ContestStartCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	days, prizes, err := parseContestArgs(update.Message.Text)
+	if err != nil {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "contest_start_usage"))
+		return
+	}
+
+	contest, err := h.referralService.StartContest(ctx, time.Duration(days)*24*time.Hour, prizes)
+	if errors.Is(err, database.ErrReferralContestAlreadyActive) {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "contest_already_active"))
+		return
+	}
+	if err != nil {
+		slog.Error("Error starting referral contest", "error", err)
+		return
+	}
+
+	h.sendText(ctx, b, update.Message.Chat.ID, fmt.Sprintf(h.translation.GetText(langCode, "contest_started"),
+		contest.EndsAt.Format("02.01.2006 15:04"), formatPrizes(contest.PrizeDays)))
+}
+
+func (h Handler) ContestStopCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	contest, winners, err := h.referralService.StopContest(ctx)
+	if err != nil {
+		slog.Error("Error stopping referral contest", "error", err)
+		return
+	}
+	if contest == nil {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "contest_not_active"))
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString(h.translation.GetText(langCode, "contest_stopped"))
+	for _, winner := range winners {
+		text.WriteString(fmt.Sprintf("\n%d. <code>%d</code> — %d (+%d)", winner.Place, winner.ReferrerID, winner.Referrals, winner.Days))
+	}
+	h.sendText(ctx, b, update.Message.Chat.ID, text.String())
+}
+
+func (h Handler) ContestCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	text, err := h.buildContestText(ctx, langCode, 0, false)
+	if err != nil {
+		slog.Error("Error building contest leaderboard", "error", err)
+		return
+	}
+	if text == "" {
+		text = h.translation.GetText(langCode, "contest_not_active")
+	}
+	h.sendText(ctx, b, update.Message.Chat.ID, text)
+}
+
+// buildContestText renders the active contest and its leaderboard. Customers see masked ids and
+// their own position, admins see raw telegram ids. Returns an empty string if no contest is running.
+func (h Handler) buildContestText(ctx context.Context, langCode string, telegramID int64, masked bool) (string, error) {
+	contest, err := h.referralService.ActiveContest(ctx)
+	if err != nil || contest == nil {
+		return "", err
+	}
+
+	leaderboard, err := h.referralService.Leaderboard(ctx, contest, 0)
+	if err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "contest_info"),
+		contest.EndsAt.Format("02.01.2006 15:04"), formatPrizes(contest.PrizeDays)))
+
+	for i, entry := range leaderboard {
+		if i < leaderboardSize {
+			id := strconv.FormatInt(entry.ReferrerID, 10)
+			if masked {
+				id = utils.MaskHalfInt64(entry.ReferrerID)
+			}
+			text.WriteString(fmt.Sprintf("\n%d. <code>%s</code> — %d", i+1, id, entry.Referrals))
+		}
+		if masked && entry.ReferrerID == telegramID {
+			text.WriteString("\n\n" + fmt.Sprintf(h.translation.GetText(langCode, "contest_your_place"), i+1, entry.Referrals))
+		}
+	}
+	return text.String(), nil
+}
+
+func (h Handler) sendText(ctx context.Context, b *bot.Bot, chatID int64, text string) {
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text,
+	})
+	if err != nil {
+		slog.Error("Error sending message", "error", err)
+	}
+}
+
+func parseContestArgs(text string) (int, []int, error) {
+	args := strings.Fields(text)
+	if len(args) != 3 {
+		return 0, nil, errors.New("invalid arguments count")
+	}
+	days, err := strconv.Atoi(args[1])
+	if err != nil || days <= 0 {
+		return 0, nil, errors.New("invalid contest duration")
+	}
+	var prizes []int
+	for _, value := range strings.Split(args[2], ",") {
+		prize, err := strconv.Atoi(value)
+		if err != nil || prize <= 0 {
+			return 0, nil, errors.New("invalid prize")
+		}
+		prizes = append(prizes, prize)
+	}
+	return days, prizes, nil
+}
+
+func formatPrizes(prizes []int) string {
+	parts := make([]string, len(prizes))
+	for i, prize := range prizes {
+		parts[i] = fmt.Sprintf("%d — %d", i+1, prize)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/admin"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/metrics"
+)
+
+// RefundCommandHandler handles "/refund <purchaseId>" after the money was returned in the payment system. Purchase
+// ids are shown in the /user purchase history.
+func (h Handler) RefundCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	args := strings.Fields(update.Message.Text)
+	if len(args) != 2 {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "refund_usage"))
+		return
+	}
+	purchaseID, err := strconv.ParseInt(strings.TrimPrefix(args[1], "#"), 10, 64)
+	if err != nil {
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "refund_usage"))
+		return
+	}
+
+	purchase, customer, err := h.adminService.Refund(ctx, purchaseID, database.ActorAdmin(update.Message.From.ID))
+	switch {
+	case errors.Is(err, admin.ErrPurchaseNotFound):
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "refund_not_found"))
+		return
+	case errors.Is(err, admin.ErrPurchaseNotRefundable):
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "refund_not_paid"))
+		return
+	case err != nil:
+		slog.Error("Error refunding purchase", "error", err)
+		h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "admin_user_action_failed"))
+		return
+	}
+	h.notifier.Refund(purchase, customer)
+	metrics.PurchaseCancelled(string(purchase.InvoiceType))
+	h.usageCache.Invalidate(customer.TelegramID)
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text:      h.translation.GetText(customer.Language, "refund_customer_message"),
+	})
+	if err != nil {
+		slog.Error("Error sending refund message", "error", err)
+	}
+
+	expireAt := "—"
+	if customer.ExpireAt != nil {
+		expireAt = customer.ExpireAt.In(time.Local).Format("02.01.2006 15:04")
+	}
+	h.sendText(ctx, b, update.Message.Chat.ID, fmt.Sprintf(h.translation.GetText(langCode, "refund_done"), purchase.ID, customer.TelegramID, expireAt))
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/report"
+)
+
+// ReportCommandHandler handles "/report [day|week|month]" and sends the summary with a CSV export.
+func (h Handler) ReportCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	args := strings.Fields(update.Message.Text)
+
+	granularity := database.ReportGranularityDay
+	if len(args) > 1 {
+		var ok bool
+		granularity, ok = report.ParseGranularity(args[1])
+		if !ok || len(args) > 2 {
+			h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "report_usage"))
+			return
+		}
+	}
+
+	from, to := report.Range(granularity, time.Now())
+	result, err := h.reportService.Build(ctx, granularity, from, to)
+	if err != nil {
+		slog.Error("Error building report", "error", err)
+		return
+	}
+
+	if err := h.reportService.Send(ctx, update.Message.Chat.ID, langCode, result); err != nil {
+		slog.Error("Error sending report", "error", err)
+	}
+}
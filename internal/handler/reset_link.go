@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/admin"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+// resetLinkKeyboard offers the link reset only to customers with an active subscription and a link to revoke.
+func (h Handler) resetLinkKeyboard(customer *database.Customer, langCode string) [][]models.InlineKeyboardButton {
+	if customer.SubscriptionLink == nil || customer.ExpireAt == nil || customer.ExpireAt.Before(time.Now()) {
+		return nil
+	}
+	return [][]models.InlineKeyboardButton{
+		{{Text: h.translation.GetText(langCode, "reset_link_button"), CallbackData: CallbackResetLink}},
+	}
+}
+
+// ResetLinkCallbackHandler asks for confirmation, the old link stops working on every device.
+func (h Handler) ResetLinkCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      h.translation.GetText(langCode, "reset_link_confirm"),
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{{Text: h.translation.GetText(langCode, "reset_link_confirm_button"), CallbackData: CallbackResetLinkDo}},
+				{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackConnect}},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending reset link confirmation", "error", err)
+	}
+}
+
+// ResetLinkConfirmCallbackHandler revokes the subscription in the panel, stores the new link and shows the
+// connect screen again. Resets are limited to one per LINK_RESET_COOLDOWN_HOURS.
+func (h Handler) ResetLinkConfirmCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	customer, err := h.customerRepository.FindByTelegramId(ctx, update.CallbackQuery.From.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		return
+	}
+
+	claimed, err := h.customerRepository.ClaimLinkReset(ctx, customer.ID, config.LinkResetCooldown())
+	if err != nil {
+		slog.Error("Error claiming link reset", "error", err)
+		return
+	}
+	if !claimed {
+		h.answerAlert(ctx, b, update, fmt.Sprintf(h.translation.GetText(langCode, "reset_link_cooldown"), int(config.LinkResetCooldown().Hours())))
+		return
+	}
+
+	if err := h.adminService.RegenerateLink(ctx, customer); err != nil {
+		if errors.Is(err, admin.ErrPanelUserNotFound) {
+			slog.Warn("Panel user not found for link reset", "customer_id", customer.ID)
+		} else {
+			slog.Error("Error resetting subscription link", "error", err)
+		}
+		if err := h.customerRepository.ReleaseLinkReset(ctx, customer.ID); err != nil {
+			slog.Error("Error releasing link reset", "error", err)
+		}
+		h.answerAlert(ctx, b, update, h.translation.GetText(langCode, "reset_link_failed"))
+		return
+	}
+	h.usageCache.Invalidate(customer.TelegramID)
+
+	h.editConnectScreen(ctx, b, update, customer, langCode, h.translation.GetText(langCode, "reset_link_done"))
+}
+
+func (h Handler) answerAlert(ctx context.Context, b *bot.Bot, update *models.Update, text string) {
+	_, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		Text:            text,
+		ShowAlert:       true,
+	})
+	if err != nil {
+		slog.Error("Error answering callback query", "error", err)
+	}
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// ServerStatusCallbackHandler shows the nodes of all panels with their state, online users, load and uptime.
+// Disabled nodes are hidden from customers.
+func (h Handler) ServerStatusCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	nodes, err := h.nodeStatus.Get(ctx)
+	if err != nil {
+		slog.Error("Error getting server status", "error", err)
+		h.answerAlert(ctx, b, update, h.translation.GetText(langCode, "server_status_error"))
+		return
+	}
+
+	var keyboard [][]models.InlineKeyboardButton
+	if config.ServerStatusURL() != "" {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{
+			{Text: h.translation.GetText(langCode, "server_status_details_button"), URL: config.ServerStatusURL()},
+		})
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{
+		{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackStart},
+	})
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      callback.Chat.ID,
+		MessageID:   callback.ID,
+		ParseMode:   models.ParseModeHTML,
+		Text:        h.buildServerStatusText(nodes, langCode),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+	if err != nil {
+		slog.Error("Error sending server status message", "error", err)
+	}
+}
+
+func (h Handler) buildServerStatusText(nodes []remnawave.NodeStatus, langCode string) string {
+	var lines []string
+	for _, node := range nodes {
+		if node.Disabled {
+			continue
+		}
+		name := strings.TrimSpace(utils.CountryFlag(node.CountryCode) + " " + html.EscapeString(node.Name))
+		if !node.Online {
+			lines = append(lines, fmt.Sprintf(h.translation.GetText(langCode, "server_status_node_offline"), name))
+			continue
+		}
+		load := "—"
+		if node.Load() >= 0 {
+			load = fmt.Sprintf("%d%%", node.Load())
+		}
+		lines = append(lines, fmt.Sprintf(h.translation.GetText(langCode, "server_status_node_online"),
+			name, node.UsersOnline, load, utils.FormatDuration(node.Uptime)))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, h.translation.GetText(langCode, "server_status_empty"))
+	}
+	return fmt.Sprintf(h.translation.GetText(langCode, "server_status_text"),
+		strings.Join(lines, "\n\n"), time.Now().In(time.Local).Format("15:04"))
+}
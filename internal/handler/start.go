@@ -2,6 +2,7 @@ package handler
 
 import (
 	"context"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
@@ -34,6 +35,7 @@ func (h Handler) StartCommandHandler(ctx context.Context, b *bot.Bot, update *mo
 			slog.Error("error creating customer", err)
 			return
 		}
+		h.notifier.NewCustomer(existingCustomer.TelegramID, update.Message.From.Username)
 
 		if strings.Contains(update.Message.Text, "ref_") {
 			arg := strings.Split(update.Message.Text, " ")[1]
@@ -57,7 +59,9 @@ func (h Handler) StartCommandHandler(ctx context.Context, b *bot.Bot, update *mo
 		}
 	} else {
 		updates := map[string]interface{}{
-			"language": langCode,
+			"language":       langCode,
+			"username":       update.Message.From.Username,
+			"bot_blocked_at": nil,
 		}
 
 		err = h.customerRepository.UpdateFields(ctx, existingCustomer.ID, updates)
@@ -154,7 +158,7 @@ func (h Handler) resolveConnectButton(lang string) []models.InlineKeyboardButton
 func (h Handler) buildStartKeyboard(existingCustomer *database.Customer, langCode string) [][]models.InlineKeyboardButton {
 	var inlineKeyboard [][]models.InlineKeyboardButton
 
-	if existingCustomer.SubscriptionLink == nil && config.TrialDays() > 0 {
+	if trialAvailable(existingCustomer) {
 		inlineKeyboard = append(inlineKeyboard, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "trial_button"), CallbackData: CallbackTrial}})
 	}
 
@@ -168,7 +172,9 @@ func (h Handler) buildStartKeyboard(existingCustomer *database.Customer, langCod
 		inlineKeyboard = append(inlineKeyboard, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "referral_button"), CallbackData: CallbackReferral}})
 	}
 
-	if config.ServerStatusURL() != "" {
+	if config.ServerStatusEnabled() {
+		inlineKeyboard = append(inlineKeyboard, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "server_status_button"), CallbackData: CallbackServerStatus}})
+	} else if config.ServerStatusURL() != "" {
 		inlineKeyboard = append(inlineKeyboard, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "server_status_button"), URL: config.ServerStatusURL()}})
 	}
 
@@ -180,7 +186,11 @@ func (h Handler) buildStartKeyboard(existingCustomer *database.Customer, langCod
 		inlineKeyboard = append(inlineKeyboard, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "feedback_button"), URL: config.FeedbackURL()}})
 	}
 
-	if config.ChannelURL() != "" {
+	if config.ChannelBonusDays() > 0 && existingCustomer.SubscriptionLink != nil && existingCustomer.ChannelBonusAt == nil {
+		inlineKeyboard = append(inlineKeyboard, []models.InlineKeyboardButton{
+			{Text: fmt.Sprintf(h.translation.GetText(langCode, "channel_bonus_button"), config.ChannelBonusDays()), CallbackData: CallbackChannelBonus},
+		})
+	} else if config.ChannelURL() != "" {
 		inlineKeyboard = append(inlineKeyboard, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "channel_button"), URL: config.ChannelURL()}})
 	}
 
@@ -2,19 +2,78 @@ package handler
 
 import (
 	"context"
+	"errors"
+	"strings"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"log/slog"
+	"remnawave-tg-shop-bot/internal/sync"
 )
 
+// SyncUsersCommandHandler handles "/sync" that applies the sync right away and "/sync dry" that only shows the diff.
 func (h Handler) SyncUsersCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	h.syncService.Sync()
+	langCode := update.Message.From.LanguageCode
+	args := strings.Fields(update.Message.Text)
+	if len(args) > 1 && args[1] == "dry" {
+		plan, err := h.syncService.Plan(ctx)
+		if err != nil {
+			slog.Error("Error planning sync", "error", err)
+			h.sendText(ctx, b, update.Message.Chat.ID, h.translation.GetText(langCode, "sync_failed"))
+			return
+		}
+		_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:    update.Message.Chat.ID,
+			ParseMode: models.ParseModeHTML,
+			Text:      h.syncService.Diff(langCode, plan),
+			ReplyMarkup: models.InlineKeyboardMarkup{
+				InlineKeyboard: h.syncApplyKeyboard(langCode),
+			},
+		})
+		if err != nil {
+			slog.Error("Error sending sync diff", "error", err)
+		}
+		return
+	}
+
+	text := "Users synced"
+	if err := h.syncService.Sync(); errors.Is(err, sync.ErrSyncRunning) {
+		text = h.translation.GetText(langCode, "sync_running")
+	}
 	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: update.Message.Chat.ID,
-		Text:   "Users synced",
+		Text:   text,
 	})
 	if err != nil {
 		slog.Error("Error sending sync message", err)
 	}
 }
+
+// AdminSyncCallbackHandler shows the dry-run diff, the sync is applied with the button below it.
+func (h Handler) AdminSyncCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	plan, err := h.syncService.Plan(ctx)
+	if err != nil {
+		slog.Error("Error planning sync", "error", err)
+		h.editAdminScreen(ctx, b, update, h.translation.GetText(langCode, "sync_failed"), h.adminBackKeyboard(langCode))
+		return
+	}
+	h.editAdminScreen(ctx, b, update, h.syncService.Diff(langCode, plan), h.syncApplyKeyboard(langCode))
+}
+
+// AdminSyncApplyCallbackHandler runs the sync again from a fresh panel snapshot, so a stale diff is never applied.
+func (h Handler) AdminSyncApplyCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	text := h.translation.GetText(langCode, "admin_sync_done")
+	if err := h.syncService.Sync(); errors.Is(err, sync.ErrSyncRunning) {
+		text = h.translation.GetText(langCode, "sync_running")
+	}
+	h.editAdminScreen(ctx, b, update, text, h.adminBackKeyboard(langCode))
+}
+
+func (h Handler) syncApplyKeyboard(langCode string) [][]models.InlineKeyboardButton {
+	return [][]models.InlineKeyboardButton{
+		{{Text: h.translation.GetText(langCode, "sync_apply_button"), CallbackData: CallbackAdminSyncApply}},
+		{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackAdmin}},
+	}
+}
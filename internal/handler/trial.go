@@ -2,12 +2,21 @@ package handler
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"log/slog"
 
 	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
 	"remnawave-tg-shop-bot/utils"
 )
 
@@ -24,11 +33,14 @@ func (h Handler) TrialCallbackHandler(ctx context.Context, b *bot.Bot, update *m
 		slog.Error("customer not exist", "telegramId", utils.MaskHalfInt64(update.CallbackQuery.From.ID), "error", err)
 		return
 	}
-	if c.SubscriptionLink != nil {
+	if !trialAvailable(c) {
 		return
 	}
 	callback := update.CallbackQuery.Message.Message
 	langCode := update.CallbackQuery.From.LanguageCode
+	if !h.checkTrialGates(ctx, b, update, c) {
+		return
+	}
 	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
 		ChatID:    callback.Chat.ID,
 		MessageID: callback.ID,
@@ -57,17 +69,29 @@ func (h Handler) ActivateTrialCallbackHandler(ctx context.Context, b *bot.Bot, u
 		slog.Error("customer not exist", "telegramId", utils.MaskHalfInt64(update.CallbackQuery.From.ID), "error", err)
 		return
 	}
-	if c.SubscriptionLink != nil {
+	if !trialAvailable(c) {
+		return
+	}
+	if !h.checkTrialGates(ctx, b, update, c) {
 		return
 	}
 	callback := update.CallbackQuery.Message.Message
 	ctxWithUsername := context.WithValue(ctx, "username", update.CallbackQuery.From.Username)
-	_, err = h.paymentService.ActivateTrial(ctxWithUsername, update.CallbackQuery.From.ID)
 	langCode := update.CallbackQuery.From.LanguageCode
+	_, err = h.paymentService.ActivateTrial(ctxWithUsername, update.CallbackQuery.From.ID)
+	if errors.Is(err, payment.ErrTrialUsed) {
+		h.answerAlert(ctx, b, update, h.translation.GetText(langCode, "trial_already_used"))
+		return
+	}
+	if err != nil {
+		slog.Error("Error activating trial", "error", err)
+		h.answerAlert(ctx, b, update, h.translation.GetText(langCode, "trial_activation_failed"))
+		return
+	}
 	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
 		ChatID:      callback.Chat.ID,
 		MessageID:   callback.ID,
-		Text:        h.translation.GetText(langCode, "trial_activated"),
+		Text:        fmt.Sprintf(h.translation.GetText(langCode, "trial_welcome"), config.TrialDays()),
 		ParseMode:   models.ParseModeHTML,
 		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: h.createConnectKeyboard(langCode)},
 	})
@@ -85,3 +109,154 @@ func (h Handler) createConnectKeyboard(lang string) [][]models.InlineKeyboardBut
 	})
 	return inlineCustomerKeyboard
 }
+
+// trialAvailable tells whether the customer may take the trial, see database.Customer.CanTakeTrial.
+func trialAvailable(c *database.Customer) bool {
+	return config.TrialDays() > 0 && c.CanTakeTrial(time.Now())
+}
+
+// trialRefusal returns the message explaining why the customer may not take the trial yet, empty when the
+// anti-abuse checks pass.
+func (h Handler) trialRefusal(ctx context.Context, c *database.Customer) (string, error) {
+	if age := config.TrialMinAccountAge(); age > 0 && time.Since(utils.EstimateAccountCreated(c.TelegramID)) < age {
+		return "trial_account_too_new", nil
+	}
+	if config.TrialRequireChannel() {
+		member, err := h.channelService.IsMember(ctx, c.TelegramID)
+		if err != nil {
+			return "", err
+		}
+		if !member {
+			return "trial_channel_required", nil
+		}
+	}
+	if config.TrialRequirePhone() {
+		if c.PhoneHash == nil {
+			return "trial_phone_required", nil
+		}
+		used, err := h.customerRepository.PhoneTrialUsed(ctx, *c.PhoneHash, c.ID)
+		if err != nil {
+			return "", err
+		}
+		if used {
+			return "trial_phone_used", nil
+		}
+	}
+	return "", nil
+}
+
+// checkTrialGates answers the callback and reports false when the customer does not pass the anti-abuse checks.
+// Customers outside the channel get the link with a button to check again, customers without a phone number get
+// the button to share it.
+func (h Handler) checkTrialGates(ctx context.Context, b *bot.Bot, update *models.Update, c *database.Customer) bool {
+	langCode := update.CallbackQuery.From.LanguageCode
+	refusal, err := h.trialRefusal(ctx, c)
+	if err != nil {
+		slog.Error("Error checking trial", "error", err)
+		return false
+	}
+	if refusal == "" {
+		return true
+	}
+	if refusal == "trial_channel_required" {
+		if update.CallbackQuery.Data == CallbackTrialChannel {
+			h.answerAlert(ctx, b, update, h.translation.GetText(langCode, "channel_not_joined"))
+			return false
+		}
+		h.showChannelJoin(ctx, b, update, h.translation.GetText(langCode, refusal), CallbackTrialChannel)
+		return false
+	}
+	if refusal != "trial_phone_required" {
+		h.answerAlert(ctx, b, update, h.translation.GetText(langCode, refusal))
+		return false
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    update.CallbackQuery.From.ID,
+		Text:      h.translation.GetText(langCode, refusal),
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.ReplyKeyboardMarkup{
+			Keyboard: [][]models.KeyboardButton{
+				{{Text: h.translation.GetText(langCode, "share_phone_button"), RequestContact: true}},
+			},
+			ResizeKeyboard:  true,
+			OneTimeKeyboard: true,
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending phone request", "error", err)
+	}
+	_, err = b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: update.CallbackQuery.ID})
+	if err != nil {
+		slog.Error("Error answering callback query", "error", err)
+	}
+	return false
+}
+
+// ContactHandler stores the phone number the customer shared for the trial check and shows the trial again. Only
+// the customer's own contact is accepted, and just a hash of the number is kept.
+func (h Handler) ContactHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if !config.TrialRequirePhone() {
+		return
+	}
+	contact := update.Message.Contact
+	langCode := update.Message.From.LanguageCode
+	c, err := h.customerRepository.FindByTelegramId(ctx, update.Message.From.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if c == nil {
+		return
+	}
+
+	text := "trial_phone_not_own"
+	if contact.UserID == update.Message.From.ID {
+		if err := h.customerRepository.SetPhoneHash(ctx, c.ID, phoneHash(contact.PhoneNumber)); err != nil {
+			slog.Error("Error saving phone", "error", err)
+			return
+		}
+		text = "trial_phone_saved"
+	}
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      update.Message.Chat.ID,
+		Text:        h.translation.GetText(langCode, text),
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: models.ReplyKeyboardRemove{RemoveKeyboard: true},
+	})
+	if err != nil {
+		slog.Error("Error sending phone reply", "error", err)
+		return
+	}
+	if text != "trial_phone_saved" || !trialAvailable(c) {
+		return
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    update.Message.Chat.ID,
+		Text:      h.translation.GetText(langCode, "trial_text"),
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: h.translation.GetText(langCode, "activate_trial_button"), CallbackData: CallbackActivateTrial}},
+			{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackStart}},
+		}},
+	})
+	if err != nil {
+		slog.Error("Error sending /trial message", "error", err)
+	}
+}
+
+// phoneHash returns the HMAC-SHA256 of the number keyed with PHONE_HASH_SECRET. Phone numbers are few enough to
+// reverse a plain hash by trying them all; without the key the stored hashes give nothing away. The number is
+// normalized to its digits first, so "+7 900 ..." and "7900..." match.
+func phoneHash(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	mac := hmac.New(sha256.New, []byte(config.PhoneHashSecret()))
+	mac.Write([]byte(digits))
+	return hex.EncodeToString(mac.Sum(nil))
+}
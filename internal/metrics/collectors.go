@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+var (
+	telegramUpdates = NewCounterVec("bot_telegram_updates_total",
+		"Telegram updates processed per handler.", "handler")
+	handlerDuration = NewHistogramVec("bot_telegram_handler_duration_seconds",
+		"Time spent in Telegram update handlers.", DefaultBuckets, "handler")
+
+	purchases = NewCounterVec("bot_purchases_total",
+		"Purchases per invoice type and status: created, paid or cancelled.", "invoice_type", "status")
+	revenue = NewCounterVec("bot_revenue_total",
+		"Sum of paid purchases per invoice type and currency.", "invoice_type", "currency")
+
+	remnawaveDuration = NewHistogramVec("bot_remnawave_request_duration_seconds",
+		"Remnawave API call latency per operation.", DefaultBuckets, "operation")
+	remnawaveErrors = NewCounterVec("bot_remnawave_errors_total",
+		"Failed Remnawave API calls per operation.", "operation")
+
+	paymentProviderDuration = NewHistogramVec("bot_payment_provider_request_duration_seconds",
+		"Payment provider API call latency per operation.", DefaultBuckets, "provider", "operation")
+	paymentProviderErrors = NewCounterVec("bot_payment_provider_errors_total",
+		"Failed payment provider API calls per operation.", "provider", "operation")
+
+	cronDuration = NewHistogramVec("bot_cron_job_duration_seconds",
+		"Duration of scheduled jobs such as invoice pollers.", []float64{.1, .5, 1, 5, 10, 30, 60, 300}, "job")
+	cronErrors = NewCounterVec("bot_cron_job_errors_total",
+		"Scheduled job runs that ended with an error.", "job")
+
+	notifications = NewCounterVec("bot_notifications_total",
+		"Notifications sent to customers per type and result.", "type", "result")
+
+	syncRuns = NewCounterVec("bot_sync_runs_total",
+		"Synchronization runs with the panel per result.", "result")
+	syncCustomers = NewCounterVec("bot_sync_customers_total",
+		"Customers created or updated by synchronization.", "action")
+)
+
+// InstrumentHandler counts updates and measures the duration of a Telegram handler. The label is the name of
+// the handler method, e.g. "StartCommandHandler".
+func InstrumentHandler(next bot.HandlerFunc) bot.HandlerFunc {
+	name := runtime.FuncForPC(reflect.ValueOf(next).Pointer()).Name()
+	name = strings.TrimSuffix(name[strings.LastIndex(name, ".")+1:], "-fm")
+
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		start := time.Now()
+		telegramUpdates.Inc(name)
+		next(ctx, b, update)
+		handlerDuration.Observe(time.Since(start).Seconds(), name)
+	}
+}
+
+func PurchaseCreated(invoiceType string) {
+	purchases.Inc(invoiceType, "created")
+}
+
+func PurchasePaid(invoiceType, currency string, amount float64) {
+	purchases.Inc(invoiceType, "paid")
+	revenue.Add(amount, invoiceType, currency)
+}
+
+func PurchaseCancelled(invoiceType string) {
+	purchases.Inc(invoiceType, "cancelled")
+}
+
+// ObserveRemnawave records a Remnawave call, use as `defer metrics.ObserveRemnawave("op", time.Now(), &err)`.
+func ObserveRemnawave(operation string, start time.Time, err *error) {
+	remnawaveDuration.Observe(time.Since(start).Seconds(), operation)
+	if *err != nil {
+		remnawaveErrors.Inc(operation)
+	}
+}
+
+// ObservePaymentProvider records a payment provider call the same way as ObserveRemnawave.
+func ObservePaymentProvider(provider, operation string, start time.Time, err *error) {
+	paymentProviderDuration.Observe(time.Since(start).Seconds(), provider, operation)
+	if *err != nil {
+		paymentProviderErrors.Inc(provider, operation)
+	}
+}
+
+// TrackJob wraps a cron job and records its duration and failed runs.
+func TrackJob(job string, f func() error) func() {
+	return func() {
+		start := time.Now()
+		err := f()
+		cronDuration.Observe(time.Since(start).Seconds(), job)
+		if err != nil {
+			cronErrors.Inc(job)
+		}
+	}
+}
+
+func NotificationSent(notificationType string, err error) {
+	if err != nil {
+		notifications.Inc(notificationType, "failed")
+		return
+	}
+	notifications.Inc(notificationType, "sent")
+}
+
+func SyncSucceeded(created, updated int) {
+	syncRuns.Inc("success")
+	syncCustomers.Add(float64(created), "created")
+	syncCustomers.Add(float64(updated), "updated")
+}
+
+func SyncFailed() {
+	syncRuns.Inc("failure")
+}
@@ -0,0 +1,61 @@
+package notification
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"remnawave-tg-shop-bot/internal/notifier"
+	"remnawave-tg-shop-bot/internal/remnawave"
+)
+
+// NodeMonitor polls the panel nodes and tells the admins when a node goes offline and when it is back. Disabled
+// nodes are not watched, and the first check only remembers the state so that a restart does not repeat alerts.
+type NodeMonitor struct {
+	nodes    *remnawave.NodeStatusCache
+	notifier *notifier.Notifier
+
+	mu           sync.Mutex
+	initialized  bool
+	offlineSince map[uuid.UUID]time.Time
+}
+
+func NewNodeMonitor(nodes *remnawave.NodeStatusCache, notifier *notifier.Notifier) *NodeMonitor {
+	return &NodeMonitor{nodes: nodes, notifier: notifier, offlineSince: make(map[uuid.UUID]time.Time)}
+}
+
+func (m *NodeMonitor) Check(ctx context.Context) error {
+	nodes, err := m.nodes.Refresh(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, node := range nodes {
+		if node.Disabled {
+			delete(m.offlineSince, node.UUID)
+			continue
+		}
+		since, wasOffline := m.offlineSince[node.UUID]
+		switch {
+		case !node.Online && !wasOffline:
+			since = now
+			if node.StatusChangedAt != nil && node.StatusChangedAt.Before(now) {
+				since = *node.StatusChangedAt
+			}
+			m.offlineSince[node.UUID] = since
+			if m.initialized {
+				m.notifier.NodeOffline(node)
+			}
+		case node.Online && wasOffline:
+			delete(m.offlineSince, node.UUID)
+			m.notifier.NodeOnline(node, now.Sub(since))
+		}
+	}
+	m.initialized = true
+	return nil
+}
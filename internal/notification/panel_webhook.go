@@ -0,0 +1,271 @@
+package notification
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/google/uuid"
+	"io"
+	"log/slog"
+	"net/http"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/handler"
+	"remnawave-tg-shop-bot/internal/metrics"
+	"remnawave-tg-shop-bot/internal/translation"
+	"remnawave-tg-shop-bot/utils"
+	"time"
+)
+
+// Remnawave webhook events handled by the bot, other events are acknowledged and ignored.
+const (
+	PanelEventUserModified         = "user.modified"
+	PanelEventUserRevoked          = "user.revoked"
+	PanelEventUserExpired          = "user.expired"
+	PanelEventUserLimited          = "user.limited"
+	PanelEventUserDisabled         = "user.disabled"
+	PanelEventUserEnabled          = "user.enabled"
+	PanelEventUserFirstConnected   = "user.first_connected"
+	PanelEventUserTrafficThreshold = "user.bandwidth_usage_threshold_reached"
+)
+
+// panelWebhookMaxAge is how far the signed event timestamp may be from the bot clock. A captured request can not be
+// replayed later, e.g. to roll the expiration date back, because the timestamp is covered by the signature.
+const panelWebhookMaxAge = 5 * time.Minute
+
+type PanelWebhookEvent struct {
+	Event     string           `json:"event"`
+	Timestamp time.Time        `json:"timestamp"`
+	Data      PanelWebhookUser `json:"data"`
+	Meta      struct {
+		ThresholdPercent int `json:"thresholdPercent"`
+	} `json:"meta"`
+}
+
+type PanelWebhookUser struct {
+	UUID               string     `json:"uuid"`
+	Username           string     `json:"username"`
+	Status             string     `json:"status"`
+	TelegramID         *int64     `json:"telegramId"`
+	ExpireAt           *time.Time `json:"expireAt"`
+	SubscriptionURL    string     `json:"subscriptionUrl"`
+	UsedTrafficBytes   int64      `json:"usedTrafficBytes"`
+	TrafficLimitBytes  int64      `json:"trafficLimitBytes"`
+	LastTrafficResetAt *time.Time `json:"lastTrafficResetAt"`
+}
+
+// fresh tells whether the event was sent within panelWebhookMaxAge of now, in either direction to allow for clock skew.
+// Events without a timestamp are not fresh.
+func (e PanelWebhookEvent) fresh(now time.Time) bool {
+	if e.Timestamp.IsZero() {
+		return false
+	}
+	age := now.Sub(e.Timestamp)
+	return age <= panelWebhookMaxAge && age >= -panelWebhookMaxAge
+}
+
+// trafficPeriod identifies the traffic period of the user for notification_log: the last traffic reset, or the
+// subscription period when the traffic was never reset. ok is false when the panel sent neither.
+func (u PanelWebhookUser) trafficPeriod() (time.Time, bool) {
+	if u.LastTrafficResetAt != nil {
+		return *u.LastTrafficResetAt, true
+	}
+	if u.ExpireAt != nil {
+		return *u.ExpireAt, true
+	}
+	return time.Time{}, false
+}
+
+// PanelWebhook receives signed Remnawave events, keeps the customer row in step with the panel and tells the
+// customer what happened to their subscription.
+type PanelWebhook struct {
+	customerRepository        *database.CustomerRepository
+	notificationLogRepository *database.NotificationLogRepository
+	eventRepository           *database.SubscriptionEventRepository
+	telegramBot               *bot.Bot
+	tm                        *translation.Manager
+}
+
+func NewPanelWebhook(customerRepository *database.CustomerRepository, notificationLogRepository *database.NotificationLogRepository, eventRepository *database.SubscriptionEventRepository, telegramBot *bot.Bot, tm *translation.Manager) *PanelWebhook {
+	return &PanelWebhook{customerRepository: customerRepository, notificationLogRepository: notificationLogRepository, eventRepository: eventRepository, telegramBot: telegramBot, tm: tm}
+}
+
+func (p *PanelWebhook) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			slog.Error("panel webhook: read body error", "error", err)
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		signature := r.Header.Get("X-Remnawave-Signature")
+		if signature == "" {
+			http.Error(w, "missing signature", http.StatusUnauthorized)
+			return
+		}
+
+		mac := hmac.New(sha256.New, []byte(config.RemnawaveWebhookSecret()))
+		mac.Write(body)
+		expected := hex.EncodeToString(mac.Sum(nil))
+		if !hmac.Equal([]byte(expected), []byte(signature)) {
+			slog.Warn("panel webhook: bad signature")
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var event PanelWebhookEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			slog.Error("panel webhook: unmarshal error", "error", err)
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+
+		if !event.fresh(time.Now()) {
+			slog.Warn("panel webhook: stale event", "event", event.Event, "timestamp", event.Timestamp)
+			http.Error(w, "stale event", http.StatusBadRequest)
+			return
+		}
+
+		if err := p.handle(ctx, event); err != nil {
+			slog.Error("panel webhook: handling error", "event", event.Event, "error", err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func (p *PanelWebhook) handle(ctx context.Context, event PanelWebhookEvent) error {
+	if event.Data.TelegramID == nil {
+		return nil
+	}
+	customer, err := p.customerRepository.FindByTelegramId(ctx, *event.Data.TelegramID)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		slog.Warn("panel webhook: customer not found", "event", event.Event, "telegram_id", utils.MaskHalfInt64(*event.Data.TelegramID))
+		return nil
+	}
+	if customer.PanelUUID != nil && customer.PanelUUID.String() != event.Data.UUID {
+		// An old user of the customer, e.g. in the panel of the location the customer left.
+		slog.Info("panel webhook: event for another panel user", "event", event.Event, "telegram_id", utils.MaskHalfInt64(customer.TelegramID))
+		return nil
+	}
+
+	switch event.Event {
+	case PanelEventUserModified, PanelEventUserRevoked, PanelEventUserEnabled:
+		if err := p.updateCustomer(ctx, customer, event.Data); err != nil {
+			return err
+		}
+		if event.Event == PanelEventUserEnabled {
+			p.send(ctx, customer, event.Event, p.tm.GetText(customer.Language, "panel_user_enabled"), false)
+		}
+	case PanelEventUserExpired:
+		if err := p.updateCustomer(ctx, customer, event.Data); err != nil {
+			return err
+		}
+		if customer.IsTrial {
+			// TrialService sends the trial_ended message instead.
+			return nil
+		}
+		if event.Data.ExpireAt != nil {
+			// The scheduled expiration reminders may have sent it already.
+			claimed, err := p.notificationLogRepository.Claim(ctx, customer.ID, NotificationKindExpired, *event.Data.ExpireAt)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				return nil
+			}
+		}
+		p.send(ctx, customer, event.Event, p.tm.GetText(customer.Language, "panel_user_expired"), true)
+	case PanelEventUserLimited:
+		p.send(ctx, customer, event.Event, fmt.Sprintf(p.tm.GetText(customer.Language, "panel_user_traffic_used"), 100), true)
+	case PanelEventUserTrafficThreshold:
+		percent := event.Meta.ThresholdPercent
+		if percent == 0 && event.Data.TrafficLimitBytes > 0 {
+			percent = int(event.Data.UsedTrafficBytes * 100 / event.Data.TrafficLimitBytes)
+		}
+		if period, ok := event.Data.trafficPeriod(); ok {
+			// The panel repeats the event, e.g. after a restart. It is sent once per threshold and traffic period.
+			claimed, err := p.notificationLogRepository.Claim(ctx, customer.ID, fmt.Sprintf("traffic_threshold_%d", percent), period)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				return nil
+			}
+		}
+		p.send(ctx, customer, event.Event, fmt.Sprintf(p.tm.GetText(customer.Language, "panel_user_traffic_used"), percent), true)
+	case PanelEventUserDisabled:
+		if customer.IsBanned {
+			return nil
+		}
+		p.send(ctx, customer, event.Event, p.tm.GetText(customer.Language, "panel_user_disabled"), false)
+	case PanelEventUserFirstConnected:
+		p.send(ctx, customer, event.Event, p.tm.GetText(customer.Language, "panel_user_first_connected"), false)
+	}
+	return nil
+}
+
+// updateCustomer stores the panel expiration date, subscription link and user uuid when they differ from the
+// customer row. A changed expiration date is recorded in the subscription audit log.
+func (p *PanelWebhook) updateCustomer(ctx context.Context, customer *database.Customer, user PanelWebhookUser) error {
+	updates := make(map[string]interface{})
+	if user.ExpireAt != nil && (customer.ExpireAt == nil || !customer.ExpireAt.Equal(*user.ExpireAt)) {
+		updates["expire_at"] = *user.ExpireAt
+	}
+	if user.SubscriptionURL != "" && (customer.SubscriptionLink == nil || *customer.SubscriptionLink != user.SubscriptionURL) {
+		updates["subscription_link"] = user.SubscriptionURL
+	}
+	if panelUUID, err := uuid.Parse(user.UUID); err == nil && (customer.PanelUUID == nil || *customer.PanelUUID != panelUUID) {
+		updates["panel_uuid"] = panelUUID
+	}
+	if err := p.customerRepository.UpdateFields(ctx, customer.ID, updates); err != nil {
+		return err
+	}
+
+	if _, ok := updates["expire_at"]; ok {
+		trafficLimit := user.TrafficLimitBytes
+		p.eventRepository.Record(ctx, database.SubscriptionEvent{
+			CustomerID:       customer.ID,
+			TelegramID:       customer.TelegramID,
+			Source:           database.SubscriptionEventPanelWebhook,
+			Actor:            database.ActorSystem,
+			PreviousExpireAt: customer.ExpireAt,
+			NewExpireAt:      user.ExpireAt,
+			TrafficLimit:     &trafficLimit,
+		})
+	}
+	return nil
+}
+
+func (p *PanelWebhook) send(ctx context.Context, customer *database.Customer, event string, text string, withBuyButton bool) {
+	params := &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+	}
+	if withBuyButton {
+		params.ReplyMarkup = models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{{Text: p.tm.GetText(customer.Language, "renew_subscription_button"), CallbackData: handler.CallbackBuy}},
+			},
+		}
+	}
+	_, err := p.telegramBot.SendMessage(ctx, params)
+	metrics.NotificationSent(event, err)
+	if err != nil {
+		slog.Error("panel webhook: error sending notification", "event", event, "customer_id", utils.MaskHalfInt64(customer.ID), "error", err)
+	}
+}
@@ -0,0 +1,41 @@
+package notification
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrafficPeriod(t *testing.T) {
+	resetAt := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	expireAt := time.Date(2025, 7, 10, 12, 0, 0, 0, time.UTC)
+
+	if period, ok := (PanelWebhookUser{LastTrafficResetAt: &resetAt, ExpireAt: &expireAt}).trafficPeriod(); !ok || !period.Equal(resetAt) {
+		t.Errorf("period = %v, %v, want the last reset %v", period, ok, resetAt)
+	}
+	if period, ok := (PanelWebhookUser{ExpireAt: &expireAt}).trafficPeriod(); !ok || !period.Equal(expireAt) {
+		t.Errorf("period = %v, %v, want the expiration %v", period, ok, expireAt)
+	}
+	if _, ok := (PanelWebhookUser{}).trafficPeriod(); ok {
+		t.Error("period without dates")
+	}
+}
+
+func TestPanelWebhookEventFresh(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		timestamp time.Time
+		fresh     bool
+	}{
+		{"just sent", now.Add(-time.Second), true},
+		{"clock skew", now.Add(time.Minute), true},
+		{"replayed an hour later", now.Add(-time.Hour), false},
+		{"from the future", now.Add(time.Hour), false},
+		{"without timestamp", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		if fresh := (PanelWebhookEvent{Timestamp: tt.timestamp}).fresh(now); fresh != tt.fresh {
+			t.Errorf("%s: fresh = %v, want %v", tt.name, fresh, tt.fresh)
+		}
+	}
+}
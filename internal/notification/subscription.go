@@ -2,35 +2,56 @@ package notification
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
 	"remnawave-tg-shop-bot/internal/database"
 	"remnawave-tg-shop-bot/internal/handler"
+	"remnawave-tg-shop-bot/internal/metrics"
 	"remnawave-tg-shop-bot/internal/payment"
 	"remnawave-tg-shop-bot/internal/translation"
 	"time"
 )
 
+// NotificationKindExpired is the reminder sent when the subscription has expired, by the scheduled job or by the
+// panel webhook, whichever comes first.
+const NotificationKindExpired = "expired"
+
+const (
+	tributeRenewalKind    = "tribute_renewal"
+	tributeRenewalOffset  = 24 * time.Hour
+	expiredReminderWindow = 24 * time.Hour
+)
+
 type SubscriptionService struct {
-	customerRepository *database.CustomerRepository
-	purchaseRepository *database.PurchaseRepository
-	paymentService     *payment.PaymentService
-	telegramBot        *bot.Bot
-	tm                 *translation.Manager
+	customerRepository        *database.CustomerRepository
+	purchaseRepository        *database.PurchaseRepository
+	notificationLogRepository *database.NotificationLogRepository
+	paymentService            *payment.PaymentService
+	telegramBot               *bot.Bot
+	tm                        *translation.Manager
 }
 
 func NewSubscriptionService(customerRepository *database.CustomerRepository,
 	purchaseRepository *database.PurchaseRepository,
+	notificationLogRepository *database.NotificationLogRepository,
 	paymentService *payment.PaymentService,
 	telegramBot *bot.Bot,
 	tm *translation.Manager) *SubscriptionService {
-	return &SubscriptionService{customerRepository: customerRepository, purchaseRepository: purchaseRepository, paymentService: paymentService, telegramBot: telegramBot, tm: tm}
+	return &SubscriptionService{customerRepository: customerRepository, purchaseRepository: purchaseRepository, notificationLogRepository: notificationLogRepository, paymentService: paymentService, telegramBot: telegramBot, tm: tm}
 }
+
+// ProcessSubscriptionExpiration sends the reminder of the offset that is due for every customer whose subscription
+// expires soon or has just expired, and renews Tribute subscriptions a day before expiration. Each reminder and
+// renewal is recorded in notification_log, so it happens once per subscription period however often the job runs.
+// Trial customers get the trial messages of TrialService instead.
 func (s *SubscriptionService) ProcessSubscriptionExpiration() error {
 	ctx := context.Background()
-	customers, err := s.getCustomersWithExpiringSubscriptions()
+	now := time.Now()
+	customers, err := s.customerRepository.FindByExpirationRange(ctx, now.Add(-expiredReminderWindow), now.Add(s.lookahead()))
 	if err != nil {
 		slog.Error("Failed to get customers with expiring subscriptions", "error", err)
 		return err
@@ -40,7 +61,6 @@ func (s *SubscriptionService) ProcessSubscriptionExpiration() error {
 	if len(*customers) == 0 {
 		return nil
 	}
-	now := time.Now()
 
 	customersIds := make([]int64, len(*customers))
 	for i, customer := range *customers {
@@ -59,79 +79,144 @@ func (s *SubscriptionService) ProcessSubscriptionExpiration() error {
 		customerIdTributes[p.CustomerID] = p
 	}
 
-	tributesProcessed := make(map[int64]bool, len(*nonCancelledTributes))
-
+	var tributesProcessed, sent int
 	for _, customer := range *customers {
-		daysUntilExpiration := s.getDaysUntilExpiration(now, *customer.ExpireAt)
+		if customer.IsTrial {
+			continue
+		}
+		expireAt := *customer.ExpireAt
 
 		if p, ok := customerIdTributes[customer.ID]; ok {
-			if daysUntilExpiration != 1 {
+			if customer.IsBanned {
 				continue
 			}
-			_, purchaseId, err := s.paymentService.CreatePurchase(ctx, p.Amount, p.Month, &customer, database.InvoiceTypeTribute)
-			if err != nil {
-				slog.Error("Failed to create tribute purchase", "error", err)
-				continue
+			if expireAt.After(now) && expireAt.Sub(now) <= tributeRenewalOffset && s.renewTribute(ctx, customer, p) {
+				tributesProcessed++
 			}
+			continue
+		}
 
-			err = s.paymentService.ProcessPurchaseById(ctx, purchaseId)
-			if err != nil {
-				slog.Error("Failed to process tribute purchase", "error", err)
-				continue
-			}
-			slog.Info("Tribute purchase processed successfully", "purchase_id", purchaseId)
-			tributesProcessed[customer.ID] = true
+		offset, ok := dueOffset(config.ExpirationNotifyOffsets(), expireAt, now)
+		if !ok {
+			continue
 		}
-		if _, ok := tributesProcessed[customer.ID]; ok {
+		kind := notificationKind(offset)
+		claimed, err := s.notificationLogRepository.Claim(ctx, customer.ID, kind, expireAt)
+		if err != nil {
+			slog.Error("Failed to claim notification", "customer_id", customer.ID, "kind", kind, "error", err)
+			continue
+		}
+		if !claimed {
 			continue
 		}
 
-		err := s.sendNotification(ctx, customer)
+		err = s.sendNotification(ctx, customer, kind)
 		if err != nil {
-			slog.Error("Failed to send notification",
-				"customer_id", customer.ID,
-				"days_until_expiration", daysUntilExpiration,
-				"error", err)
+			slog.Error("Failed to send notification", "customer_id", customer.ID, "kind", kind, "error", err)
+			if errors.Is(err, bot.ErrorForbidden) {
+				if err := s.customerRepository.MarkBotBlocked(ctx, customer.TelegramID); err != nil {
+					slog.Error("Failed to mark customer as blocked", "customer_id", customer.ID, "error", err)
+				}
+				continue
+			}
+			if err := s.notificationLogRepository.Release(ctx, customer.ID, kind, expireAt); err != nil {
+				slog.Error("Failed to release notification", "customer_id", customer.ID, "kind", kind, "error", err)
+			}
 			continue
 		}
 
-		slog.Info("Notification sent successfully",
-			"customer_id", customer.ID,
-			"days_until_expiration", daysUntilExpiration)
+		sent++
+		slog.Info("Notification sent successfully", "customer_id", customer.ID, "kind", kind)
 	}
 
-	slog.Info(fmt.Sprintf("Processed tributes customers %d with expiring subscriptions", len(tributesProcessed)))
-	slog.Info(fmt.Sprintf("Sent notifications to %d customers with expiring subscriptions", len(*customers)-len(tributesProcessed)))
+	slog.Info(fmt.Sprintf("Processed tributes customers %d with expiring subscriptions", tributesProcessed))
+	slog.Info(fmt.Sprintf("Sent notifications to %d customers with expiring subscriptions", sent))
 	return nil
 }
 
-func (s *SubscriptionService) getCustomersWithExpiringSubscriptions() (*[]database.Customer, error) {
-	now := time.Now()
-	endDate := now.AddDate(0, 0, 3)
+// renewTribute creates and processes the next Tribute purchase once per subscription period.
+func (s *SubscriptionService) renewTribute(ctx context.Context, customer database.Customer, p *database.Purchase) bool {
+	claimed, err := s.notificationLogRepository.Claim(ctx, customer.ID, tributeRenewalKind, *customer.ExpireAt)
+	if err != nil {
+		slog.Error("Failed to claim tribute renewal", "customer_id", customer.ID, "error", err)
+		return false
+	}
+	if !claimed {
+		return false
+	}
 
-	dbCustomers, err := s.customerRepository.FindByExpirationRange(context.Background(), now, endDate)
+	_, purchaseId, err := s.paymentService.CreatePurchase(ctx, p.Amount, p.Month, &customer, database.InvoiceTypeTribute)
 	if err != nil {
-		return nil, err
+		slog.Error("Failed to create tribute purchase", "error", err)
+		if err := s.notificationLogRepository.Release(ctx, customer.ID, tributeRenewalKind, *customer.ExpireAt); err != nil {
+			slog.Error("Failed to release tribute renewal", "customer_id", customer.ID, "error", err)
+		}
+		return false
 	}
 
-	return dbCustomers, nil
+	err = s.paymentService.ProcessPurchaseById(ctx, purchaseId)
+	if err != nil {
+		slog.Error("Failed to process tribute purchase", "error", err)
+		return false
+	}
+	slog.Info("Tribute purchase processed successfully", "purchase_id", purchaseId)
+	return true
 }
 
-func (s *SubscriptionService) getDaysUntilExpiration(now time.Time, expireAt time.Time) int {
-	nowDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	expireDate := time.Date(expireAt.Year(), expireAt.Month(), expireAt.Day(), 0, 0, 0, 0, expireAt.Location())
+// lookahead is how far before expiration customers are loaded: the longest offset, and at least the Tribute renewal.
+func (s *SubscriptionService) lookahead() time.Duration {
+	lookahead := tributeRenewalOffset
+	if offsets := config.ExpirationNotifyOffsets(); len(offsets) > 0 && offsets[0] > lookahead {
+		lookahead = offsets[0]
+	}
+	return lookahead
+}
 
-	duration := expireDate.Sub(nowDate)
-	return int(duration.Hours() / 24)
+// dueOffset returns the shortest offset whose reminder time has passed. Reminders that were missed are not sent
+// once a shorter one is due, and after expiration only the zero offset is due.
+func dueOffset(offsets []time.Duration, expireAt time.Time, now time.Time) (time.Duration, bool) {
+	if !now.Before(expireAt) {
+		for _, offset := range offsets {
+			if offset == 0 {
+				return 0, true
+			}
+		}
+		return 0, false
+	}
+	for i := len(offsets) - 1; i >= 0; i-- {
+		if offsets[i] > 0 && !now.Before(expireAt.Add(-offsets[i])) {
+			return offsets[i], true
+		}
+	}
+	return 0, false
 }
 
-func (s *SubscriptionService) sendNotification(ctx context.Context, customer database.Customer) error {
-	expireDate := customer.ExpireAt.Format("02.01.2006")
+// notificationKind names the reminder of an offset, e.g. "expiring_7d", "expiring_2h" or "expired". The name is
+// stored in notification_log and selects the "subscription_<kind>" message.
+func notificationKind(offset time.Duration) string {
+	switch {
+	case offset == 0:
+		return NotificationKindExpired
+	case offset%(24*time.Hour) == 0:
+		return fmt.Sprintf("expiring_%dd", offset/(24*time.Hour))
+	case offset%time.Hour == 0:
+		return fmt.Sprintf("expiring_%dh", offset/time.Hour)
+	default:
+		return fmt.Sprintf("expiring_%dm", offset/time.Minute)
+	}
+}
 
-	messageText := fmt.Sprintf(
-		s.tm.GetText(customer.Language, "subscription_expiring"),
-		expireDate,
-	)
+// sendNotification sends the "subscription_<kind>" message, falling back to the generic "subscription_expiring" one
+// for offsets without their own translation.
+func (s *SubscriptionService) sendNotification(ctx context.Context, customer database.Customer, kind string) error {
+	expireDate := customer.ExpireAt.In(time.Local).Format("02.01.2006 15:04")
+
+	key := "subscription_" + kind
+	text := s.tm.GetText(customer.Language, key)
+	if text == key {
+		text = s.tm.GetText(customer.Language, "subscription_expiring")
+	}
+	messageText := fmt.Sprintf(text, expireDate)
 
 	_, err := s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:    customer.TelegramID,
@@ -148,6 +233,7 @@ func (s *SubscriptionService) sendNotification(ctx context.Context, customer dat
 			},
 		},
 	})
+	metrics.NotificationSent("subscription_"+kind, err)
 
 	return err
 }
@@ -0,0 +1,51 @@
+package notification
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDueOffset(t *testing.T) {
+	offsets := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, 2 * time.Hour, 0}
+	expireAt := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		offset time.Duration
+		due    bool
+	}{
+		{"before the first reminder", expireAt.Add(-8 * 24 * time.Hour), 0, false},
+		{"week before", expireAt.Add(-7 * 24 * time.Hour), 7 * 24 * time.Hour, true},
+		{"between reminders", expireAt.Add(-3 * 24 * time.Hour), 7 * 24 * time.Hour, true},
+		{"missed reminders are skipped", expireAt.Add(-time.Hour), 2 * time.Hour, true},
+		{"expired", expireAt.Add(time.Minute), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, due := dueOffset(offsets, expireAt, tt.now)
+			if due != tt.due || offset != tt.offset {
+				t.Errorf("dueOffset = %v, %v, want %v, %v", offset, due, tt.offset, tt.due)
+			}
+		})
+	}
+
+	if _, due := dueOffset(offsets[:3], expireAt, expireAt.Add(time.Minute)); due {
+		t.Error("an expired subscription is due without the zero offset")
+	}
+}
+
+func TestNotificationKind(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                  "expired",
+		3 * 24 * time.Hour: "expiring_3d",
+		2 * time.Hour:      "expiring_2h",
+		36 * time.Hour:     "expiring_36h",
+		30 * time.Minute:   "expiring_30m",
+	}
+	for offset, want := range tests {
+		if got := notificationKind(offset); got != want {
+			t.Errorf("notificationKind(%v) = %q, want %q", offset, got, want)
+		}
+	}
+}
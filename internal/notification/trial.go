@@ -0,0 +1,195 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/handler"
+	"remnawave-tg-shop-bot/internal/metrics"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/translation"
+	"time"
+)
+
+// Trial messages recorded in notification_log.
+const (
+	TrialKindCheckin = "trial_checkin"
+	TrialKindEnding  = "trial_ending"
+	TrialKindEnded   = "trial_ended"
+)
+
+// trialEndingOffset is when the "ending tomorrow" message is sent. The mid-trial check-in is only sent for trials
+// long enough for it to come before that message.
+const trialEndingOffset = 24 * time.Hour
+
+// TrialService walks trial customers through the trial: a check-in halfway through with setup help for those who
+// have not connected yet, a message the day before it ends with the first-purchase offer, and a nudge once it ended.
+type TrialService struct {
+	customerRepository        *database.CustomerRepository
+	notificationLogRepository *database.NotificationLogRepository
+	winbackRepository         *database.WinbackRepository
+	panels                    *remnawave.Panels
+	telegramBot               *bot.Bot
+	tm                        *translation.Manager
+}
+
+func NewTrialService(customerRepository *database.CustomerRepository,
+	notificationLogRepository *database.NotificationLogRepository,
+	winbackRepository *database.WinbackRepository,
+	panels *remnawave.Panels,
+	telegramBot *bot.Bot,
+	tm *translation.Manager) *TrialService {
+	return &TrialService{customerRepository: customerRepository, notificationLogRepository: notificationLogRepository, winbackRepository: winbackRepository, panels: panels, telegramBot: telegramBot, tm: tm}
+}
+
+// ProcessTrials sends every trial customer the message that is due. Each message is recorded in notification_log
+// before it is sent, so it goes out once per trial however often the job runs.
+func (s *TrialService) ProcessTrials(ctx context.Context) error {
+	if config.TrialDays() == 0 {
+		return nil
+	}
+	now := time.Now()
+	customers, err := s.customerRepository.FindByExpirationRange(ctx, now.Add(-expiredReminderWindow), now.AddDate(0, 0, config.TrialDays()))
+	if err != nil {
+		return err
+	}
+
+	offsets := trialOffsets(config.TrialDays())
+	sent := 0
+	for _, customer := range *customers {
+		if !customer.IsTrial || customer.IsBanned {
+			continue
+		}
+		expireAt := *customer.ExpireAt
+		offset, ok := dueOffset(offsets, expireAt, now)
+		if !ok {
+			continue
+		}
+		kind := trialKind(offset)
+		claimed, err := s.notificationLogRepository.Claim(ctx, customer.ID, kind, expireAt)
+		if err != nil {
+			slog.Error("Failed to claim trial message", "customer_id", customer.ID, "kind", kind, "error", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		err = s.send(ctx, customer, kind, now)
+		if err != nil {
+			slog.Error("Failed to send trial message", "customer_id", customer.ID, "kind", kind, "error", err)
+			if errors.Is(err, bot.ErrorForbidden) {
+				if err := s.customerRepository.MarkBotBlocked(ctx, customer.TelegramID); err != nil {
+					slog.Error("Failed to mark customer as blocked", "customer_id", customer.ID, "error", err)
+				}
+				continue
+			}
+			if err := s.notificationLogRepository.Release(ctx, customer.ID, kind, expireAt); err != nil {
+				slog.Error("Failed to release trial message", "customer_id", customer.ID, "kind", kind, "error", err)
+			}
+			continue
+		}
+		sent++
+	}
+
+	slog.Info(fmt.Sprintf("Sent trial messages to %d customers", sent))
+	return nil
+}
+
+// trialOffsets are the times before the end of a trial of the given length at which a message is due: halfway
+// through when that is more than a day before the end, a day before the end, and the end itself.
+func trialOffsets(trialDays int) []time.Duration {
+	var offsets []time.Duration
+	if half := time.Duration(trialDays) * 24 * time.Hour / 2; half > trialEndingOffset {
+		offsets = append(offsets, half)
+	}
+	return append(offsets, trialEndingOffset, 0)
+}
+
+func trialKind(offset time.Duration) string {
+	switch offset {
+	case 0:
+		return TrialKindEnded
+	case trialEndingOffset:
+		return TrialKindEnding
+	default:
+		return TrialKindCheckin
+	}
+}
+
+func (s *TrialService) send(ctx context.Context, customer database.Customer, kind string, now time.Time) error {
+	var (
+		text   string
+		button models.InlineKeyboardButton
+		offer  *database.WinbackOffer
+	)
+	switch kind {
+	case TrialKindCheckin:
+		used, err := s.hasTraffic(ctx, customer)
+		if err != nil {
+			return err
+		}
+		if used {
+			text = s.tm.GetText(customer.Language, "trial_checkin_used")
+			button = models.InlineKeyboardButton{Text: s.tm.GetText(customer.Language, "buy_button"), CallbackData: handler.CallbackBuy}
+		} else {
+			text = s.tm.GetText(customer.Language, "trial_checkin_unused")
+			button = models.InlineKeyboardButton{Text: s.tm.GetText(customer.Language, "connect_button"), CallbackData: handler.CallbackConnect}
+		}
+	case TrialKindEnding:
+		text = fmt.Sprintf(s.tm.GetText(customer.Language, "trial_ending"), customer.ExpireAt.In(time.Local).Format("02.01.2006 15:04"))
+		if percent := config.TrialOfferDiscount(); percent > 0 {
+			discountExpiresAt := now.AddDate(0, 0, config.TrialOfferDays())
+			offer = &database.WinbackOffer{
+				Campaign:          database.OfferCampaignTrial,
+				CustomerID:        customer.ID,
+				Step:              1,
+				ExpireAt:          *customer.ExpireAt,
+				DiscountPercent:   percent,
+				DiscountExpiresAt: &discountExpiresAt,
+			}
+			claimed, err := s.winbackRepository.Claim(ctx, offer)
+			if err != nil {
+				return err
+			}
+			if claimed {
+				text += "\n\n" + fmt.Sprintf(s.tm.GetText(customer.Language, "trial_ending_discount"),
+					percent, discountExpiresAt.In(time.Local).Format("02.01.2006 15:04"))
+			} else {
+				offer = nil
+			}
+		}
+		button = models.InlineKeyboardButton{Text: s.tm.GetText(customer.Language, "buy_button"), CallbackData: handler.CallbackBuy}
+	default:
+		text = s.tm.GetText(customer.Language, "trial_ended")
+		button = models.InlineKeyboardButton{Text: s.tm.GetText(customer.Language, "buy_button"), CallbackData: handler.CallbackBuy}
+	}
+
+	_, err := s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      customer.TelegramID,
+		Text:        text,
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{button}}},
+	})
+	metrics.NotificationSent(kind, err)
+	if err != nil && offer != nil && !errors.Is(err, bot.ErrorForbidden) {
+		if err := s.winbackRepository.Delete(ctx, offer.ID); err != nil {
+			slog.Error("Failed to delete trial offer", "customer_id", customer.ID, "error", err)
+		}
+	}
+	return err
+}
+
+// hasTraffic tells whether the customer has used the VPN during the trial.
+func (s *TrialService) hasTraffic(ctx context.Context, customer database.Customer) (bool, error) {
+	user, err := s.panels.Get(customer.Panel).FindUser(ctx, customer.TelegramID, customer.PanelUUID)
+	if err != nil {
+		return false, err
+	}
+	return user != nil && user.UsedTrafficBytes > 0, nil
+}
@@ -0,0 +1,33 @@
+package notification
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrialMessages(t *testing.T) {
+	expireAt := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		trialDays int
+		now       time.Time
+		kind      string
+		due       bool
+	}{
+		{"just started", 7, expireAt.AddDate(0, 0, -7), "", false},
+		{"halfway", 7, expireAt.Add(-84 * time.Hour), TrialKindCheckin, true},
+		{"ending tomorrow", 7, expireAt.Add(-20 * time.Hour), TrialKindEnding, true},
+		{"ended", 7, expireAt.Add(time.Minute), TrialKindEnded, true},
+		{"short trial has no check-in", 2, expireAt.Add(-30 * time.Hour), "", false},
+		{"short trial ending", 2, expireAt.Add(-24 * time.Hour), TrialKindEnding, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, due := dueOffset(trialOffsets(tt.trialDays), expireAt, tt.now)
+			if due != tt.due || (due && trialKind(offset) != tt.kind) {
+				t.Errorf("due = %v, kind = %q, want %v, %q", due, trialKind(offset), tt.due, tt.kind)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/handler"
+	"remnawave-tg-shop-bot/internal/metrics"
+	"remnawave-tg-shop-bot/internal/translation"
+	"time"
+)
+
+// winbackStepWindow is how long after its time a win-back step is still sent. Steps missed for longer, e.g. while
+// the bot was down or for customers that lapsed before win-back was enabled, are skipped.
+const winbackStepWindow = 24 * time.Hour
+
+// WinbackService sends the win-back sequence to customers whose subscription expired and was not renewed.
+type WinbackService struct {
+	customerRepository *database.CustomerRepository
+	winbackRepository  *database.WinbackRepository
+	telegramBot        *bot.Bot
+	tm                 *translation.Manager
+}
+
+func NewWinbackService(customerRepository *database.CustomerRepository, winbackRepository *database.WinbackRepository, telegramBot *bot.Bot, tm *translation.Manager) *WinbackService {
+	return &WinbackService{customerRepository: customerRepository, winbackRepository: winbackRepository, telegramBot: telegramBot, tm: tm}
+}
+
+// ProcessWinback sends every customer the step that is due for their lapsed subscription. Each step is recorded in
+// winback_offer before it is sent, so it goes out once per lapse; a renewal moves expire_at and ends the sequence.
+func (s *WinbackService) ProcessWinback(ctx context.Context) error {
+	steps := config.WinbackSteps()
+	if len(steps) == 0 {
+		return nil
+	}
+	now := time.Now()
+	from := now.AddDate(0, 0, -steps[len(steps)-1].Days).Add(-winbackStepWindow)
+	to := now.AddDate(0, 0, -steps[0].Days)
+
+	customers, err := s.customerRepository.FindByExpirationRange(ctx, from, to)
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	for _, customer := range *customers {
+		if customer.IsBanned {
+			continue
+		}
+		number, ok := dueWinbackStep(steps, *customer.ExpireAt, now)
+		if !ok {
+			continue
+		}
+		step := steps[number-1]
+
+		offer := &database.WinbackOffer{
+			Campaign:        database.OfferCampaignWinback,
+			CustomerID:      customer.ID,
+			Step:            number,
+			ExpireAt:        *customer.ExpireAt,
+			DiscountPercent: step.DiscountPercent,
+		}
+		if step.DiscountPercent > 0 {
+			discountExpiresAt := now.AddDate(0, 0, step.DiscountDays)
+			offer.DiscountExpiresAt = &discountExpiresAt
+		}
+		claimed, err := s.winbackRepository.Claim(ctx, offer)
+		if err != nil {
+			slog.Error("Failed to claim winback offer", "customer_id", customer.ID, "step", number, "error", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		err = s.send(ctx, customer, offer)
+		if err != nil {
+			slog.Error("Failed to send winback message", "customer_id", customer.ID, "step", number, "error", err)
+			if errors.Is(err, bot.ErrorForbidden) {
+				if err := s.customerRepository.MarkBotBlocked(ctx, customer.TelegramID); err != nil {
+					slog.Error("Failed to mark customer as blocked", "customer_id", customer.ID, "error", err)
+				}
+				continue
+			}
+			if err := s.winbackRepository.Delete(ctx, offer.ID); err != nil {
+				slog.Error("Failed to delete winback offer", "customer_id", customer.ID, "error", err)
+			}
+			continue
+		}
+		sent++
+	}
+
+	slog.Info(fmt.Sprintf("Sent winback messages to %d customers", sent))
+	return nil
+}
+
+// dueWinbackStep returns the 1-based number of the step whose time has come within the last winbackStepWindow.
+func dueWinbackStep(steps []config.WinbackStep, expireAt time.Time, now time.Time) (int, bool) {
+	for i := len(steps) - 1; i >= 0; i-- {
+		at := expireAt.AddDate(0, 0, steps[i].Days)
+		if !now.Before(at) {
+			return i + 1, now.Sub(at) < winbackStepWindow
+		}
+	}
+	return 0, false
+}
+
+// send uses the "winback_step_<n>" message when there is one, otherwise "winback_discount" or "winback_reminder".
+// Messages with a discount get the percent and the date it is valid until.
+func (s *WinbackService) send(ctx context.Context, customer database.Customer, offer *database.WinbackOffer) error {
+	var args []interface{}
+	fallback := "winback_reminder"
+	if offer.DiscountExpiresAt != nil {
+		args = append(args, offer.DiscountPercent, offer.DiscountExpiresAt.In(time.Local).Format("02.01.2006 15:04"))
+		fallback = "winback_discount"
+	}
+
+	key := fmt.Sprintf("winback_step_%d", offer.Step)
+	text := s.tm.GetText(customer.Language, key)
+	if text == key {
+		text = s.tm.GetText(customer.Language, fallback)
+	}
+
+	_, err := s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		Text:      fmt.Sprintf(text, args...),
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{{Text: s.tm.GetText(customer.Language, "renew_subscription_button"), CallbackData: handler.CallbackBuy}},
+			},
+		},
+	})
+	metrics.NotificationSent("winback", err)
+	return err
+}
@@ -0,0 +1,35 @@
+package notification
+
+import (
+	"testing"
+	"time"
+
+	"remnawave-tg-shop-bot/internal/config"
+)
+
+func TestDueWinbackStep(t *testing.T) {
+	steps := []config.WinbackStep{{Days: 3}, {Days: 7, DiscountPercent: 20, DiscountDays: 3}, {Days: 30}}
+	expireAt := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		now  time.Time
+		step int
+		due  bool
+	}{
+		{"too early", expireAt.AddDate(0, 0, 2), 0, false},
+		{"first step", expireAt.AddDate(0, 0, 3).Add(time.Hour), 1, true},
+		{"first step window passed", expireAt.AddDate(0, 0, 5), 1, false},
+		{"second step", expireAt.AddDate(0, 0, 7), 2, true},
+		{"last step", expireAt.AddDate(0, 0, 30).Add(23 * time.Hour), 3, true},
+		{"sequence over", expireAt.AddDate(0, 0, 32), 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, due := dueWinbackStep(steps, expireAt, tt.now)
+			if due != tt.due || (due && step != tt.step) {
+				t.Errorf("dueWinbackStep = %d, %v, want %d, %v", step, due, tt.step, tt.due)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"html"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/translation"
+	"remnawave-tg-shop-bot/utils"
+	"strings"
+	"time"
+)
+
+// Event is the type of admin feed message. Values are used as keys of ADMIN_LOG_TOPICS.
+type Event string
+
+const (
+	EventNewCustomer       Event = "new_customer"
+	EventTrialActivated    Event = "trial"
+	EventPurchasePaid      Event = "purchase"
+	EventProvisioningError Event = "provisioning_error"
+	EventRefund            Event = "refund"
+	EventSync              Event = "sync"
+	EventNode              Event = "node"
+)
+
+const sendTimeout = 10 * time.Second
+
+// Notifier posts business events to the admin log chat, optionally into a forum topic per event type.
+type Notifier struct {
+	telegramBot *bot.Bot
+	translation *translation.Manager
+}
+
+func NewNotifier(telegramBot *bot.Bot, translation *translation.Manager) *Notifier {
+	return &Notifier{telegramBot: telegramBot, translation: translation}
+}
+
+func (n *Notifier) NewCustomer(telegramID int64, username string) {
+	if username != "" {
+		username = "@" + username
+	} else {
+		username = "—"
+	}
+	n.notify(EventNewCustomer, n.format("event_new_customer", telegramID, html.EscapeString(username)))
+}
+
+func (n *Notifier) TrialActivated(customer *database.Customer) {
+	n.notify(EventTrialActivated, n.format("event_trial_activated", customer.TelegramID, config.TrialDays()))
+}
+
+func (n *Notifier) PurchasePaid(purchase *database.Purchase, customer *database.Customer) {
+	n.notify(EventPurchasePaid, n.format("event_purchase_paid",
+		customer.TelegramID, purchase.ID, purchase.Amount, purchase.Currency, purchase.InvoiceType, purchase.Month))
+}
+
+func (n *Notifier) ProvisioningError(purchaseID int64, telegramID int64, err error) {
+	n.notify(EventProvisioningError, n.format("event_provisioning_error", telegramID, purchaseID, html.EscapeString(err.Error())))
+}
+
+func (n *Notifier) Refund(purchase *database.Purchase, customer *database.Customer) {
+	n.notify(EventRefund, n.format("event_refund",
+		customer.TelegramID, purchase.ID, purchase.Amount, purchase.Currency, purchase.InvoiceType, purchase.Month))
+}
+
+func (n *Notifier) SyncCompleted(panelUsers, created, updated int) {
+	n.notify(EventSync, n.format("event_sync_completed", panelUsers, created, updated))
+}
+
+func (n *Notifier) SyncFailed(err error) {
+	n.notify(EventSync, n.format("event_sync_failed", html.EscapeString(err.Error())))
+}
+
+func (n *Notifier) NodeOffline(node remnawave.NodeStatus) {
+	n.notify(EventNode, n.format("event_node_offline", nodeName(node), html.EscapeString(node.Panel)))
+}
+
+func (n *Notifier) NodeOnline(node remnawave.NodeStatus, downtime time.Duration) {
+	n.notify(EventNode, n.format("event_node_online", nodeName(node), html.EscapeString(node.Panel), utils.FormatDuration(downtime)))
+}
+
+func nodeName(node remnawave.NodeStatus) string {
+	return strings.TrimSpace(utils.CountryFlag(node.CountryCode) + " " + html.EscapeString(node.Name))
+}
+
+func (n *Notifier) format(key string, args ...interface{}) string {
+	return fmt.Sprintf(n.translation.GetText("", key), args...)
+}
+
+// notify sends the message in the background so the feed never slows down payments or sync.
+func (n *Notifier) notify(event Event, text string) {
+	chatID := config.AdminLogChatId()
+	if chatID == 0 {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+
+		_, err := n.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          chatID,
+			MessageThreadID: config.AdminLogTopic(string(event)),
+			ParseMode:       models.ParseModeHTML,
+			Text:            text,
+		})
+		if err != nil {
+			slog.Error("Error sending admin event", "event", event, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,460 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+// In-memory implementations of the repositories PaymentService uses. Every repository can be made to fail through
+// its err field, set by the tests to simulate a database outage.
+
+type fakePurchaseRepository struct {
+	mu        sync.Mutex
+	purchases map[int64]*database.Purchase
+	nextID    int64
+	// provisionErr is returned by MarkAsProvisioned only, after the panel user is already changed.
+	provisionErr error
+}
+
+func newFakePurchaseRepository() *fakePurchaseRepository {
+	return &fakePurchaseRepository{purchases: make(map[int64]*database.Purchase)}
+}
+
+func (r *fakePurchaseRepository) Create(_ context.Context, purchase *database.Purchase) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	stored := *purchase
+	stored.ID = r.nextID
+	stored.CreatedAt = time.Now()
+	r.purchases[stored.ID] = &stored
+	return stored.ID, nil
+}
+
+func (r *fakePurchaseRepository) FindById(_ context.Context, id int64) (*database.Purchase, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	purchase, ok := r.purchases[id]
+	if !ok {
+		return nil, nil
+	}
+	found := *purchase
+	return &found, nil
+}
+
+func (r *fakePurchaseRepository) FindByCustomerIDAndInvoiceTypeLast(_ context.Context, customerID int64, invoiceType database.InvoiceType) (*database.Purchase, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var last *database.Purchase
+	for _, purchase := range r.purchases {
+		if purchase.CustomerID == customerID && purchase.InvoiceType == invoiceType && (last == nil || purchase.ID > last.ID) {
+			last = purchase
+		}
+	}
+	if last == nil {
+		return nil, nil
+	}
+	found := *last
+	return &found, nil
+}
+
+func (r *fakePurchaseRepository) UpdateFields(_ context.Context, id int64, updates map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	purchase, ok := r.purchases[id]
+	if !ok {
+		return nil
+	}
+	for field, value := range updates {
+		switch field {
+		case "status":
+			purchase.Status = value.(database.PurchaseStatus)
+		case "paid_at":
+			paidAt := value.(time.Time)
+			purchase.PaidAt = &paidAt
+		case "expire_at":
+			expireAt := value.(time.Time)
+			purchase.ExpireAt = &expireAt
+		default:
+			panic(fmt.Sprintf("fake purchase repository: unsupported field %s", field))
+		}
+	}
+	return nil
+}
+
+func (r *fakePurchaseRepository) MarkAsPaidUnprovisioned(ctx context.Context, purchaseID int64) error {
+	return r.UpdateFields(ctx, purchaseID, map[string]interface{}{
+		"status":  database.PurchaseStatusPaidUnprovisioned,
+		"paid_at": time.Now(),
+	})
+}
+
+func (r *fakePurchaseRepository) MarkAsProvisioned(ctx context.Context, purchaseID int64) error {
+	if r.provisionErr != nil {
+		return r.provisionErr
+	}
+	return r.UpdateFields(ctx, purchaseID, map[string]interface{}{"status": database.PurchaseStatusPaid})
+}
+
+type fakeCustomerRepository struct {
+	mu        sync.Mutex
+	customers map[int64]*database.Customer
+	nextID    int64
+	err       error
+}
+
+func newFakeCustomerRepository() *fakeCustomerRepository {
+	return &fakeCustomerRepository{customers: make(map[int64]*database.Customer)}
+}
+
+func (r *fakeCustomerRepository) Create(customer *database.Customer) *database.Customer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	stored := *customer
+	stored.ID = r.nextID
+	stored.CreatedAt = time.Now()
+	r.customers[stored.ID] = &stored
+	created := stored
+	return &created
+}
+
+func (r *fakeCustomerRepository) FindById(_ context.Context, id int64) (*database.Customer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	customer, ok := r.customers[id]
+	if !ok {
+		return nil, nil
+	}
+	found := *customer
+	return &found, nil
+}
+
+func (r *fakeCustomerRepository) FindByTelegramId(_ context.Context, telegramId int64) (*database.Customer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	for _, customer := range r.customers {
+		if customer.TelegramID == telegramId {
+			found := *customer
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeCustomerRepository) UpdateFields(_ context.Context, id int64, updates map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	customer, ok := r.customers[id]
+	if !ok {
+		return nil
+	}
+	for field, value := range updates {
+		switch field {
+		case "subscription_link":
+			link := value.(string)
+			customer.SubscriptionLink = &link
+		case "expire_at":
+			switch expireAt := value.(type) {
+			case time.Time:
+				customer.ExpireAt = &expireAt
+			case *time.Time:
+				customer.ExpireAt = expireAt
+			}
+		case "panel_uuid":
+			panelUUID := value.(uuid.UUID)
+			customer.PanelUUID = &panelUUID
+		case "panel_short_uuid":
+			shortUUID := value.(string)
+			customer.PanelShortUUID = &shortUUID
+		case "is_trial":
+			customer.IsTrial = value.(bool)
+		default:
+			panic(fmt.Sprintf("fake customer repository: unsupported field %s", field))
+		}
+	}
+	return nil
+}
+
+func (r *fakeCustomerRepository) ClaimTrial(_ context.Context, id int64, source string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return false, r.err
+	}
+	customer, ok := r.customers[id]
+	if !ok || customer.TrialUsedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	customer.TrialUsedAt = &now
+	customer.TrialSource = &source
+	return true, nil
+}
+
+func (r *fakeCustomerRepository) ResetTrial(_ context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if customer, ok := r.customers[id]; ok {
+		customer.TrialUsedAt = nil
+		customer.TrialSource = nil
+	}
+	return nil
+}
+
+type fakeReferralRepository struct {
+	mu        sync.Mutex
+	referrals []*database.Referral
+}
+
+func (r *fakeReferralRepository) Create(referrerID, refereeID int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.referrals = append(r.referrals, &database.Referral{
+		ID:         int64(len(r.referrals) + 1),
+		ReferrerID: referrerID,
+		RefereeID:  refereeID,
+		UsedAt:     time.Now(),
+	})
+}
+
+func (r *fakeReferralRepository) FindByReferee(_ context.Context, refereeID int64) (*database.Referral, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, referral := range r.referrals {
+		if referral.RefereeID == refereeID {
+			found := *referral
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeReferralRepository) MarkBonusGranted(_ context.Context, referralID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, referral := range r.referrals {
+		if referral.ID == referralID {
+			referral.BonusGranted = true
+		}
+	}
+	return nil
+}
+
+type fakeEventRepository struct {
+	mu     sync.Mutex
+	events []database.SubscriptionEvent
+}
+
+func (r *fakeEventRepository) Record(_ context.Context, event database.SubscriptionEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *fakeEventRepository) sources(customerID int64) []database.SubscriptionEventSource {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var sources []database.SubscriptionEventSource
+	for _, event := range r.events {
+		if event.CustomerID == customerID {
+			sources = append(sources, event.Source)
+		}
+	}
+	return sources
+}
+
+type fakeJobRepository struct {
+	mu        sync.Mutex
+	jobs      []*database.ProvisioningJob
+	purchases *fakePurchaseRepository
+	err       error
+}
+
+func (r *fakeJobRepository) Enqueue(_ context.Context, purchaseID int64, delay time.Duration, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.enqueue(purchaseID, delay, lastError)
+	return nil
+}
+
+func (r *fakeJobRepository) EnqueueOrphaned(_ context.Context, olderThan time.Duration) (int64, error) {
+	r.purchases.mu.Lock()
+	var orphaned []int64
+	for _, purchase := range r.purchases.purchases {
+		if purchase.Status == database.PurchaseStatusPaidUnprovisioned && purchase.PaidAt.Before(time.Now().Add(-olderThan)) {
+			orphaned = append(orphaned, purchase.ID)
+		}
+	}
+	r.purchases.mu.Unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var queued int64
+	for _, purchaseID := range orphaned {
+		if r.enqueue(purchaseID, 0, "provisioning job was not queued") {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// enqueue adds a job for the purchase unless it has one and reports whether it did.
+func (r *fakeJobRepository) enqueue(purchaseID int64, delay time.Duration, lastError string) bool {
+	for _, job := range r.jobs {
+		if job.PurchaseID == purchaseID {
+			return false
+		}
+	}
+	r.jobs = append(r.jobs, &database.ProvisioningJob{
+		ID:         int64(len(r.jobs) + 1),
+		PurchaseID: purchaseID,
+		Status:     database.ProvisioningJobPending,
+		Attempts:   1,
+		LastError:  &lastError,
+		NextRunAt:  time.Now().Add(delay),
+		CreatedAt:  time.Now(),
+	})
+	return true
+}
+
+// Claim ignores the lease and hands out every pending job, due or not, so the tests do not wait for the backoff.
+func (r *fakeJobRepository) Claim(_ context.Context, limit int, _ time.Duration) ([]database.ProvisioningJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var claimed []database.ProvisioningJob
+	for _, job := range r.jobs {
+		if job.Status == database.ProvisioningJobPending && len(claimed) < limit {
+			claimed = append(claimed, *job)
+		}
+	}
+	return claimed, nil
+}
+
+func (r *fakeJobRepository) MarkDone(_ context.Context, id int64) error {
+	r.update(id, func(job *database.ProvisioningJob) { job.Status = database.ProvisioningJobDone })
+	return nil
+}
+
+func (r *fakeJobRepository) Retry(_ context.Context, id int64, nextRunAt time.Time, lastError string) error {
+	r.update(id, func(job *database.ProvisioningJob) {
+		job.Attempts++
+		job.NextRunAt = nextRunAt
+		job.LastError = &lastError
+	})
+	return nil
+}
+
+func (r *fakeJobRepository) MarkFailed(_ context.Context, id int64, lastError string) error {
+	r.update(id, func(job *database.ProvisioningJob) {
+		job.Status = database.ProvisioningJobFailed
+		job.LastError = &lastError
+	})
+	return nil
+}
+
+func (r *fakeJobRepository) update(id int64, apply func(job *database.ProvisioningJob)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, job := range r.jobs {
+		if job.ID == id {
+			apply(job)
+		}
+	}
+}
+
+func (r *fakeJobRepository) find(purchaseID int64) *database.ProvisioningJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, job := range r.jobs {
+		if job.PurchaseID == purchaseID {
+			found := *job
+			return &found
+		}
+	}
+	return nil
+}
+
+type fakeWinbackRepository struct {
+	mu     sync.Mutex
+	offers []*database.WinbackOffer
+}
+
+func (r *fakeWinbackRepository) Add(offer database.WinbackOffer) *database.WinbackOffer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	offer.ID = int64(len(r.offers) + 1)
+	offer.SentAt = time.Now()
+	r.offers = append(r.offers, &offer)
+	return &offer
+}
+
+func (r *fakeWinbackRepository) FindActiveDiscount(_ context.Context, customerID int64) (*database.WinbackOffer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var best *database.WinbackOffer
+	for _, offer := range r.offers {
+		if offer.CustomerID != customerID || offer.DiscountPercent == 0 || offer.ConvertedAt != nil ||
+			offer.DiscountExpiresAt == nil || !offer.DiscountExpiresAt.After(time.Now()) {
+			continue
+		}
+		if best == nil || offer.DiscountPercent > best.DiscountPercent {
+			best = offer
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	found := *best
+	return &found, nil
+}
+
+func (r *fakeWinbackRepository) MarkConverted(_ context.Context, customerID int64, expireAt time.Time, purchaseID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var last *database.WinbackOffer
+	for _, offer := range r.offers {
+		if offer.CustomerID == customerID && offer.ExpireAt.Equal(expireAt) && offer.ConvertedAt == nil {
+			last = offer
+		}
+	}
+	if last != nil {
+		now := time.Now()
+		last.ConvertedAt = &now
+		last.PurchaseID = &purchaseID
+	}
+	return nil
+}
+
+// fakeMilestones counts the milestone evaluations of each referrer.
+type fakeMilestones struct {
+	mu        sync.Mutex
+	evaluated map[int64]int
+}
+
+func (m *fakeMilestones) EvaluateMilestones(_ context.Context, referrerTelegramID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.evaluated == nil {
+		m.evaluated = make(map[int64]int)
+	}
+	m.evaluated[referrerTelegramID]++
+	return nil
+}
@@ -7,10 +7,13 @@ import (
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"log/slog"
+	"math"
 	"remnawave-tg-shop-bot/internal/cache"
 	"remnawave-tg-shop-bot/internal/config"
 	"remnawave-tg-shop-bot/internal/cryptopay"
 	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/metrics"
+	"remnawave-tg-shop-bot/internal/notifier"
 	"remnawave-tg-shop-bot/internal/remnawave"
 	"remnawave-tg-shop-bot/internal/translation"
 	"remnawave-tg-shop-bot/internal/yookasa"
@@ -18,49 +21,122 @@ import (
 	"time"
 )
 
+// The repositories PaymentService works with. The database package implements them; the tests use in-memory fakes.
+type (
+	PurchaseRepository interface {
+		Create(ctx context.Context, purchase *database.Purchase) (int64, error)
+		FindById(ctx context.Context, id int64) (*database.Purchase, error)
+		FindByCustomerIDAndInvoiceTypeLast(ctx context.Context, customerID int64, invoiceType database.InvoiceType) (*database.Purchase, error)
+		UpdateFields(ctx context.Context, id int64, updates map[string]interface{}) error
+		MarkAsPaidUnprovisioned(ctx context.Context, purchaseID int64) error
+		MarkAsProvisioned(ctx context.Context, purchaseID int64) error
+	}
+
+	CustomerRepository interface {
+		FindById(ctx context.Context, id int64) (*database.Customer, error)
+		FindByTelegramId(ctx context.Context, telegramId int64) (*database.Customer, error)
+		UpdateFields(ctx context.Context, id int64, updates map[string]interface{}) error
+		ClaimTrial(ctx context.Context, id int64, source string) (bool, error)
+		ResetTrial(ctx context.Context, id int64) error
+	}
+
+	ReferralRepository interface {
+		FindByReferee(ctx context.Context, refereeID int64) (*database.Referral, error)
+		MarkBonusGranted(ctx context.Context, referralID int64) error
+	}
+
+	SubscriptionEventRepository interface {
+		Record(ctx context.Context, event database.SubscriptionEvent)
+	}
+
+	ProvisioningJobRepository interface {
+		Enqueue(ctx context.Context, purchaseID int64, delay time.Duration, lastError string) error
+		EnqueueOrphaned(ctx context.Context, olderThan time.Duration) (int64, error)
+		Claim(ctx context.Context, limit int, lease time.Duration) ([]database.ProvisioningJob, error)
+		MarkDone(ctx context.Context, id int64) error
+		Retry(ctx context.Context, id int64, nextRunAt time.Time, lastError string) error
+		MarkFailed(ctx context.Context, id int64, lastError string) error
+	}
+
+	WinbackRepository interface {
+		FindActiveDiscount(ctx context.Context, customerID int64) (*database.WinbackOffer, error)
+		MarkConverted(ctx context.Context, customerID int64, expireAt time.Time, purchaseID int64) error
+	}
+
+	// MilestoneEvaluator is the part of referral.Service that runs after a referral bonus.
+	MilestoneEvaluator interface {
+		EvaluateMilestones(ctx context.Context, referrerTelegramID int64) error
+	}
+)
+
 type PaymentService struct {
-	purchaseRepository *database.PurchaseRepository
-	remnawaveClient    *remnawave.Client
-	customerRepository *database.CustomerRepository
+	purchaseRepository PurchaseRepository
+	panels             *remnawave.Panels
+	customerRepository CustomerRepository
 	telegramBot        *bot.Bot
 	translation        *translation.Manager
 	cryptoPayClient    *cryptopay.Client
 	yookasaClient      *yookasa.Client
-	referralRepository *database.ReferralRepository
+	referralRepository ReferralRepository
+	referralService    MilestoneEvaluator
+	eventRepository    SubscriptionEventRepository
+	jobRepository      ProvisioningJobRepository
+	winbackRepository  WinbackRepository
+	notifier           *notifier.Notifier
 	cache              *cache.Cache
+	usageCache         *remnawave.UsageCache
 }
 
 func NewPaymentService(
 	translation *translation.Manager,
-	purchaseRepository *database.PurchaseRepository,
-	remnawaveClient *remnawave.Client,
-	customerRepository *database.CustomerRepository,
+	purchaseRepository PurchaseRepository,
+	panels *remnawave.Panels,
+	customerRepository CustomerRepository,
 	telegramBot *bot.Bot,
 	cryptoPayClient *cryptopay.Client,
 	yookasaClient *yookasa.Client,
-	referralRepository *database.ReferralRepository,
+	referralRepository ReferralRepository,
+	referralService MilestoneEvaluator,
+	eventRepository SubscriptionEventRepository,
+	jobRepository ProvisioningJobRepository,
+	winbackRepository WinbackRepository,
+	notifier *notifier.Notifier,
 	cache *cache.Cache,
+	usageCache *remnawave.UsageCache,
 ) *PaymentService {
 	return &PaymentService{
 		purchaseRepository: purchaseRepository,
-		remnawaveClient:    remnawaveClient,
+		panels:             panels,
 		customerRepository: customerRepository,
 		telegramBot:        telegramBot,
 		translation:        translation,
 		cryptoPayClient:    cryptoPayClient,
 		yookasaClient:      yookasaClient,
 		referralRepository: referralRepository,
+		referralService:    referralService,
+		eventRepository:    eventRepository,
+		jobRepository:      jobRepository,
+		winbackRepository:  winbackRepository,
+		notifier:           notifier,
 		cache:              cache,
+		usageCache:         usageCache,
 	}
 }
 
+// ProcessPurchaseById records the confirmed payment and provisions the panel user. When provisioning fails, because
+// the panel or the database is unavailable, the purchase stays paid_unprovisioned, the customer is told the
+// subscription is being activated and the provisioning queue retries it, so a confirmed payment is never lost.
 func (s PaymentService) ProcessPurchaseById(ctx context.Context, purchaseId int64) error {
 	purchase, err := s.purchaseRepository.FindById(ctx, purchaseId)
 	if err != nil {
 		return err
 	}
 	if purchase == nil {
-		return fmt.Errorf("purchase with crypto invoice id %d not found", utils.MaskHalfInt64(purchaseId))
+		return fmt.Errorf("purchase with crypto invoice id %s not found", utils.MaskHalfInt64(purchaseId))
+	}
+	if purchase.Status == database.PurchaseStatusPaid || purchase.Status == database.PurchaseStatusPaidUnprovisioned {
+		slog.Warn("purchase already paid", "purchase_id", utils.MaskHalfInt64(purchase.ID))
+		return nil
 	}
 
 	customer, err := s.customerRepository.FindById(ctx, purchase.CustomerID)
@@ -77,29 +153,109 @@ func (s PaymentService) ProcessPurchaseById(ctx context.Context, purchaseId int6
 			MessageID: messageId,
 		})
 		if err != nil {
-			slog.Error("Error deleting message", err)
+			slog.Error("Error deleting message", "error", err)
 		}
 	}
 
-	user, err := s.remnawaveClient.CreateOrUpdateUser(ctx, customer.ID, customer.TelegramID, config.TrafficLimit(), purchase.Month*config.DaysInMonth())
-	if err != nil {
+	if err := s.purchaseRepository.MarkAsPaidUnprovisioned(ctx, purchase.ID); err != nil {
 		return err
 	}
+	if customer.IsBanned {
+		// Provisioning would bring back the disabled panel user. The purchase stays paid_unprovisioned for the
+		// admins to refund it or to provision it after an unban.
+		s.notifier.ProvisioningError(purchase.ID, customer.TelegramID, database.ErrCustomerBanned)
+		return nil
+	}
 
-	err = s.purchaseRepository.MarkAsPaid(ctx, purchase.ID)
-	if err != nil {
+	err = s.provisionPurchase(ctx, purchase, customer)
+	if err == nil {
+		return nil
+	}
+
+	slog.Warn("Provisioning postponed", "purchase_id", utils.MaskHalfInt64(purchase.ID), "error", err)
+	if err := s.jobRepository.Enqueue(ctx, purchase.ID, provisioningBackoff(1), err.Error()); err != nil {
 		return err
 	}
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text:      s.translation.GetText(customer.Language, "payment_received_activating"),
+	})
+	if err != nil {
+		slog.Error("Error sending activating message", "error", err)
+	}
+	return nil
+}
+
+// errNotProvisioned wraps the errors that leave a purchase paid_unprovisioned. The provisioning queue retries it.
+var errNotProvisioned = errors.New("purchase not provisioned")
+
+// provisionPurchase creates or extends the panel user of a paid_unprovisioned purchase and completes it. Every
+// failure until the purchase is marked provisioned is returned wrapped in errNotProvisioned; what comes after the
+// delivery only logs its errors.
+//
+// The expiration date the purchase pays for is stored on it before the panel is called, and the panel user is set
+// to that date. A retry after a failure past the panel call therefore does not add the months again.
+func (s PaymentService) provisionPurchase(ctx context.Context, purchase *database.Purchase, customer *database.Customer) error {
+	panel := s.panels.Get(customer.Panel)
+	if purchase.ExpireAt == nil {
+		existingUser, err := panel.FindUser(ctx, customer.TelegramID, customer.PanelUUID)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errNotProvisioned, err)
+		}
+		expireAt := remnawave.ExtendedExpire(existingUser, purchase.Month*config.DaysInMonth())
+		if err := s.purchaseRepository.UpdateFields(ctx, purchase.ID, map[string]interface{}{"expire_at": expireAt}); err != nil {
+			return fmt.Errorf("%w: %w", errNotProvisioned, err)
+		}
+		purchase.ExpireAt = &expireAt
+	}
+
+	user, err := panel.CreateOrUpdateUserUntil(ctx, customer.ID, customer.TelegramID, customer.PanelUUID, config.TrafficLimit(), *purchase.ExpireAt)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errNotProvisioned, err)
+	}
 
 	customerFilesToUpdate := map[string]interface{}{
 		"subscription_link": user.SubscriptionUrl,
 		"expire_at":         user.ExpireAt,
+		"panel_uuid":        user.UUID,
+		"panel_short_uuid":  user.ShortUuid,
+		"is_trial":          false,
 	}
 
 	err = s.customerRepository.UpdateFields(ctx, customer.ID, customerFilesToUpdate)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %w", errNotProvisioned, err)
+	}
+	err = s.purchaseRepository.MarkAsProvisioned(ctx, purchase.ID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errNotProvisioned, err)
 	}
+	s.usageCache.Invalidate(customer.TelegramID)
+
+	if customer.ExpireAt != nil {
+		if err := s.winbackRepository.MarkConverted(ctx, customer.ID, *customer.ExpireAt, purchase.ID); err != nil {
+			slog.Error("Error tracking winback conversion", "error", err)
+		}
+	}
+	if customer.TrialUsedAt == nil {
+		if _, err := s.customerRepository.ClaimTrial(ctx, customer.ID, database.TrialSourcePurchase); err != nil {
+			slog.Error("Error marking trial as used", "error", err)
+		}
+	}
+	trafficLimit := int64(config.TrafficLimit())
+	s.eventRepository.Record(ctx, database.SubscriptionEvent{
+		CustomerID:       customer.ID,
+		TelegramID:       customer.TelegramID,
+		Source:           database.SubscriptionEventPurchase,
+		Actor:            database.ActorCustomer(customer.TelegramID),
+		PreviousExpireAt: customer.ExpireAt,
+		NewExpireAt:      &user.ExpireAt,
+		TrafficLimit:     &trafficLimit,
+		PurchaseID:       &purchase.ID,
+	})
+	s.notifier.PurchasePaid(purchase, customer)
+	metrics.PurchasePaid(string(purchase.InvoiceType), purchase.Currency, purchase.Amount)
 
 	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: customer.TelegramID,
@@ -109,42 +265,69 @@ func (s PaymentService) ProcessPurchaseById(ctx context.Context, purchaseId int6
 		},
 	})
 	if err != nil {
-		return err
+		slog.Error("Error sending activation message", "error", err)
 	}
 
-	ctxReferee := context.Background()
-	referee, err := s.referralRepository.FindByReferee(ctxReferee, customer.TelegramID)
-	if referee == nil {
-		return nil
-	}
-	if referee.BonusGranted {
-		return nil
+	if err := s.grantReferralBonus(context.Background(), purchase, customer); err != nil {
+		slog.Error("Error granting referral bonus", "purchase_id", utils.MaskHalfInt64(purchase.ID), "error", err)
 	}
+	slog.Info("purchase processed", "purchase_id", utils.MaskHalfInt64(purchase.ID), "type", purchase.InvoiceType, "customer_id", utils.MaskHalfInt64(customer.ID))
+
+	return nil
+}
+
+// grantReferralBonus gives REFERRAL_DAYS to the referrer of the customer after the first paid purchase.
+func (s PaymentService) grantReferralBonus(ctx context.Context, purchase *database.Purchase, customer *database.Customer) error {
+	referee, err := s.referralRepository.FindByReferee(ctx, customer.TelegramID)
 	if err != nil {
 		return err
 	}
-	refereeCustomer, err := s.customerRepository.FindByTelegramId(ctxReferee, referee.ReferrerID)
+	if referee == nil || referee.BonusGranted {
+		return nil
+	}
+	refereeCustomer, err := s.customerRepository.FindByTelegramId(ctx, referee.ReferrerID)
 	if err != nil {
 		return err
 	}
-	refereeUser, err := s.remnawaveClient.CreateOrUpdateUser(ctxReferee, refereeCustomer.ID, refereeCustomer.TelegramID, config.TrafficLimit(), config.GetReferralDays())
+	if refereeCustomer == nil || refereeCustomer.IsBanned {
+		return nil
+	}
+	refereeUser, err := s.panels.Get(refereeCustomer.Panel).CreateOrUpdateUser(ctx, refereeCustomer.ID, refereeCustomer.TelegramID, refereeCustomer.PanelUUID, config.TrafficLimit(), config.GetReferralDays())
 	if err != nil {
 		return err
 	}
 	refereeUserFilesToUpdate := map[string]interface{}{
 		"subscription_link": refereeUser.GetSubscriptionUrl(),
 		"expire_at":         refereeUser.GetExpireAt(),
+		"panel_uuid":        refereeUser.UUID,
+		"panel_short_uuid":  refereeUser.ShortUuid,
+		"is_trial":          false,
 	}
-	err = s.customerRepository.UpdateFields(ctxReferee, refereeCustomer.ID, refereeUserFilesToUpdate)
+	err = s.customerRepository.UpdateFields(ctx, refereeCustomer.ID, refereeUserFilesToUpdate)
 	if err != nil {
 		return err
 	}
-	err = s.referralRepository.MarkBonusGranted(ctxReferee, referee.ID)
+	s.usageCache.Invalidate(refereeCustomer.TelegramID)
+	trafficLimit := int64(config.TrafficLimit())
+	s.eventRepository.Record(ctx, database.SubscriptionEvent{
+		CustomerID:       refereeCustomer.ID,
+		TelegramID:       refereeCustomer.TelegramID,
+		Source:           database.SubscriptionEventReferralBonus,
+		Actor:            database.ActorSystem,
+		PreviousExpireAt: refereeCustomer.ExpireAt,
+		NewExpireAt:      &refereeUser.ExpireAt,
+		TrafficLimit:     &trafficLimit,
+		PurchaseID:       &purchase.ID,
+	})
+	err = s.referralRepository.MarkBonusGranted(ctx, referee.ID)
 	if err != nil {
 		return err
 	}
 	slog.Info("Granted referral bonus", "customer_id", utils.MaskHalfInt64(refereeCustomer.ID))
-	_, err = s.telegramBot.SendMessage(ctxReferee, &bot.SendMessageParams{
+	if err := s.referralService.EvaluateMilestones(ctx, refereeCustomer.TelegramID); err != nil {
+		slog.Error("Error evaluating referral milestones", "error", err)
+	}
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:    refereeCustomer.TelegramID,
 		ParseMode: models.ParseModeHTML,
 		Text:      s.translation.GetText(refereeCustomer.Language, "referral_bonus_granted"),
@@ -152,11 +335,97 @@ func (s PaymentService) ProcessPurchaseById(ctx context.Context, purchaseId int6
 			InlineKeyboard: s.createConnectKeyboard(refereeCustomer),
 		},
 	})
-	slog.Info("purchase processed", "purchase_id", utils.MaskHalfInt64(purchase.ID), "type", purchase.InvoiceType, "customer_id", utils.MaskHalfInt64(customer.ID))
+	if err != nil {
+		slog.Error("Error sending referral bonus message", "error", err)
+	}
+	return nil
+}
+
+const (
+	provisioningBatch       = 10
+	provisioningLease       = 5 * time.Minute
+	provisioningMaxAttempts = 10
+	provisioningBaseDelay   = 30 * time.Second
+	provisioningMaxDelay    = time.Hour
+)
+
+// provisioningBackoff doubles the delay after every attempt: 30s, 1m, 2m, ... up to an hour.
+func provisioningBackoff(attempts int) time.Duration {
+	delay := provisioningBaseDelay
+	for i := 1; i < attempts && delay < provisioningMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, provisioningMaxDelay)
+}
+
+// ProcessProvisioningJobs retries due provisioning jobs. After provisioningMaxAttempts the job is failed, the
+// admins are alerted through the event feed and the customer is told that support is on it. Paid purchases left
+// without a job, when queueing it after the payment failed, are queued first; the lease keeps it clear of a
+// payment still being processed.
+func (s PaymentService) ProcessProvisioningJobs(ctx context.Context) error {
+	orphaned, err := s.jobRepository.EnqueueOrphaned(ctx, provisioningLease)
+	if err != nil {
+		return err
+	}
+	if orphaned > 0 {
+		slog.Warn("Queued paid purchases without a provisioning job", "count", orphaned)
+	}
+
+	jobs, err := s.jobRepository.Claim(ctx, provisioningBatch, provisioningLease)
+	if err != nil {
+		return err
+	}
 
+	for _, job := range jobs {
+		if err := s.runProvisioningJob(ctx, job); err != nil {
+			slog.Error("Error running provisioning job", "job_id", job.ID, "error", err)
+		}
+	}
 	return nil
 }
 
+func (s PaymentService) runProvisioningJob(ctx context.Context, job database.ProvisioningJob) error {
+	purchase, err := s.purchaseRepository.FindById(ctx, job.PurchaseID)
+	if err != nil {
+		return err
+	}
+	if purchase == nil || purchase.Status != database.PurchaseStatusPaidUnprovisioned {
+		return s.jobRepository.MarkDone(ctx, job.ID)
+	}
+	customer, err := s.customerRepository.FindById(ctx, purchase.CustomerID)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		return s.jobRepository.MarkFailed(ctx, job.ID, ErrCustomerNotFound.Error())
+	}
+	if customer.IsBanned {
+		s.notifier.ProvisioningError(purchase.ID, customer.TelegramID, database.ErrCustomerBanned)
+		return s.jobRepository.MarkFailed(ctx, job.ID, database.ErrCustomerBanned.Error())
+	}
+
+	err = s.provisionPurchase(ctx, purchase, customer)
+	if err == nil {
+		slog.Info("Provisioning job completed", "job_id", job.ID, "attempts", job.Attempts)
+		return s.jobRepository.MarkDone(ctx, job.ID)
+	}
+
+	if job.Attempts < provisioningMaxAttempts {
+		return s.jobRepository.Retry(ctx, job.ID, time.Now().Add(provisioningBackoff(job.Attempts)), err.Error())
+	}
+
+	s.notifier.ProvisioningError(purchase.ID, customer.TelegramID, err)
+	_, sendErr := s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text:      s.translation.GetText(customer.Language, "payment_activation_delayed"),
+	})
+	if sendErr != nil {
+		slog.Error("Error sending activation delayed message", "error", sendErr)
+	}
+	return s.jobRepository.MarkFailed(ctx, job.ID, err.Error())
+}
+
 func (s PaymentService) createConnectKeyboard(customer *database.Customer) [][]models.InlineKeyboardButton {
 	var inlineCustomerKeyboard [][]models.InlineKeyboardButton
 
@@ -179,6 +448,16 @@ func (s PaymentService) createConnectKeyboard(customer *database.Customer) [][]m
 }
 
 func (s PaymentService) CreatePurchase(ctx context.Context, amount float64, months int, customer *database.Customer, invoiceType database.InvoiceType) (url string, purchaseId int64, err error) {
+	defer func() {
+		if err == nil {
+			metrics.PurchaseCreated(string(invoiceType))
+		}
+	}()
+
+	if invoiceType != database.InvoiceTypeTribute {
+		amount = s.applyDiscount(ctx, amount, customer)
+	}
+
 	switch invoiceType {
 	case database.InvoiceTypeCrypto:
 		return s.createCryptoInvoice(ctx, amount, months, customer)
@@ -193,8 +472,31 @@ func (s PaymentService) CreatePurchase(ctx context.Context, amount float64, mont
 	}
 }
 
+// ActiveDiscount returns the win-back discount the customer can use now, nil when there is none.
+func (s PaymentService) ActiveDiscount(ctx context.Context, customer *database.Customer) (*database.WinbackOffer, error) {
+	return s.winbackRepository.FindActiveDiscount(ctx, customer.ID)
+}
+
+// applyDiscount lowers the amount by the active win-back discount of the customer. Amounts are whole units in every
+// currency, so the result is rounded and stays at least 1.
+func (s PaymentService) applyDiscount(ctx context.Context, amount float64, customer *database.Customer) float64 {
+	offer, err := s.ActiveDiscount(ctx, customer)
+	if err != nil {
+		slog.Error("Error finding winback discount", "error", err)
+		return amount
+	}
+	if offer == nil {
+		return amount
+	}
+	return math.Max(1, math.Round(amount*float64(100-offer.DiscountPercent)/100))
+}
+
 var ErrCustomerNotFound = errors.New("customer not found")
 
+// ErrTrialUsed is returned by ActivateTrial when the customer has already used the trial or has a running
+// subscription.
+var ErrTrialUsed = errors.New("trial already used")
+
 func (s PaymentService) CancelTributePurchase(ctx context.Context, telegramId int64) error {
 	slog.Info("Canceling tribute purchase", "telegram_id", utils.MaskHalfInt64(telegramId))
 	customer, err := s.customerRepository.FindByTelegramId(ctx, telegramId)
@@ -211,29 +513,51 @@ func (s PaymentService) CancelTributePurchase(ctx context.Context, telegramId in
 	if tributePurchase == nil {
 		return errors.New("tribute purchase not found")
 	}
-	expireAt, err := s.remnawaveClient.DecreaseSubscription(ctx, telegramId, config.TrafficLimit(), -tributePurchase.Month*config.DaysInMonth())
+	panel := s.panels.Get(customer.Panel)
+	panelUser, err := panel.FindUser(ctx, telegramId, customer.PanelUUID)
+	if err != nil {
+		return err
+	}
+	if panelUser == nil {
+		return errors.New("user in remnawave not found")
+	}
+	user, err := panel.SetExpire(ctx, telegramId, customer.PanelUUID, config.TrafficLimit(), remnawave.DecreasedExpire(panelUser.ExpireAt, tributePurchase.Month*config.DaysInMonth()))
 	if err != nil {
 		return err
 	}
+	expireAt := &user.ExpireAt
 
 	if err := s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
 		"expire_at": expireAt,
 	}); err != nil {
 		return err
 	}
+	trafficLimit := int64(config.TrafficLimit())
+	s.eventRepository.Record(ctx, database.SubscriptionEvent{
+		CustomerID:       customer.ID,
+		TelegramID:       customer.TelegramID,
+		Source:           database.SubscriptionEventTributeCancel,
+		Actor:            database.ActorTribute,
+		PreviousExpireAt: customer.ExpireAt,
+		NewExpireAt:      expireAt,
+		TrafficLimit:     &trafficLimit,
+		PurchaseID:       &tributePurchase.ID,
+	})
 
 	if err := s.purchaseRepository.UpdateFields(ctx, tributePurchase.ID, map[string]interface{}{
 		"status": database.PurchaseStatusCancel,
 	}); err != nil {
 		return err
 	}
+	s.notifier.Refund(tributePurchase, customer)
+	metrics.PurchaseCancelled(string(tributePurchase.InvoiceType))
 	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:    telegramId,
 		ParseMode: models.ParseModeHTML,
 		Text:      s.translation.GetText(customer.Language, "tribute_cancelled"),
 	})
 	if err != nil {
-		slog.Error("Error sending message about tribute cancelled", err, "telegram_id", utils.MaskHalfInt64(telegramId))
+		slog.Error("Error sending message about tribute cancelled", "error", err, "telegram_id", utils.MaskHalfInt64(telegramId))
 	}
 	slog.Info("Canceled tribute purchase", "purchase_id", utils.MaskHalfInt64(tributePurchase.ID), "telegram_id", utils.MaskHalfInt64(telegramId))
 	return nil
@@ -249,7 +573,7 @@ func (s PaymentService) createCryptoInvoice(ctx context.Context, amount float64,
 		Month:       months,
 	})
 	if err != nil {
-		slog.Error("Error creating purchase", err)
+		slog.Error("Error creating purchase", "error", err)
 		return "", 0, err
 	}
 
@@ -264,7 +588,7 @@ func (s PaymentService) createCryptoInvoice(ctx context.Context, amount float64,
 		PaidBtnUrl:     config.BotURL(),
 	})
 	if err != nil {
-		slog.Error("Error creating invoice", err)
+		slog.Error("Error creating invoice", "error", err)
 		return "", 0, err
 	}
 
@@ -276,7 +600,7 @@ func (s PaymentService) createCryptoInvoice(ctx context.Context, amount float64,
 
 	err = s.purchaseRepository.UpdateFields(ctx, purchaseId, updates)
 	if err != nil {
-		slog.Error("Error updating purchase", err)
+		slog.Error("Error updating purchase", "error", err)
 		return "", 0, err
 	}
 
@@ -293,13 +617,13 @@ func (s PaymentService) createYookasaInvoice(ctx context.Context, amount float64
 		Month:       months,
 	})
 	if err != nil {
-		slog.Error("Error creating purchase", err)
+		slog.Error("Error creating purchase", "error", err)
 		return "", 0, err
 	}
 
 	invoice, err := s.yookasaClient.CreateInvoice(ctx, int(amount), months, customer.ID, purchaseId)
 	if err != nil {
-		slog.Error("Error creating invoice", err)
+		slog.Error("Error creating invoice", "error", err)
 		return "", 0, err
 	}
 
@@ -311,7 +635,7 @@ func (s PaymentService) createYookasaInvoice(ctx context.Context, amount float64
 
 	err = s.purchaseRepository.UpdateFields(ctx, purchaseId, updates)
 	if err != nil {
-		slog.Error("Error updating purchase", err)
+		slog.Error("Error updating purchase", "error", err)
 		return "", 0, err
 	}
 
@@ -328,7 +652,7 @@ func (s PaymentService) createTelegramInvoice(ctx context.Context, amount float6
 		Month:       months,
 	})
 	if err != nil {
-		slog.Error("Error creating purchase", err)
+		slog.Error("Error creating purchase", "error", err)
 		return "", 0, nil
 	}
 
@@ -351,7 +675,7 @@ func (s PaymentService) createTelegramInvoice(ctx context.Context, amount float6
 
 	err = s.purchaseRepository.UpdateFields(ctx, purchaseId, updates)
 	if err != nil {
-		slog.Error("Error updating purchase", err)
+		slog.Error("Error updating purchase", "error", err)
 		return "", 0, err
 	}
 
@@ -364,32 +688,65 @@ func (s PaymentService) ActivateTrial(ctx context.Context, telegramId int64) (st
 	}
 	customer, err := s.customerRepository.FindByTelegramId(ctx, telegramId)
 	if err != nil {
-		slog.Error("Error finding customer", err)
+		slog.Error("Error finding customer", "error", err)
 		return "", err
 	}
 	if customer == nil {
 		return "", fmt.Errorf("customer %d not found", telegramId)
 	}
-	user, err := s.remnawaveClient.CreateOrUpdateUser(ctx, customer.ID, telegramId, config.TrialTrafficLimit(), config.TrialDays())
+	if !customer.CanTakeTrial(time.Now()) {
+		return "", ErrTrialUsed
+	}
+	claimed, err := s.customerRepository.ClaimTrial(ctx, customer.ID, database.TrialSourceBot)
 	if err != nil {
-		slog.Error("Error creating user", err)
+		return "", err
+	}
+	if !claimed {
+		return "", ErrTrialUsed
+	}
+	user, err := s.panels.Get(customer.Panel).CreateOrUpdateUser(ctx, customer.ID, telegramId, customer.PanelUUID, config.TrialTrafficLimit(), config.TrialDays())
+	if err != nil {
+		slog.Error("Error creating user", "error", err)
+		s.releaseTrial(ctx, customer)
 		return "", err
 	}
 
 	customerFilesToUpdate := map[string]interface{}{
 		"subscription_link": user.GetSubscriptionUrl(),
 		"expire_at":         user.GetExpireAt(),
+		"panel_uuid":        user.UUID,
+		"panel_short_uuid":  user.ShortUuid,
+		"is_trial":          true,
 	}
 
 	err = s.customerRepository.UpdateFields(ctx, customer.ID, customerFilesToUpdate)
 	if err != nil {
+		s.releaseTrial(ctx, customer)
 		return "", err
 	}
+	trafficLimit := int64(config.TrialTrafficLimit())
+	s.eventRepository.Record(ctx, database.SubscriptionEvent{
+		CustomerID:       customer.ID,
+		TelegramID:       customer.TelegramID,
+		Source:           database.SubscriptionEventTrial,
+		Actor:            database.ActorCustomer(customer.TelegramID),
+		PreviousExpireAt: customer.ExpireAt,
+		NewExpireAt:      &user.ExpireAt,
+		TrafficLimit:     &trafficLimit,
+	})
+	s.notifier.TrialActivated(customer)
 
 	return user.GetSubscriptionUrl(), nil
 
 }
 
+// releaseTrial gives the trial back when the activation failed, so the customer can try again.
+func (s PaymentService) releaseTrial(ctx context.Context, customer *database.Customer) {
+	if err := s.customerRepository.ResetTrial(ctx, customer.ID); err != nil {
+		slog.Error("Error releasing trial", "error", err)
+	}
+}
+
 func (s PaymentService) CancelYookassaPayment(purchaseId int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -398,7 +755,7 @@ func (s PaymentService) CancelYookassaPayment(purchaseId int64) error {
 		return err
 	}
 	if purchase == nil {
-		return fmt.Errorf("purchase with crypto invoice id %d not found", utils.MaskHalfInt64(purchaseId))
+		return fmt.Errorf("purchase with crypto invoice id %s not found", utils.MaskHalfInt64(purchaseId))
 	}
 
 	purchaseFieldsToUpdate := map[string]interface{}{
@@ -409,6 +766,7 @@ func (s PaymentService) CancelYookassaPayment(purchaseId int64) error {
 	if err != nil {
 		return err
 	}
+	metrics.PurchaseCancelled(string(purchase.InvoiceType))
 
 	return nil
 }
@@ -423,7 +781,7 @@ func (s PaymentService) createTributeInvoice(ctx context.Context, amount float64
 		Month:       months,
 	})
 	if err != nil {
-		slog.Error("Error creating purchase", err)
+		slog.Error("Error creating purchase", "error", err)
 		return "", 0, err
 	}
 
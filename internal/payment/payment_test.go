@@ -0,0 +1,574 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+	"github.com/go-telegram/bot"
+	"github.com/google/uuid"
+	"remnawave-tg-shop-bot/internal/cache"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/notifier"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/translation"
+)
+
+// The tests run on in-memory repositories, the fake panel and a fake Telegram Bot API, see fakes_test.go.
+
+const (
+	testTrafficLimit      = 100 << 30
+	testTrialTrafficLimit = 10 << 30
+	testTrialDays         = 3
+	testDaysInMonth       = 30
+)
+
+func TestMain(m *testing.M) {
+	for key, value := range map[string]string{
+		"DISABLE_ENV_FILE":    "true",
+		"ADMIN_TELEGRAM_ID":   "1",
+		"TELEGRAM_TOKEN":      "123:test",
+		"TRIAL_TRAFFIC_LIMIT": "10",
+		"TRIAL_DAYS":          "3",
+		"DAYS_IN_MONTH":       "30",
+		"PRICE_1":             "100",
+		"PRICE_3":             "250",
+		"PRICE_6":             "450",
+		"PRICE_12":            "800",
+		"REMNAWAVE_URL":       "http://localhost",
+		"REMNAWAVE_TOKEN":     "test",
+		"DATABASE_URL":        "postgres://localhost/unused",
+		"TRAFFIC_LIMIT":       "100",
+		"REFERRAL_DAYS":       "7",
+	} {
+		os.Setenv(key, value)
+	}
+	config.InitConfig()
+	if err := translation.GetInstance().InitTranslations("../../translations"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+type testEnv struct {
+	panel    *remnawave.FakePanel
+	telegram *telegramServer
+	service  *PaymentService
+
+	customers  *fakeCustomerRepository
+	purchases  *fakePurchaseRepository
+	referrals  *fakeReferralRepository
+	events     *fakeEventRepository
+	jobs       *fakeJobRepository
+	winback    *fakeWinbackRepository
+	milestones *fakeMilestones
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	telegram := newTelegramServer(t)
+	b, err := bot.New(config.TelegramToken(), bot.WithServerURL(telegram.URL), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tm := translation.GetInstance()
+	panel := remnawave.NewFakePanel(uuid.New())
+	panels := remnawave.NewPanels()
+	panels.Add("default", panel)
+	purchases := newFakePurchaseRepository()
+	env := &testEnv{
+		panel:      panel,
+		telegram:   telegram,
+		customers:  newFakeCustomerRepository(),
+		purchases:  purchases,
+		referrals:  &fakeReferralRepository{},
+		events:     &fakeEventRepository{},
+		jobs:       &fakeJobRepository{purchases: purchases},
+		winback:    &fakeWinbackRepository{},
+		milestones: &fakeMilestones{},
+	}
+	env.service = NewPaymentService(tm, env.purchases, panels, env.customers, b, nil, nil, env.referrals, env.milestones, env.events,
+		env.jobs, env.winback, notifier.NewNotifier(b, tm), cache.NewCache(time.Minute), remnawave.NewUsageCache(panels, time.Minute))
+	return env
+}
+
+func (e *testEnv) createCustomer(t *testing.T) *database.Customer {
+	t.Helper()
+	return e.customers.Create(&database.Customer{
+		TelegramID: rand.Int63n(1_000_000_000_000) + 1_000_000_000,
+		Language:   "en",
+	})
+}
+
+func (e *testEnv) createPurchase(t *testing.T, customer *database.Customer, invoiceType database.InvoiceType, month int) int64 {
+	t.Helper()
+	id, err := e.purchases.Create(context.Background(), &database.Purchase{
+		Amount:      100,
+		CustomerID:  customer.ID,
+		Month:       month,
+		Currency:    "RUB",
+		Status:      database.PurchaseStatusPending,
+		InvoiceType: invoiceType,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func (e *testEnv) reloadCustomer(t *testing.T, customer *database.Customer) *database.Customer {
+	t.Helper()
+	reloaded, err := e.customers.FindById(context.Background(), customer.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reloaded
+}
+
+func (e *testEnv) purchaseStatus(t *testing.T, purchaseID int64) database.PurchaseStatus {
+	t.Helper()
+	purchase, err := e.purchases.FindById(context.Background(), purchaseID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return purchase.Status
+}
+
+func TestProcessPurchaseByIdCreatesPanelUser(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	customer := env.createCustomer(t)
+	purchaseID := env.createPurchase(t, customer, database.InvoiceTypeCrypto, 3)
+
+	if err := env.service.ProcessPurchaseById(ctx, purchaseID); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := env.purchaseStatus(t, purchaseID); status != database.PurchaseStatusPaid {
+		t.Errorf("purchase status = %s, want %s", status, database.PurchaseStatusPaid)
+	}
+	updated := env.reloadCustomer(t, customer)
+	if updated.PanelUUID == nil {
+		t.Fatal("panel uuid is not stored")
+	}
+	user := env.panel.User(*updated.PanelUUID)
+	if user == nil {
+		t.Fatal("panel user is not created")
+	}
+	assertAbout(t, user.ExpireAt, time.Now().AddDate(0, 0, 3*testDaysInMonth))
+	if updated.ExpireAt == nil || !updated.ExpireAt.Equal(user.ExpireAt) {
+		t.Errorf("customer expire = %v, want %v", updated.ExpireAt, user.ExpireAt)
+	}
+	if updated.SubscriptionLink == nil || *updated.SubscriptionLink != user.SubscriptionUrl {
+		t.Errorf("customer link = %v, want %s", updated.SubscriptionLink, user.SubscriptionUrl)
+	}
+	if limit, _ := user.TrafficLimitBytes.Get(); limit != testTrafficLimit {
+		t.Errorf("traffic limit = %d, want %d", limit, testTrafficLimit)
+	}
+	if !env.telegram.sent(customer.TelegramID, translation.GetInstance().GetText("en", "subscription_activated")) {
+		t.Error("activation message is not sent")
+	}
+}
+
+func TestProcessPurchaseByIdExtendsActiveSubscription(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	customer := env.createCustomer(t)
+	expireAt := time.Now().UTC().AddDate(0, 0, 10).Truncate(time.Second)
+	env.panel.AddUser(remapi.UserDto{
+		Username:   "manual",
+		TelegramId: remapi.NewNilInt(int(customer.TelegramID)),
+		ExpireAt:   expireAt,
+	})
+	purchaseID := env.createPurchase(t, customer, database.InvoiceTypeYookasa, 1)
+
+	if err := env.service.ProcessPurchaseById(ctx, purchaseID); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := env.reloadCustomer(t, customer)
+	assertAbout(t, *updated.ExpireAt, expireAt.AddDate(0, 0, testDaysInMonth))
+}
+
+func TestProcessPurchaseByIdIsIdempotent(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	customer := env.createCustomer(t)
+	purchaseID := env.createPurchase(t, customer, database.InvoiceTypeTelegram, 1)
+
+	for i := 0; i < 2; i++ {
+		if err := env.service.ProcessPurchaseById(ctx, purchaseID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	updated := env.reloadCustomer(t, customer)
+	assertAbout(t, *updated.ExpireAt, time.Now().AddDate(0, 0, testDaysInMonth))
+}
+
+func TestProcessPurchaseByIdQueuesWhenPanelIsDown(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	customer := env.createCustomer(t)
+	purchaseID := env.createPurchase(t, customer, database.InvoiceTypeCrypto, 1)
+	env.panel.SetError(errors.New("connection refused"))
+
+	if err := env.service.ProcessPurchaseById(ctx, purchaseID); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := env.purchaseStatus(t, purchaseID); status != database.PurchaseStatusPaidUnprovisioned {
+		t.Errorf("purchase status = %s, want %s", status, database.PurchaseStatusPaidUnprovisioned)
+	}
+	job := env.jobs.find(purchaseID)
+	if job == nil || job.Status != database.ProvisioningJobPending || job.Attempts != 1 {
+		t.Errorf("job = %+v, want a pending job with 1 attempt", job)
+	}
+	if !env.telegram.sent(customer.TelegramID, translation.GetInstance().GetText("en", "payment_received_activating")) {
+		t.Error("activating message is not sent")
+	}
+	if updated := env.reloadCustomer(t, customer); updated.ExpireAt != nil {
+		t.Errorf("customer expire = %v before provisioning", updated.ExpireAt)
+	}
+}
+
+func TestProcessPurchaseByIdQueuesWhenDatabaseFails(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	customer := env.createCustomer(t)
+	purchaseID := env.createPurchase(t, customer, database.InvoiceTypeYookasa, 1)
+	env.purchases.provisionErr = errors.New("connection reset")
+
+	if err := env.service.ProcessPurchaseById(ctx, purchaseID); err != nil {
+		t.Fatal(err)
+	}
+	if status := env.purchaseStatus(t, purchaseID); status != database.PurchaseStatusPaidUnprovisioned {
+		t.Errorf("purchase status = %s, want %s", status, database.PurchaseStatusPaidUnprovisioned)
+	}
+	if job := env.jobs.find(purchaseID); job == nil {
+		t.Fatal("provisioning job is not queued")
+	}
+
+	// The panel user was already extended. The retry sets it to the same date instead of adding the month again.
+	env.purchases.provisionErr = nil
+	if err := env.service.ProcessProvisioningJobs(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status := env.purchaseStatus(t, purchaseID); status != database.PurchaseStatusPaid {
+		t.Errorf("purchase status = %s, want %s", status, database.PurchaseStatusPaid)
+	}
+	if job := env.jobs.find(purchaseID); job.Status != database.ProvisioningJobDone {
+		t.Errorf("job status = %s, want %s", job.Status, database.ProvisioningJobDone)
+	}
+	updated := env.reloadCustomer(t, customer)
+	assertAbout(t, *updated.ExpireAt, time.Now().AddDate(0, 0, testDaysInMonth))
+	assertAbout(t, env.panel.User(*updated.PanelUUID).ExpireAt, time.Now().AddDate(0, 0, testDaysInMonth))
+}
+
+func TestProvisioningJobsQueuePurchasesWithoutJob(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	customer := env.createCustomer(t)
+	purchaseID := env.createPurchase(t, customer, database.InvoiceTypeCrypto, 1)
+	env.panel.SetError(errors.New("connection refused"))
+	env.jobs.err = errors.New("connection reset")
+
+	if err := env.service.ProcessPurchaseById(ctx, purchaseID); err == nil {
+		t.Fatal("expected the queue error")
+	}
+	if job := env.jobs.find(purchaseID); job != nil {
+		t.Fatalf("job = %+v, want none", job)
+	}
+
+	env.panel.SetError(nil)
+	env.jobs.err = nil
+	paidAt := time.Now().Add(-2 * provisioningLease)
+	env.purchases.purchases[purchaseID].PaidAt = &paidAt
+	if err := env.service.ProcessProvisioningJobs(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status := env.purchaseStatus(t, purchaseID); status != database.PurchaseStatusPaid {
+		t.Errorf("purchase status = %s, want %s", status, database.PurchaseStatusPaid)
+	}
+	if job := env.jobs.find(purchaseID); job == nil || job.Status != database.ProvisioningJobDone {
+		t.Errorf("job = %+v, want a done job", job)
+	}
+}
+
+func TestProcessPurchaseByIdBannedCustomer(t *testing.T) {
+	env := newTestEnv(t)
+	customer := env.customers.Create(&database.Customer{TelegramID: 42, Language: "en", IsBanned: true})
+	purchaseID := env.createPurchase(t, customer, database.InvoiceTypeCrypto, 1)
+
+	if err := env.service.ProcessPurchaseById(context.Background(), purchaseID); err != nil {
+		t.Fatal(err)
+	}
+	if status := env.purchaseStatus(t, purchaseID); status != database.PurchaseStatusPaidUnprovisioned {
+		t.Errorf("purchase status = %s, want %s", status, database.PurchaseStatusPaidUnprovisioned)
+	}
+	if updated := env.reloadCustomer(t, customer); updated.PanelUUID != nil {
+		t.Error("panel user is created for a banned customer")
+	}
+}
+
+func TestProcessPurchaseByIdGrantsReferralBonus(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	referrer := env.createCustomer(t)
+	customer := env.createCustomer(t)
+	env.referrals.Create(referrer.TelegramID, customer.TelegramID)
+
+	for i := 0; i < 2; i++ {
+		if err := env.service.ProcessPurchaseById(ctx, env.createPurchase(t, customer, database.InvoiceTypeCrypto, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	updated := env.reloadCustomer(t, referrer)
+	if updated.ExpireAt == nil {
+		t.Fatal("referrer got no bonus")
+	}
+	assertAbout(t, *updated.ExpireAt, time.Now().AddDate(0, 0, config.GetReferralDays()))
+	if sources := env.events.sources(referrer.ID); len(sources) != 1 || sources[0] != database.SubscriptionEventReferralBonus {
+		t.Errorf("referrer events = %v, want one %s", sources, database.SubscriptionEventReferralBonus)
+	}
+	if evaluated := env.milestones.evaluated[referrer.TelegramID]; evaluated != 1 {
+		t.Errorf("milestones evaluated %d times, want 1", evaluated)
+	}
+}
+
+func TestProcessPurchaseByIdUnknownPurchase(t *testing.T) {
+	env := newTestEnv(t)
+	if err := env.service.ProcessPurchaseById(context.Background(), -1); err == nil {
+		t.Error("expected an error for a missing purchase")
+	}
+}
+
+func TestActivateTrial(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	customer := env.createCustomer(t)
+
+	link, err := env.service.ActivateTrial(ctx, customer.TelegramID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated := env.reloadCustomer(t, customer)
+	if updated.PanelUUID == nil {
+		t.Fatal("panel uuid is not stored")
+	}
+	user := env.panel.User(*updated.PanelUUID)
+	if link != user.SubscriptionUrl {
+		t.Errorf("link = %q, want %q", link, user.SubscriptionUrl)
+	}
+	if limit, _ := user.TrafficLimitBytes.Get(); limit != testTrialTrafficLimit {
+		t.Errorf("traffic limit = %d, want %d", limit, testTrialTrafficLimit)
+	}
+	assertAbout(t, *updated.ExpireAt, time.Now().AddDate(0, 0, testTrialDays))
+	if updated.TrialUsedAt == nil || updated.TrialSource == nil || *updated.TrialSource != database.TrialSourceBot {
+		t.Errorf("trial used = %v, source = %v, want it marked by the bot", updated.TrialUsedAt, updated.TrialSource)
+	}
+
+	if _, err := env.service.ActivateTrial(ctx, customer.TelegramID); !errors.Is(err, ErrTrialUsed) {
+		t.Errorf("second activation error = %v, want ErrTrialUsed", err)
+	}
+}
+
+func TestActivateTrialAfterReset(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	customer := env.createCustomer(t)
+
+	if _, err := env.service.ActivateTrial(ctx, customer.TelegramID); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.customers.ResetTrial(ctx, customer.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.service.ActivateTrial(ctx, customer.TelegramID); !errors.Is(err, ErrTrialUsed) {
+		t.Errorf("activation during the running trial error = %v, want ErrTrialUsed", err)
+	}
+
+	// The trial runs out both on the panel and in the bot.
+	expired := time.Now().Add(-time.Hour)
+	trial := env.reloadCustomer(t, customer)
+	if _, err := env.panel.SetExpire(ctx, customer.TelegramID, trial.PanelUUID, testTrialTrafficLimit, expired); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.customers.UpdateFields(ctx, customer.ID, map[string]interface{}{"expire_at": expired}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.service.ActivateTrial(ctx, customer.TelegramID); err != nil {
+		t.Fatalf("activation after the reset: %v", err)
+	}
+	updated := env.reloadCustomer(t, customer)
+	if updated.TrialUsedAt == nil {
+		t.Error("trial is not marked as used again")
+	}
+	assertAbout(t, *updated.ExpireAt, time.Now().AddDate(0, 0, testTrialDays))
+}
+
+func TestActivateTrialUnknownCustomer(t *testing.T) {
+	env := newTestEnv(t)
+	if _, err := env.service.ActivateTrial(context.Background(), -1); err == nil {
+		t.Error("expected an error for a missing customer")
+	}
+}
+
+func TestActivateTrialPanelError(t *testing.T) {
+	env := newTestEnv(t)
+	customer := env.createCustomer(t)
+	env.panel.SetError(errors.New("connection refused"))
+
+	if _, err := env.service.ActivateTrial(context.Background(), customer.TelegramID); err == nil {
+		t.Fatal("expected the panel error")
+	}
+	if updated := env.reloadCustomer(t, customer); updated.ExpireAt != nil || updated.SubscriptionLink != nil || updated.TrialUsedAt != nil {
+		t.Error("customer is changed although the panel failed")
+	}
+}
+
+func TestCancelTributePurchase(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	customer := env.createCustomer(t)
+	expireAt := time.Now().UTC().AddDate(0, 0, 10).Truncate(time.Second)
+	env.panel.AddUser(remapi.UserDto{
+		Username:   "manual",
+		TelegramId: remapi.NewNilInt(int(customer.TelegramID)),
+		ExpireAt:   expireAt,
+	})
+	purchaseID := env.createPurchase(t, customer, database.InvoiceTypeTribute, 1)
+	if err := env.service.ProcessPurchaseById(ctx, purchaseID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.service.CancelTributePurchase(ctx, customer.TelegramID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the cancelled month is taken back, the days the customer had before stay.
+	updated := env.reloadCustomer(t, customer)
+	assertAbout(t, *updated.ExpireAt, expireAt)
+	if user := env.panel.User(*updated.PanelUUID); !user.ExpireAt.Equal(*updated.ExpireAt) {
+		t.Errorf("panel expire = %v, want %v", user.ExpireAt, *updated.ExpireAt)
+	}
+}
+
+func TestCancelTributePurchaseWithoutPurchase(t *testing.T) {
+	env := newTestEnv(t)
+	customer := env.createCustomer(t)
+
+	if err := env.service.CancelTributePurchase(context.Background(), customer.TelegramID); err == nil {
+		t.Error("expected an error without a tribute purchase")
+	}
+	if err := env.service.CancelTributePurchase(context.Background(), -1); !errors.Is(err, ErrCustomerNotFound) {
+		t.Errorf("err = %v, want %v", err, ErrCustomerNotFound)
+	}
+}
+
+func TestWinbackDiscountAndConversion(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	customer := env.createCustomer(t)
+	err := env.customers.UpdateFields(ctx, customer.ID, map[string]interface{}{"expire_at": time.Now().AddDate(0, 0, -7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	customer = env.reloadCustomer(t, customer)
+
+	discountExpiresAt := time.Now().Add(time.Hour)
+	offer := env.winback.Add(database.WinbackOffer{CustomerID: customer.ID, Step: 1, ExpireAt: *customer.ExpireAt, DiscountPercent: 20, DiscountExpiresAt: &discountExpiresAt})
+
+	if amount := env.service.applyDiscount(ctx, 250, customer); amount != 200 {
+		t.Errorf("discounted amount = %v, want 200", amount)
+	}
+
+	purchaseID := env.createPurchase(t, customer, database.InvoiceTypeCrypto, 1)
+	if err := env.service.ProcessPurchaseById(ctx, purchaseID); err != nil {
+		t.Fatal(err)
+	}
+
+	if offer.PurchaseID == nil || *offer.PurchaseID != purchaseID {
+		t.Errorf("converted purchase = %v, want %d", offer.PurchaseID, purchaseID)
+	}
+	if amount := env.service.applyDiscount(ctx, 250, customer); amount != 250 {
+		t.Errorf("amount after conversion = %v, want 250", amount)
+	}
+}
+
+func TestProvisioningBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 4, want: 4 * time.Minute},
+		{attempts: 7, want: 32 * time.Minute},
+		{attempts: 8, want: time.Hour},
+		{attempts: 50, want: time.Hour},
+	}
+	for _, tt := range tests {
+		if got := provisioningBackoff(tt.attempts); got != tt.want {
+			t.Errorf("provisioningBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func assertAbout(t *testing.T, got, want time.Time) {
+	t.Helper()
+	if diff := got.Sub(want); diff < -time.Minute || diff > time.Minute {
+		t.Errorf("time = %v, want about %v", got, want)
+	}
+}
+
+// telegramServer answers Bot API calls and remembers the texts sent to each chat.
+type telegramServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	messages map[string][]string
+}
+
+func newTelegramServer(t *testing.T) *telegramServer {
+	s := &telegramServer{messages: make(map[string][]string)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseMultipartForm(1 << 20)
+		w.Header().Set("Content-Type", "application/json")
+		switch path.Base(r.URL.Path) {
+		case "sendMessage":
+			s.mu.Lock()
+			chatID := r.FormValue("chat_id")
+			s.messages[chatID] = append(s.messages[chatID], r.FormValue("text"))
+			s.mu.Unlock()
+			_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":1,"type":"private"}}}`))
+		default:
+			_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *telegramServer) sent(chatID int64, text string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, message := range s.messages[strconv.FormatInt(chatID, 10)] {
+		if message == text {
+			return true
+		}
+	}
+	return false
+}
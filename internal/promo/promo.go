@@ -0,0 +1,103 @@
+package promo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+	"time"
+)
+
+var ErrPromoCodeNotFound = errors.New("promo code not found")
+
+type Service struct {
+	promoCodeRepository *database.PromoCodeRepository
+	customerRepository  *database.CustomerRepository
+	eventRepository     *database.SubscriptionEventRepository
+	panels              *remnawave.Panels
+}
+
+func NewService(promoCodeRepository *database.PromoCodeRepository, customerRepository *database.CustomerRepository, eventRepository *database.SubscriptionEventRepository, panels *remnawave.Panels) *Service {
+	return &Service{
+		promoCodeRepository: promoCodeRepository,
+		customerRepository:  customerRepository,
+		eventRepository:     eventRepository,
+		panels:              panels,
+	}
+}
+
+// Create registers a new promo code. maxActivations = 0 means unlimited, validDays = 0 means no expiration.
+func (s Service) Create(ctx context.Context, code string, days, maxActivations, validDays int) (*database.PromoCode, error) {
+	promo := &database.PromoCode{
+		Code:           code,
+		Days:           days,
+		MaxActivations: maxActivations,
+	}
+	if validDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, validDays)
+		promo.ExpiresAt = &expiresAt
+	}
+	return s.promoCodeRepository.Create(ctx, promo)
+}
+
+func (s Service) List(ctx context.Context, limit, offset int) ([]database.PromoCode, error) {
+	return s.promoCodeRepository.FindLatest(ctx, limit, offset)
+}
+
+func (s Service) SetActive(ctx context.Context, code string, active bool) error {
+	return s.promoCodeRepository.SetActive(ctx, code, active)
+}
+
+// Redeem applies the promo code to the customer and extends the subscription in remnawave.
+func (s Service) Redeem(ctx context.Context, customer *database.Customer, code string) (*database.PromoCode, error) {
+	if customer.IsBanned {
+		return nil, database.ErrCustomerBanned
+	}
+	promo, err := s.promoCodeRepository.FindByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if promo == nil {
+		return nil, ErrPromoCodeNotFound
+	}
+
+	if err := s.promoCodeRepository.Activate(ctx, promo.ID, customer.ID); err != nil {
+		return nil, err
+	}
+
+	user, err := s.panels.Get(customer.Panel).CreateOrUpdateUser(ctx, customer.ID, customer.TelegramID, customer.PanelUUID, config.TrafficLimit(), promo.Days)
+	if err != nil {
+		if releaseErr := s.promoCodeRepository.Release(ctx, promo.ID, customer.ID); releaseErr != nil {
+			slog.Error("Error releasing promo code activation", "error", releaseErr)
+		}
+		return nil, err
+	}
+
+	err = s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
+		"subscription_link": user.GetSubscriptionUrl(),
+		"expire_at":         user.GetExpireAt(),
+		"panel_uuid":        user.UUID,
+		"panel_short_uuid":  user.ShortUuid,
+		"is_trial":          false,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	trafficLimit := int64(config.TrafficLimit())
+	s.eventRepository.Record(ctx, database.SubscriptionEvent{
+		CustomerID:       customer.ID,
+		TelegramID:       customer.TelegramID,
+		Source:           database.SubscriptionEventPromoCode,
+		Actor:            database.ActorCustomer(customer.TelegramID),
+		PreviousExpireAt: customer.ExpireAt,
+		NewExpireAt:      &user.ExpireAt,
+		TrafficLimit:     &trafficLimit,
+	})
+
+	slog.Info("Promo code redeemed", "code", promo.Code, "customer_id", utils.MaskHalfInt64(customer.ID), "days", promo.Days)
+	return promo, nil
+}
@@ -0,0 +1,259 @@
+package referral
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/translation"
+	"remnawave-tg-shop-bot/utils"
+	"time"
+)
+
+type Service struct {
+	referralRepository *database.ReferralRepository
+	contestRepository  *database.ReferralContestRepository
+	customerRepository *database.CustomerRepository
+	eventRepository    *database.SubscriptionEventRepository
+	panels             *remnawave.Panels
+	telegramBot        *bot.Bot
+	translation        *translation.Manager
+}
+
+func NewService(
+	referralRepository *database.ReferralRepository,
+	contestRepository *database.ReferralContestRepository,
+	customerRepository *database.CustomerRepository,
+	eventRepository *database.SubscriptionEventRepository,
+	panels *remnawave.Panels,
+	telegramBot *bot.Bot,
+	translation *translation.Manager,
+) *Service {
+	return &Service{
+		referralRepository: referralRepository,
+		contestRepository:  contestRepository,
+		customerRepository: customerRepository,
+		eventRepository:    eventRepository,
+		panels:             panels,
+		telegramBot:        telegramBot,
+		translation:        translation,
+	}
+}
+
+// EvaluateMilestones grants every configured milestone the referrer has reached and not yet been rewarded for.
+func (s Service) EvaluateMilestones(ctx context.Context, referrerTelegramID int64) error {
+	milestones := config.ReferralMilestones()
+	if len(milestones) == 0 {
+		return nil
+	}
+
+	paid, err := s.referralRepository.CountPaidByReferrer(ctx, referrerTelegramID)
+	if err != nil {
+		return err
+	}
+
+	for _, milestone := range milestones {
+		if paid < milestone.Referrals {
+			break
+		}
+
+		claimed, err := s.referralRepository.ClaimMilestoneReward(ctx, referrerTelegramID, milestone.Referrals, milestone.Days)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+
+		err = s.grantDays(ctx, referrerTelegramID, milestone.Days, database.SubscriptionEventReferralMilestone, func(lang string) string {
+			return fmt.Sprintf(s.translation.GetText(lang, "referral_milestone_reached"), milestone.Referrals, milestone.Days)
+		})
+		if err != nil {
+			if releaseErr := s.referralRepository.ReleaseMilestoneReward(ctx, referrerTelegramID, milestone.Referrals); releaseErr != nil {
+				slog.Error("Error releasing milestone reward", "error", releaseErr)
+			}
+			return err
+		}
+		slog.Info("Granted referral milestone", "telegram_id", utils.MaskHalfInt64(referrerTelegramID), "referrals", milestone.Referrals, "days", milestone.Days)
+	}
+	return nil
+}
+
+func (s Service) ActiveContest(ctx context.Context) (*database.ReferralContest, error) {
+	return s.contestRepository.FindActive(ctx)
+}
+
+func (s Service) StartContest(ctx context.Context, duration time.Duration, prizeDays []int) (*database.ReferralContest, error) {
+	if len(prizeDays) == 0 {
+		return nil, fmt.Errorf("at least one prize is required")
+	}
+	return s.contestRepository.Create(ctx, time.Now().Add(duration), prizeDays)
+}
+
+func (s Service) Leaderboard(ctx context.Context, contest *database.ReferralContest, limit int) ([]database.LeaderboardEntry, error) {
+	return s.contestRepository.Leaderboard(ctx, contest, limit)
+}
+
+// StopContest finishes the active contest right away and rewards its winners.
+func (s Service) StopContest(ctx context.Context) (*database.ReferralContest, []database.ReferralContestWinner, error) {
+	contest, err := s.contestRepository.FindActive(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if contest == nil {
+		return nil, nil, nil
+	}
+	winners, err := s.finishContest(ctx, contest, time.Now())
+	return contest, winners, err
+}
+
+// FinishExpiredContests is run by the scheduler and closes the active contest once its end date has passed.
+func (s Service) FinishExpiredContests(ctx context.Context) error {
+	contest, err := s.contestRepository.FindActive(ctx)
+	if err != nil {
+		return err
+	}
+	if contest != nil && !contest.EndsAt.After(time.Now()) {
+		if _, err := s.finishContest(ctx, contest, contest.EndsAt); err != nil {
+			return err
+		}
+	}
+	return s.rewardWinners(ctx)
+}
+
+func (s Service) finishContest(ctx context.Context, contest *database.ReferralContest, finishedAt time.Time) ([]database.ReferralContestWinner, error) {
+	contest.FinishedAt = &finishedAt
+	leaderboard, err := s.contestRepository.Leaderboard(ctx, contest, len(contest.PrizeDays))
+	if err != nil {
+		return nil, err
+	}
+
+	winners := make([]database.ReferralContestWinner, 0, len(leaderboard))
+	for i, entry := range leaderboard {
+		winners = append(winners, database.ReferralContestWinner{
+			ContestID:  contest.ID,
+			Place:      i + 1,
+			ReferrerID: entry.ReferrerID,
+			Referrals:  entry.Referrals,
+			Days:       contest.PrizeDays[i],
+		})
+	}
+
+	finished, err := s.contestRepository.Finish(ctx, contest.ID, finishedAt, winners)
+	if err != nil {
+		return nil, err
+	}
+	if !finished {
+		return nil, nil
+	}
+	slog.Info("Referral contest finished", "contest_id", contest.ID, "winners", len(winners))
+
+	return winners, s.rewardWinners(ctx)
+}
+
+// ErrCustomerNotFound is returned when the customer to reward is not in the database.
+var ErrCustomerNotFound = errors.New("customer not found")
+
+// contestRewardMaxAttempts caps the deliveries of a contest prize. The contests cron runs every 10 minutes, so a
+// panel outage of up to two hours is retried through.
+const contestRewardMaxAttempts = 12
+
+// rewardWinners delivers the prizes not delivered yet. Like the milestones, a prize is claimed before it is granted,
+// so neither a failure after the panel call nor a concurrent run gives it twice, and released when the grant failed. A
+// winner who is gone or banned is given up on at once, any other failure after contestRewardMaxAttempts.
+func (s Service) rewardWinners(ctx context.Context) error {
+	winners, err := s.contestRepository.FindUnrewardedWinners(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, winner := range winners {
+		claimed, err := s.contestRepository.ClaimWinnerReward(ctx, winner.ID)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		err = s.grantDays(ctx, winner.ReferrerID, winner.Days, database.SubscriptionEventReferralContest, func(lang string) string {
+			return fmt.Sprintf(s.translation.GetText(lang, "referral_contest_won"), winner.Place, winner.Referrals, winner.Days)
+		})
+		if err != nil {
+			failed := giveUpContestReward(winner.Attempts+1, err)
+			if failed {
+				slog.Error("Gave up rewarding contest winner", "contest_id", winner.ContestID, "place", winner.Place, "attempts", winner.Attempts+1, "error", err)
+			} else {
+				slog.Warn("Error rewarding contest winner", "contest_id", winner.ContestID, "place", winner.Place, "attempts", winner.Attempts+1, "error", err)
+			}
+			if err := s.contestRepository.MarkWinnerAttemptFailed(ctx, winner.ID, err.Error(), failed); err != nil {
+				return err
+			}
+			continue
+		}
+		slog.Info("Rewarded contest winner", "contest_id", winner.ContestID, "place", winner.Place, "telegram_id", utils.MaskHalfInt64(winner.ReferrerID))
+	}
+	return nil
+}
+
+// giveUpContestReward reports whether a prize that failed for the given attempt should no longer be retried.
+func giveUpContestReward(attempts int, err error) bool {
+	return attempts >= contestRewardMaxAttempts || errors.Is(err, ErrCustomerNotFound) || errors.Is(err, database.ErrCustomerBanned)
+}
+
+// grantDays adds days to the panel user of the customer. An error means the days were not given, so the caller can
+// retry. Once the panel user is extended the grant counts as delivered: a failure to store the new date on the
+// customer is only logged, the next sync brings it over.
+func (s Service) grantDays(ctx context.Context, telegramID int64, days int, source database.SubscriptionEventSource, text func(lang string) string) error {
+	customer, err := s.customerRepository.FindByTelegramId(ctx, telegramID)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		return fmt.Errorf("%w: %s", ErrCustomerNotFound, utils.MaskHalfInt64(telegramID))
+	}
+	if customer.IsBanned {
+		return database.ErrCustomerBanned
+	}
+
+	user, err := s.panels.Get(customer.Panel).CreateOrUpdateUser(ctx, customer.ID, customer.TelegramID, customer.PanelUUID, config.TrafficLimit(), days)
+	if err != nil {
+		return err
+	}
+
+	err = s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
+		"subscription_link": user.GetSubscriptionUrl(),
+		"expire_at":         user.GetExpireAt(),
+		"panel_uuid":        user.UUID,
+		"panel_short_uuid":  user.ShortUuid,
+		"is_trial":          false,
+	})
+	if err != nil {
+		slog.Error("Error saving granted days", "telegram_id", utils.MaskHalfInt64(telegramID), "source", source, "error", err)
+	}
+
+	trafficLimit := int64(config.TrafficLimit())
+	s.eventRepository.Record(ctx, database.SubscriptionEvent{
+		CustomerID:       customer.ID,
+		TelegramID:       customer.TelegramID,
+		Source:           source,
+		Actor:            database.ActorSystem,
+		PreviousExpireAt: customer.ExpireAt,
+		NewExpireAt:      &user.ExpireAt,
+		TrafficLimit:     &trafficLimit,
+	})
+
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text(customer.Language),
+	})
+	if err != nil {
+		slog.Error("Error sending referral reward message", "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package referral
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+func TestGiveUpContestReward(t *testing.T) {
+	panelDown := errors.New("connection refused")
+	tests := []struct {
+		name     string
+		attempts int
+		err      error
+		want     bool
+	}{
+		{"panel down", 1, panelDown, false},
+		{"panel down for long", contestRewardMaxAttempts, panelDown, true},
+		{"customer gone", 1, fmt.Errorf("%w: 12***", ErrCustomerNotFound), true},
+		{"customer banned", 1, database.ErrCustomerBanned, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := giveUpContestReward(tt.attempts, tt.err); got != tt.want {
+				t.Errorf("giveUpContestReward(%d, %v) = %v, want %v", tt.attempts, tt.err, got, tt.want)
+			}
+		})
+	}
+}
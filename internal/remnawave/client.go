@@ -9,6 +9,7 @@ import (
 	"log/slog"
 	"net/http"
 	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/metrics"
 	"remnawave-tg-shop-bot/utils"
 	"strconv"
 	"strings"
@@ -17,6 +18,8 @@ import (
 
 type Client struct {
 	client *remapi.Client
+	tag    string
+	squads map[uuid.UUID]uuid.UUID
 }
 
 type headerTransport struct {
@@ -40,9 +43,9 @@ func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	return t.base.RoundTrip(r)
 }
 
-func NewClient(baseURL, token, mode string) *Client {
-	xApiKey := config.GetXApiKey()
-	local := mode == "local"
+func NewClient(panel config.RemnawavePanel) *Client {
+	xApiKey := panel.XApiKey
+	local := panel.Mode == "local"
 
 	client := &http.Client{
 		Transport: &headerTransport{
@@ -52,23 +55,27 @@ func NewClient(baseURL, token, mode string) *Client {
 		},
 	}
 
-	api, err := remapi.NewClient(baseURL, remapi.StaticToken{Token: token}, remapi.WithClient(client))
+	api, err := remapi.NewClient(panel.URL, remapi.StaticToken{Token: panel.Token}, remapi.WithClient(client))
 	if err != nil {
 		panic(err)
 	}
-	return &Client{client: api}
+	return &Client{client: api, tag: panel.Tag, squads: panel.SquadUUIDs}
 }
 
-func (r *Client) Ping(ctx context.Context) error {
+func (r *Client) Ping(ctx context.Context) (err error) {
+	defer metrics.ObserveRemnawave("ping", time.Now(), &err)
+
 	params := remapi.UsersControllerGetAllUsersParams{
 		Size:  remapi.NewOptFloat64(1),
 		Start: remapi.NewOptFloat64(0),
 	}
-	_, err := r.client.UsersControllerGetAllUsers(ctx, params)
+	_, err = r.client.UsersControllerGetAllUsers(ctx, params)
 	return err
 }
 
-func (r *Client) GetUsers(ctx context.Context) (*[]remapi.UserDto, error) {
+func (r *Client) GetUsers(ctx context.Context) (_ *[]remapi.UserDto, err error) {
+	defer metrics.ObserveRemnawave("get_users", time.Now(), &err)
+
 	pageSize := float64(250)
 	start := float64(0)
 
@@ -96,79 +103,242 @@ func (r *Client) GetUsers(ctx context.Context) (*[]remapi.UserDto, error) {
 	return &users, nil
 }
 
-func (r *Client) DecreaseSubscription(ctx context.Context, telegramId int64, trafficLimit, days int) (*time.Time, error) {
-	resp, err := r.client.UsersControllerGetUserByTelegramId(ctx, remapi.UsersControllerGetUserByTelegramIdParams{TelegramId: strconv.FormatInt(telegramId, 10)})
+// SetExpire sets the expiration date of the panel user of the customer and keeps its status. Unlike
+// CreateOrUpdateUser it can move the date back, see DecreasedExpire.
+func (r *Client) SetExpire(ctx context.Context, telegramId int64, userUuid *uuid.UUID, trafficLimit int, expireAt time.Time) (_ *remapi.UserDto, err error) {
+	defer metrics.ObserveRemnawave("set_expire", time.Now(), &err)
+
+	existingUser, err := r.FindUser(ctx, telegramId, userUuid)
+	if err != nil {
+		return nil, err
+	}
+	if existingUser == nil {
+		return nil, errors.New("user in remnawave not found")
+	}
+	userUpdate, _ := r.userUpdate(ctx, existingUser, trafficLimit, expireAt)
+	updateUser, err := r.client.UsersControllerUpdateUser(ctx, userUpdate)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("set user expiration", "telegramId", utils.MaskHalfInt64(telegramId), "expire_at", expireAt)
+	return &updateUser.(*remapi.UserResponseDto).Response, nil
+}
+
+// CreateOrUpdateUser extends the panel user of the customer by days or creates it. userUuid is the panel user
+// stored on the customer, nil for customers who have none yet.
+func (r *Client) CreateOrUpdateUser(ctx context.Context, customerId int64, telegramId int64, userUuid *uuid.UUID, trafficLimit int, days int) (_ *remapi.UserDto, err error) {
+	defer metrics.ObserveRemnawave("create_or_update_user", time.Now(), &err)
+
+	existingUser, err := r.FindUser(ctx, telegramId, userUuid)
+	if err != nil {
+		return nil, err
+	}
+	if existingUser == nil {
+		return r.createUser(ctx, customerId, telegramId, trafficLimit, ExtendedExpire(nil, days))
+	}
+	return r.updateUser(ctx, existingUser, trafficLimit, ExtendedExpire(existingUser, days))
+}
+
+// CreateOrUpdateUserUntil is CreateOrUpdateUser to an absolute expiration date. Calling it again with the same date
+// changes nothing, so a failed delivery can be retried without giving the days twice.
+func (r *Client) CreateOrUpdateUserUntil(ctx context.Context, customerId int64, telegramId int64, userUuid *uuid.UUID, trafficLimit int, expireAt time.Time) (_ *remapi.UserDto, err error) {
+	defer metrics.ObserveRemnawave("create_or_update_user_until", time.Now(), &err)
+
+	existingUser, err := r.FindUser(ctx, telegramId, userUuid)
+	if err != nil {
+		return nil, err
+	}
+	if existingUser == nil {
+		return r.createUser(ctx, customerId, telegramId, trafficLimit, expireAt)
+	}
+	return r.updateUser(ctx, existingUser, trafficLimit, expireAt)
+}
+
+// FindUser returns the panel user by the UUID stored on the customer. Without a stored UUID, or when that user
+// was deleted in the panel, it falls back to the telegram id lookup. Returns nil if the panel has no user.
+func (r *Client) FindUser(ctx context.Context, telegramId int64, userUuid *uuid.UUID) (*remapi.UserDto, error) {
+	if userUuid != nil {
+		user, err := r.GetUserByUuid(ctx, *userUuid)
+		if err != nil || user != nil {
+			return user, err
+		}
+	}
+	return r.GetUserByTelegramId(ctx, telegramId)
+}
+
+// GetUserByUuid returns the panel user or nil if it does not exist.
+func (r *Client) GetUserByUuid(ctx context.Context, userUuid uuid.UUID) (_ *remapi.UserDto, err error) {
+	defer metrics.ObserveRemnawave("get_user_by_uuid", time.Now(), &err)
+
+	resp, err := r.client.UsersControllerGetUserByUuid(ctx, remapi.UsersControllerGetUserByUuidParams{UUID: userUuid.String()})
 	if err != nil {
 		return nil, err
 	}
 
 	switch v := resp.(type) {
-	case *remapi.UsersControllerGetUserByTelegramIdNotFound:
-		return nil, errors.New("user in remnawave not found")
-	case *remapi.UsersDto:
-		var existingUser *remapi.UserDto
-		for _, panelUser := range v.GetResponse() {
-			if strings.Contains(panelUser.Username, fmt.Sprintf("_%d", telegramId)) {
-				existingUser = &panelUser
+	case *remapi.UsersControllerGetUserByUuidNotFound:
+		return nil, nil
+	case *remapi.UserResponseDto:
+		return &v.Response, nil
+	default:
+		return nil, errors.New("unknown response type")
+	}
+}
+
+// PickUser chooses the panel user of the customer among all users with the telegram id: the stored UUID first,
+// then the username generated by the bot, then the first one.
+func PickUser(users []remapi.UserDto, telegramId int64, userUuid *uuid.UUID) *remapi.UserDto {
+	if len(users) == 0 {
+		return nil
+	}
+	if userUuid != nil {
+		for i := range users {
+			if users[i].UUID == *userUuid {
+				return &users[i]
 			}
 		}
-		if existingUser == nil {
-			existingUser = &v.GetResponse()[0]
+	}
+	for i := range users {
+		if strings.HasSuffix(users[i].Username, fmt.Sprintf("_%d", telegramId)) {
+			return &users[i]
 		}
-		updatedUser, err := r.updateUser(ctx, existingUser, trafficLimit, days)
-		return &updatedUser.ExpireAt, err
-	default:
-		return nil, errors.New("unknown response type")
 	}
+	return &users[0]
 }
 
-func (r *Client) CreateOrUpdateUser(ctx context.Context, customerId int64, telegramId int64, trafficLimit int, days int) (*remapi.UserDto, error) {
+// GetUserByTelegramId returns the panel user of the telegram account or nil if the panel has none.
+func (r *Client) GetUserByTelegramId(ctx context.Context, telegramId int64) (_ *remapi.UserDto, err error) {
+	defer metrics.ObserveRemnawave("get_user_by_telegram_id", time.Now(), &err)
+
 	resp, err := r.client.UsersControllerGetUserByTelegramId(ctx, remapi.UsersControllerGetUserByTelegramIdParams{TelegramId: strconv.FormatInt(telegramId, 10)})
 	if err != nil {
 		return nil, err
 	}
 
 	switch v := resp.(type) {
-
 	case *remapi.UsersControllerGetUserByTelegramIdNotFound:
-		return r.createUser(ctx, customerId, telegramId, trafficLimit, days)
+		return nil, nil
 	case *remapi.UsersDto:
-		var existingUser *remapi.UserDto
-		for _, panelUser := range v.GetResponse() {
-			if strings.Contains(panelUser.Username, fmt.Sprintf("_%d", telegramId)) {
-				existingUser = &panelUser
-			}
-		}
-		if existingUser == nil {
-			existingUser = &v.GetResponse()[0]
-		}
-		return r.updateUser(ctx, existingUser, trafficLimit, days)
+		return PickUser(v.GetResponse(), telegramId, nil), nil
 	default:
 		return nil, errors.New("unknown response type")
 	}
 }
 
-func (r *Client) updateUser(ctx context.Context, existingUser *remapi.UserDto, trafficLimit int, days int) (*remapi.UserDto, error) {
+// GetTelegramIdByUsername resolves a panel username to the telegram id attached to it. Returns 0 if the user
+// is not found or has no telegram id.
+func (r *Client) GetTelegramIdByUsername(ctx context.Context, username string) (_ int64, err error) {
+	defer metrics.ObserveRemnawave("get_user_by_username", time.Now(), &err)
 
-	newExpire := getNewExpire(days, existingUser.ExpireAt)
+	resp, err := r.client.UsersControllerGetUserByUsername(ctx, remapi.UsersControllerGetUserByUsernameParams{Username: username})
+	if err != nil {
+		return 0, err
+	}
 
-	userUpdate := &remapi.UpdateUserRequestDto{
-		UUID:              existingUser.UUID,
-		ExpireAt:          remapi.NewOptDateTime(newExpire),
-		Status:            remapi.NewOptUpdateUserRequestDtoStatus(remapi.UpdateUserRequestDtoStatusACTIVE),
-		TrafficLimitBytes: remapi.NewOptInt(trafficLimit),
+	switch v := resp.(type) {
+	case *remapi.UsersControllerGetUserByUsernameNotFound:
+		return 0, nil
+	case *remapi.GetUserByUsernameResponseDto:
+		telegramId, ok := v.Response.TelegramId.Get()
+		if !ok {
+			return 0, nil
+		}
+		return int64(telegramId), nil
+	default:
+		return 0, errors.New("unknown response type")
 	}
+}
+
+// CountUserDevices returns the number of HWID devices registered for the panel user.
+func (r *Client) CountUserDevices(ctx context.Context, userUuid uuid.UUID) (_ int, err error) {
+	defer metrics.ObserveRemnawave("get_user_devices", time.Now(), &err)
 
-	if config.RemnawaveTag() != "" && (existingUser.Tag.IsNull()) {
-		userUpdate.Tag = remapi.NewOptNilString(config.RemnawaveTag())
+	resp, err := r.client.HwidUserDevicesControllerGetUserHwidDevices(ctx, remapi.HwidUserDevicesControllerGetUserHwidDevicesParams{UserUuid: userUuid.String()})
+	if err != nil {
+		return 0, err
+	}
+	devices, ok := resp.(*remapi.GetUserHwidDevicesResponseDto)
+	if !ok {
+		return 0, fmt.Errorf("unexpected user devices response: %T", resp)
 	}
+	return int(devices.Response.Total), nil
+}
 
-	var username string
-	if ctx.Value("username") != nil {
-		username = ctx.Value("username").(string)
-		userUpdate.Description = remapi.NewOptNilString(username)
-	} else {
-		username = ""
+// GetNodes returns the nodes of the panel with their connection state, online users and traffic.
+func (r *Client) GetNodes(ctx context.Context) (_ []remapi.GetAllNodesResponseDtoResponseItem, err error) {
+	defer metrics.ObserveRemnawave("get_nodes", time.Now(), &err)
+
+	resp, err := r.client.NodesControllerGetAllNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := resp.(*remapi.GetAllNodesResponseDto)
+	if !ok {
+		return nil, fmt.Errorf("unexpected nodes response: %T", resp)
+	}
+	return nodes.Response, nil
+}
+
+func (r *Client) ResetUserTraffic(ctx context.Context, userUuid uuid.UUID) (err error) {
+	defer metrics.ObserveRemnawave("reset_user_traffic", time.Now(), &err)
+
+	resp, err := r.client.UsersControllerResetUserTraffic(ctx, remapi.UsersControllerResetUserTrafficParams{UUID: userUuid.String()})
+	if err != nil {
+		return err
+	}
+	if _, ok := resp.(*remapi.ResetUserTrafficResponseDto); !ok {
+		return fmt.Errorf("unexpected reset traffic response: %T", resp)
+	}
+	return nil
+}
+
+func (r *Client) DisableUser(ctx context.Context, userUuid uuid.UUID) (err error) {
+	defer metrics.ObserveRemnawave("disable_user", time.Now(), &err)
+
+	resp, err := r.client.UsersControllerDisableUser(ctx, remapi.UsersControllerDisableUserParams{UUID: userUuid.String()})
+	if err != nil {
+		return err
+	}
+	if _, ok := resp.(*remapi.DisableUserResponseDto); !ok {
+		return fmt.Errorf("unexpected disable user response: %T", resp)
+	}
+	return nil
+}
+
+func (r *Client) EnableUser(ctx context.Context, userUuid uuid.UUID) (err error) {
+	defer metrics.ObserveRemnawave("enable_user", time.Now(), &err)
+
+	resp, err := r.client.UsersControllerEnableUser(ctx, remapi.UsersControllerEnableUserParams{UUID: userUuid.String()})
+	if err != nil {
+		return err
+	}
+	if _, ok := resp.(*remapi.EnableUserResponseDto); !ok {
+		return fmt.Errorf("unexpected enable user response: %T", resp)
+	}
+	return nil
+}
+
+// RevokeSubscription invalidates the current subscription link and returns the new one.
+func (r *Client) RevokeSubscription(ctx context.Context, userUuid uuid.UUID) (_ string, err error) {
+	defer metrics.ObserveRemnawave("revoke_subscription", time.Now(), &err)
+
+	resp, err := r.client.UsersControllerRevokeUserSubscription(ctx, &remapi.RevokeUserSubscriptionBodyDto{},
+		remapi.UsersControllerRevokeUserSubscriptionParams{UUID: userUuid.String()})
+	if err != nil {
+		return "", err
+	}
+	revoked, ok := resp.(*remapi.RevokeUserSubscriptionResponseDto)
+	if !ok {
+		return "", fmt.Errorf("unexpected revoke subscription response: %T", resp)
+	}
+	slog.Info("revoked subscription", "uuid", utils.MaskHalf(userUuid.String()))
+	return revoked.Response.SubscriptionUrl, nil
+}
+
+func (r *Client) updateUser(ctx context.Context, existingUser *remapi.UserDto, trafficLimit int, expireAt time.Time) (*remapi.UserDto, error) {
+	userUpdate, username := r.userUpdate(ctx, existingUser, trafficLimit, expireAt)
+	if !isDisabled(existingUser) {
+		userUpdate.Status = remapi.NewOptUpdateUserRequestDtoStatus(remapi.UpdateUserRequestDtoStatusACTIVE)
 	}
 
 	updateUser, err := r.client.UsersControllerUpdateUser(ctx, userUpdate)
@@ -176,12 +346,39 @@ func (r *Client) updateUser(ctx context.Context, existingUser *remapi.UserDto, t
 		return nil, err
 	}
 	tgid, _ := existingUser.TelegramId.Get()
-	slog.Info("updated user", "telegramId", utils.MaskHalf(strconv.Itoa(tgid)), "username", utils.MaskHalf(username), "days", days)
+	slog.Info("updated user", "telegramId", utils.MaskHalf(strconv.Itoa(tgid)), "username", utils.MaskHalf(username), "expire_at", expireAt)
 	return &updateUser.(*remapi.UserResponseDto).Response, nil
 }
 
-func (r *Client) createUser(ctx context.Context, customerId int64, telegramId int64, trafficLimit int, days int) (*remapi.UserDto, error) {
-	expireAt := time.Now().UTC().AddDate(0, 0, days)
+// isDisabled tells whether the panel user was disabled, by a ban or by hand in the panel. Extending the
+// subscription keeps such a user disabled and only brings expired or limited users back.
+func isDisabled(user *remapi.UserDto) bool {
+	status, ok := user.Status.Get()
+	return ok && status == remapi.UserDtoStatusDISABLED
+}
+
+// userUpdate builds the update of an existing panel user to the given expiration date and traffic limit. It also
+// returns the telegram username passed in the context, empty when there is none.
+func (r *Client) userUpdate(ctx context.Context, existingUser *remapi.UserDto, trafficLimit int, expireAt time.Time) (*remapi.UpdateUserRequestDto, string) {
+	userUpdate := &remapi.UpdateUserRequestDto{
+		UUID:              existingUser.UUID,
+		ExpireAt:          remapi.NewOptDateTime(expireAt),
+		TrafficLimitBytes: remapi.NewOptInt(trafficLimit),
+	}
+
+	if r.tag != "" && (existingUser.Tag.IsNull()) {
+		userUpdate.Tag = remapi.NewOptNilString(r.tag)
+	}
+
+	var username string
+	if ctx.Value("username") != nil {
+		username = ctx.Value("username").(string)
+		userUpdate.Description = remapi.NewOptNilString(username)
+	}
+	return userUpdate, username
+}
+
+func (r *Client) createUser(ctx context.Context, customerId int64, telegramId int64, trafficLimit int, expireAt time.Time) (*remapi.UserDto, error) {
 	username := generateUsername(customerId, telegramId)
 
 	resp, err := r.client.InternalSquadControllerGetInternalSquads(ctx)
@@ -190,18 +387,11 @@ func (r *Client) createUser(ctx context.Context, customerId int64, telegramId in
 	}
 
 	squads := resp.(*remapi.GetInternalSquadsResponseDto).GetResponse()
-	squadId := make([]uuid.UUID, 0, len(config.SquadUUIDs()))
+	available := make([]uuid.UUID, 0, len(squads.GetInternalSquads()))
 	for _, squad := range squads.GetInternalSquads() {
-		if config.SquadUUIDs() != nil && len(config.SquadUUIDs()) > 0 {
-			if _, isExist := config.SquadUUIDs()[squad.UUID]; !isExist {
-				continue
-			} else {
-				squadId = append(squadId, squad.UUID)
-			}
-		} else {
-			squadId = append(squadId, squad.UUID)
-		}
+		available = append(available, squad.UUID)
 	}
+	squadId := selectSquads(available, r.squads)
 
 	createUserRequestDto := remapi.CreateUserRequestDto{
 		Username:             username,
@@ -212,8 +402,8 @@ func (r *Client) createUser(ctx context.Context, customerId int64, telegramId in
 		TrafficLimitStrategy: remapi.NewOptCreateUserRequestDtoTrafficLimitStrategy(remapi.CreateUserRequestDtoTrafficLimitStrategyMONTH),
 		TrafficLimitBytes:    remapi.NewOptInt(trafficLimit),
 	}
-	if config.RemnawaveTag() != "" {
-		createUserRequestDto.Tag = remapi.NewOptNilString(config.RemnawaveTag())
+	if r.tag != "" {
+		createUserRequestDto.Tag = remapi.NewOptNilString(r.tag)
 	}
 
 	var tgUsername string
@@ -228,10 +418,25 @@ func (r *Client) createUser(ctx context.Context, customerId int64, telegramId in
 	if err != nil {
 		return nil, err
 	}
-	slog.Info("created user", "telegramId", utils.MaskHalf(strconv.FormatInt(telegramId, 10)), "username", utils.MaskHalf(tgUsername), "days", days)
+	slog.Info("created user", "telegramId", utils.MaskHalf(strconv.FormatInt(telegramId, 10)), "username", utils.MaskHalf(tgUsername), "expire_at", expireAt)
 	return &userCreate.(*remapi.UserResponseDto).Response, nil
 }
 
+// selectSquads returns the internal squads new users join: the allowed ones from the panel config, or all of them
+// when none are configured.
+func selectSquads(available []uuid.UUID, allowed map[uuid.UUID]uuid.UUID) []uuid.UUID {
+	squadId := make([]uuid.UUID, 0, len(allowed))
+	for _, squad := range available {
+		if len(allowed) > 0 {
+			if _, isExist := allowed[squad]; !isExist {
+				continue
+			}
+		}
+		squadId = append(squadId, squad)
+	}
+	return squadId
+}
+
 func generateUsername(customerId int64, telegramId int64) string {
 	return fmt.Sprintf("%d_%d", customerId, telegramId)
 }
@@ -250,3 +455,22 @@ func getNewExpire(daysToAdd int, currentExpire time.Time) time.Time {
 
 	return currentExpire.AddDate(0, 0, daysToAdd)
 }
+
+// ExtendedExpire is the expiration date of the panel user after days are added: from the current date while the
+// subscription runs, from now for an expired or missing (nil) user.
+func ExtendedExpire(user *remapi.UserDto, days int) time.Time {
+	if user == nil {
+		return getNewExpire(days, time.Time{})
+	}
+	return getNewExpire(days, user.ExpireAt)
+}
+
+// DecreasedExpire moves an expiration date back by days, but not into the past: a subscription that would end
+// before now ends now.
+func DecreasedExpire(currentExpire time.Time, days int) time.Time {
+	newExpire := currentExpire.AddDate(0, 0, -days)
+	if now := time.Now().UTC(); newExpire.Before(now) {
+		return now
+	}
+	return newExpire
+}
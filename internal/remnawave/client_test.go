@@ -0,0 +1,71 @@
+package remnawave
+
+import (
+	"testing"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+	"github.com/google/uuid"
+)
+
+func TestGetNewExpire(t *testing.T) {
+	now := time.Now().UTC()
+	future := now.AddDate(0, 0, 10)
+
+	tests := []struct {
+		name    string
+		days    int
+		current time.Time
+		want    time.Time
+	}{
+		{name: "new user", days: 30, current: time.Time{}, want: now.AddDate(0, 0, 30)},
+		{name: "expired user starts from now", days: 30, current: now.AddDate(0, 0, -5), want: now.AddDate(0, 0, 30)},
+		{name: "active user is extended", days: 30, current: future, want: future.AddDate(0, 0, 30)},
+		{name: "zero days leaves one day", days: 0, current: future, want: now.AddDate(0, 0, 1)},
+		{name: "negative days leave one day", days: -30, current: future, want: now.AddDate(0, 0, 1)},
+		{name: "month boundary", days: 1, current: time.Date(now.Year()+1, time.January, 31, 12, 0, 0, 0, time.UTC),
+			want: time.Date(now.Year()+1, time.February, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getNewExpire(tt.days, tt.current)
+			if diff := got.Sub(tt.want); diff < -time.Second || diff > time.Second {
+				t.Errorf("getNewExpire(%d, %v) = %v, want %v", tt.days, tt.current, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecreasedExpire(t *testing.T) {
+	future := time.Now().UTC().AddDate(0, 0, 60)
+	if got := DecreasedExpire(future, 3); !got.Equal(future.AddDate(0, 0, -3)) {
+		t.Errorf("DecreasedExpire = %v, want %v", got, future.AddDate(0, 0, -3))
+	}
+	if got := DecreasedExpire(future, 90); got.After(time.Now().UTC()) || time.Since(got) > time.Second {
+		t.Errorf("DecreasedExpire past now = %v, want now", got)
+	}
+}
+
+func TestPickUser(t *testing.T) {
+	other := remapi.UserDto{UUID: uuid.New(), Username: "manual"}
+	generated := remapi.UserDto{UUID: uuid.New(), Username: "7_123"}
+	stored := remapi.UserDto{UUID: uuid.New(), Username: "second"}
+	users := []remapi.UserDto{other, generated, stored}
+
+	if got := PickUser(users, 123, &stored.UUID); got.UUID != stored.UUID {
+		t.Errorf("stored uuid: got %s, want %s", got.Username, stored.Username)
+	}
+	if got := PickUser(users, 123, nil); got.UUID != generated.UUID {
+		t.Errorf("generated username: got %s, want %s", got.Username, generated.Username)
+	}
+	missing := uuid.New()
+	if got := PickUser(users, 123, &missing); got.UUID != generated.UUID {
+		t.Errorf("deleted stored user: got %s, want %s", got.Username, generated.Username)
+	}
+	if got := PickUser(users, 23, nil); got.UUID != other.UUID {
+		t.Errorf("suffix must match the whole telegram id: got %s, want %s", got.Username, other.Username)
+	}
+	if got := PickUser(nil, 123, nil); got != nil {
+		t.Errorf("no users: got %s, want nil", got.Username)
+	}
+}
@@ -0,0 +1,328 @@
+package remnawave
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+	"github.com/google/uuid"
+)
+
+// FakePanel is an in-memory Panel for tests. It creates and extends users with the same rules as Client, keeps
+// internal squads, used traffic and devices, and fails every call after SetError.
+type FakePanel struct {
+	mu      sync.Mutex
+	users   []*remapi.UserDto
+	squads  []uuid.UUID
+	devices map[uuid.UUID]int
+	nodes   []remapi.GetAllNodesResponseDtoResponseItem
+	err     error
+}
+
+// NewFakePanel returns an empty panel with the given internal squads.
+func NewFakePanel(squads ...uuid.UUID) *FakePanel {
+	return &FakePanel{squads: squads, devices: make(map[uuid.UUID]int)}
+}
+
+// SetError makes every following call fail with err, nil brings the panel back.
+func (f *FakePanel) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// AddUser stores a copy of the user, filling in the UUID, short UUID and subscription URL when empty.
+func (f *FakePanel) AddUser(user remapi.UserDto) remapi.UserDto {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user.UUID == uuid.Nil {
+		user.UUID = uuid.New()
+	}
+	if user.ShortUuid == "" {
+		user.ShortUuid = strings.ReplaceAll(user.UUID.String(), "-", "")[:16]
+	}
+	if user.SubscriptionUrl == "" {
+		user.SubscriptionUrl = "https://panel.example.com/sub/" + user.ShortUuid
+	}
+	if !user.Status.Set {
+		user.Status = remapi.NewOptUserDtoStatus(remapi.UserDtoStatusACTIVE)
+	}
+	f.users = append(f.users, &user)
+	return user
+}
+
+// User returns a copy of the panel user or nil if it does not exist.
+func (f *FakePanel) User(userUuid uuid.UUID) *remapi.UserDto {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user := f.find(userUuid); user != nil {
+		copied := *user
+		return &copied
+	}
+	return nil
+}
+
+// SetUsedTraffic sets the traffic the user has used in the current period.
+func (f *FakePanel) SetUsedTraffic(userUuid uuid.UUID, bytes float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user := f.find(userUuid); user != nil {
+		user.UsedTrafficBytes = bytes
+		if bytes > user.LifetimeUsedTrafficBytes {
+			user.LifetimeUsedTrafficBytes = bytes
+		}
+	}
+}
+
+// SetDevices sets the number of HWID devices of the user.
+func (f *FakePanel) SetDevices(userUuid uuid.UUID, devices int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.devices[userUuid] = devices
+}
+
+// SetNodes replaces the nodes returned by GetNodes.
+func (f *FakePanel) SetNodes(nodes ...remapi.GetAllNodesResponseDtoResponseItem) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nodes = append([]remapi.GetAllNodesResponseDtoResponseItem(nil), nodes...)
+}
+
+func (f *FakePanel) Ping(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *FakePanel) GetUsers(ctx context.Context) (*[]remapi.UserDto, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	users := make([]remapi.UserDto, 0, len(f.users))
+	for _, user := range f.users {
+		users = append(users, *user)
+	}
+	return &users, nil
+}
+
+func (f *FakePanel) CreateOrUpdateUser(ctx context.Context, customerId int64, telegramId int64, userUuid *uuid.UUID, trafficLimit int, days int) (*remapi.UserDto, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	if user := f.findUser(telegramId, userUuid); user != nil {
+		return f.update(ctx, user, trafficLimit, ExtendedExpire(user, days)), nil
+	}
+	return f.create(ctx, customerId, telegramId, trafficLimit, ExtendedExpire(nil, days)), nil
+}
+
+func (f *FakePanel) CreateOrUpdateUserUntil(ctx context.Context, customerId int64, telegramId int64, userUuid *uuid.UUID, trafficLimit int, expireAt time.Time) (*remapi.UserDto, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	if user := f.findUser(telegramId, userUuid); user != nil {
+		return f.update(ctx, user, trafficLimit, expireAt), nil
+	}
+	return f.create(ctx, customerId, telegramId, trafficLimit, expireAt), nil
+}
+
+func (f *FakePanel) create(ctx context.Context, customerId int64, telegramId int64, trafficLimit int, expireAt time.Time) *remapi.UserDto {
+	user := &remapi.UserDto{
+		UUID:                 uuid.New(),
+		Username:             generateUsername(customerId, telegramId),
+		Status:               remapi.NewOptUserDtoStatus(remapi.UserDtoStatusACTIVE),
+		TelegramId:           remapi.NewNilInt(int(telegramId)),
+		ExpireAt:             expireAt,
+		TrafficLimitStrategy: remapi.NewOptUserDtoTrafficLimitStrategy(remapi.UserDtoTrafficLimitStrategyMONTH),
+		TrafficLimitBytes:    remapi.NewOptInt(trafficLimit),
+		CreatedAt:            time.Now().UTC(),
+		UpdatedAt:            time.Now().UTC(),
+	}
+	user.ShortUuid = strings.ReplaceAll(user.UUID.String(), "-", "")[:16]
+	user.SubscriptionUrl = "https://panel.example.com/sub/" + user.ShortUuid
+	for _, squad := range selectSquads(f.squads, nil) {
+		user.ActiveInternalSquads = append(user.ActiveInternalSquads, remapi.UserDtoActiveInternalSquadsItem{UUID: squad})
+	}
+	if username, ok := ctx.Value("username").(string); ok {
+		user.Description = remapi.NewNilString(username)
+	}
+	f.users = append(f.users, user)
+	copied := *user
+	return &copied
+}
+
+func (f *FakePanel) SetExpire(ctx context.Context, telegramId int64, userUuid *uuid.UUID, trafficLimit int, expireAt time.Time) (*remapi.UserDto, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	user := f.findUser(telegramId, userUuid)
+	if user == nil {
+		return nil, errors.New("user in remnawave not found")
+	}
+	user.ExpireAt = expireAt
+	user.TrafficLimitBytes = remapi.NewOptInt(trafficLimit)
+	user.UpdatedAt = time.Now().UTC()
+	copied := *user
+	return &copied, nil
+}
+
+func (f *FakePanel) FindUser(ctx context.Context, telegramId int64, userUuid *uuid.UUID) (*remapi.UserDto, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	if user := f.findUser(telegramId, userUuid); user != nil {
+		copied := *user
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (f *FakePanel) GetUserByUuid(ctx context.Context, userUuid uuid.UUID) (*remapi.UserDto, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	if user := f.find(userUuid); user != nil {
+		copied := *user
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (f *FakePanel) GetUserByTelegramId(ctx context.Context, telegramId int64) (*remapi.UserDto, error) {
+	return f.FindUser(ctx, telegramId, nil)
+}
+
+func (f *FakePanel) GetTelegramIdByUsername(ctx context.Context, username string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+	for _, user := range f.users {
+		if user.Username == username {
+			telegramId, _ := user.TelegramId.Get()
+			return int64(telegramId), nil
+		}
+	}
+	return 0, nil
+}
+
+func (f *FakePanel) CountUserDevices(ctx context.Context, userUuid uuid.UUID) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.devices[userUuid], nil
+}
+
+func (f *FakePanel) GetNodes(ctx context.Context) ([]remapi.GetAllNodesResponseDtoResponseItem, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return append([]remapi.GetAllNodesResponseDtoResponseItem(nil), f.nodes...), nil
+}
+
+func (f *FakePanel) ResetUserTraffic(ctx context.Context, userUuid uuid.UUID) error {
+	return f.modify(userUuid, func(user *remapi.UserDto) {
+		user.UsedTrafficBytes = 0
+		user.LastTrafficResetAt = remapi.NewNilDateTime(time.Now().UTC())
+	})
+}
+
+func (f *FakePanel) DisableUser(ctx context.Context, userUuid uuid.UUID) error {
+	return f.modify(userUuid, func(user *remapi.UserDto) {
+		user.Status = remapi.NewOptUserDtoStatus(remapi.UserDtoStatusDISABLED)
+	})
+}
+
+func (f *FakePanel) EnableUser(ctx context.Context, userUuid uuid.UUID) error {
+	return f.modify(userUuid, func(user *remapi.UserDto) {
+		user.Status = remapi.NewOptUserDtoStatus(remapi.UserDtoStatusACTIVE)
+	})
+}
+
+func (f *FakePanel) RevokeSubscription(ctx context.Context, userUuid uuid.UUID) (string, error) {
+	var link string
+	err := f.modify(userUuid, func(user *remapi.UserDto) {
+		user.ShortUuid = strings.ReplaceAll(uuid.NewString(), "-", "")[:16]
+		user.SubscriptionUrl = "https://panel.example.com/sub/" + user.ShortUuid
+		user.SubRevokedAt = remapi.NewNilDateTime(time.Now().UTC())
+		link = user.SubscriptionUrl
+	})
+	return link, err
+}
+
+func (f *FakePanel) modify(userUuid uuid.UUID, change func(user *remapi.UserDto)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	user := f.find(userUuid)
+	if user == nil {
+		return errors.New("user in remnawave not found")
+	}
+	change(user)
+	user.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+func (f *FakePanel) update(ctx context.Context, user *remapi.UserDto, trafficLimit int, expireAt time.Time) *remapi.UserDto {
+	user.ExpireAt = expireAt
+	if !isDisabled(user) {
+		user.Status = remapi.NewOptUserDtoStatus(remapi.UserDtoStatusACTIVE)
+	}
+	user.TrafficLimitBytes = remapi.NewOptInt(trafficLimit)
+	if username, ok := ctx.Value("username").(string); ok {
+		user.Description = remapi.NewNilString(username)
+	}
+	user.UpdatedAt = time.Now().UTC()
+	copied := *user
+	return &copied
+}
+
+func (f *FakePanel) find(userUuid uuid.UUID) *remapi.UserDto {
+	for _, user := range f.users {
+		if user.UUID == userUuid {
+			return user
+		}
+	}
+	return nil
+}
+
+// findUser mirrors Client.FindUser: the stored UUID first, then the users with the telegram id.
+func (f *FakePanel) findUser(telegramId int64, userUuid *uuid.UUID) *remapi.UserDto {
+	if userUuid != nil {
+		if user := f.find(*userUuid); user != nil {
+			return user
+		}
+	}
+	var candidates []remapi.UserDto
+	for _, user := range f.users {
+		if id, ok := user.TelegramId.Get(); ok && int64(id) == telegramId {
+			candidates = append(candidates, *user)
+		}
+	}
+	picked := PickUser(candidates, telegramId, nil)
+	if picked == nil {
+		return nil
+	}
+	return f.find(picked.UUID)
+}
@@ -0,0 +1,103 @@
+package remnawave
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+	"github.com/google/uuid"
+)
+
+func TestFakePanelCreateAndExtend(t *testing.T) {
+	ctx := context.Background()
+	squad := uuid.New()
+	panel := NewFakePanel(squad)
+
+	created, err := panel.CreateOrUpdateUser(ctx, 7, 123, nil, 1024, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Username != "7_123" {
+		t.Errorf("username = %q, want 7_123", created.Username)
+	}
+	if len(created.ActiveInternalSquads) != 1 || created.ActiveInternalSquads[0].UUID != squad {
+		t.Errorf("squads = %v, want [%s]", created.ActiveInternalSquads, squad)
+	}
+
+	extended, err := panel.CreateOrUpdateUser(ctx, 7, 123, &created.UUID, 2048, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extended.UUID != created.UUID {
+		t.Fatalf("a second user was created")
+	}
+	if want := created.ExpireAt.AddDate(0, 0, 30); !extended.ExpireAt.Equal(want) {
+		t.Errorf("expire = %v, want %v", extended.ExpireAt, want)
+	}
+	if limit, _ := extended.TrafficLimitBytes.Get(); limit != 2048 {
+		t.Errorf("traffic limit = %d, want 2048", limit)
+	}
+}
+
+func TestFakePanelPrefersStoredUser(t *testing.T) {
+	ctx := context.Background()
+	panel := NewFakePanel()
+	first := panel.AddUser(remapi.UserDto{Username: "1_123", TelegramId: remapi.NewNilInt(123), ExpireAt: time.Now().AddDate(0, 0, 5)})
+	second := panel.AddUser(remapi.UserDto{Username: "second", TelegramId: remapi.NewNilInt(123), ExpireAt: time.Now().AddDate(0, 0, 5)})
+
+	if _, err := panel.CreateOrUpdateUser(ctx, 1, 123, &second.UUID, 0, 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := panel.User(first.UUID); !got.ExpireAt.Equal(first.ExpireAt) {
+		t.Errorf("user by telegram id was extended instead of the stored one")
+	}
+	if got := panel.User(second.UUID); !got.ExpireAt.Equal(second.ExpireAt.AddDate(0, 0, 10)) {
+		t.Errorf("stored user expire = %v, want %v", got.ExpireAt, second.ExpireAt.AddDate(0, 0, 10))
+	}
+}
+
+func TestFakePanelTrafficAndErrors(t *testing.T) {
+	ctx := context.Background()
+	panel := NewFakePanel()
+	user := panel.AddUser(remapi.UserDto{TelegramId: remapi.NewNilInt(5)})
+	panel.SetUsedTraffic(user.UUID, 500)
+
+	if err := panel.ResetUserTraffic(ctx, user.UUID); err != nil {
+		t.Fatal(err)
+	}
+	if got := panel.User(user.UUID); got.UsedTrafficBytes != 0 || got.LifetimeUsedTrafficBytes != 500 {
+		t.Errorf("traffic after reset = %v / %v, want 0 / 500", got.UsedTrafficBytes, got.LifetimeUsedTrafficBytes)
+	}
+
+	unavailable := errors.New("unavailable")
+	panel.SetError(unavailable)
+	if _, err := panel.FindUser(ctx, 5, nil); !errors.Is(err, unavailable) {
+		t.Errorf("err = %v, want %v", err, unavailable)
+	}
+	panel.SetError(nil)
+	if got, err := panel.FindUser(ctx, 5, nil); err != nil || got == nil {
+		t.Errorf("FindUser = %v, %v after the panel is back", got, err)
+	}
+}
+
+func TestFakePanelExtendKeepsDisabledUser(t *testing.T) {
+	ctx := context.Background()
+	panel := NewFakePanel()
+	disabled := panel.AddUser(remapi.UserDto{TelegramId: remapi.NewNilInt(5), Status: remapi.NewOptUserDtoStatus(remapi.UserDtoStatusDISABLED)})
+	expired := panel.AddUser(remapi.UserDto{TelegramId: remapi.NewNilInt(6), Status: remapi.NewOptUserDtoStatus(remapi.UserDtoStatusEXPIRED)})
+
+	if _, err := panel.CreateOrUpdateUser(ctx, 1, 5, &disabled.UUID, 0, 30); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := panel.CreateOrUpdateUser(ctx, 2, 6, &expired.UUID, 0, 30); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := panel.User(disabled.UUID).Status.Get(); status != remapi.UserDtoStatusDISABLED {
+		t.Errorf("disabled user status = %s, want %s", status, remapi.UserDtoStatusDISABLED)
+	}
+	if status, _ := panel.User(expired.UUID).Status.Get(); status != remapi.UserDtoStatusACTIVE {
+		t.Errorf("expired user status = %s, want %s", status, remapi.UserDtoStatusACTIVE)
+	}
+}
@@ -0,0 +1,117 @@
+package remnawave
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+	"github.com/google/uuid"
+)
+
+// NodeStatus is the state of a panel node shown on the server status screen.
+type NodeStatus struct {
+	Panel             string
+	UUID              uuid.UUID
+	Name              string
+	CountryCode       string
+	Online            bool
+	Disabled          bool
+	UsersOnline       int
+	TrafficUsedBytes  float64
+	TrafficLimitBytes float64
+	Uptime            time.Duration
+	StatusChangedAt   *time.Time
+}
+
+// Load returns the used share of the node traffic limit in percent, -1 when the node has no limit.
+func (n NodeStatus) Load() int {
+	if n.TrafficLimitBytes <= 0 {
+		return -1
+	}
+	return int(n.TrafficUsedBytes * 100 / n.TrafficLimitBytes)
+}
+
+func newNodeStatus(panel string, node remapi.GetAllNodesResponseDtoResponseItem) NodeStatus {
+	status := NodeStatus{
+		Panel:       panel,
+		UUID:        node.UUID,
+		Name:        node.Name,
+		CountryCode: node.CountryCode,
+		Online:      node.IsConnected && node.IsNodeOnline && node.IsXrayRunning && !node.IsDisabled,
+		Disabled:    node.IsDisabled,
+	}
+	if users, ok := node.UsersOnline.Get(); ok {
+		status.UsersOnline = users
+	}
+	if used, ok := node.TrafficUsedBytes.Get(); ok {
+		status.TrafficUsedBytes = used
+	}
+	if limit, ok := node.TrafficLimitBytes.Get(); ok {
+		status.TrafficLimitBytes = limit
+	}
+	if seconds, err := strconv.ParseFloat(node.XrayUptime, 64); err == nil && status.Online {
+		status.Uptime = time.Duration(seconds) * time.Second
+	}
+	if changed, ok := node.LastStatusChange.Get(); ok {
+		status.StatusChangedAt = &changed
+	}
+	return status
+}
+
+// NodeStatusCache keeps the nodes of all panels for a short time so that the status screen does not hit the panels
+// on every press.
+type NodeStatusCache struct {
+	panels *Panels
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	nodes     []NodeStatus
+	expiresAt time.Time
+}
+
+func NewNodeStatusCache(panels *Panels, ttl time.Duration) *NodeStatusCache {
+	return &NodeStatusCache{panels: panels, ttl: ttl}
+}
+
+// Get returns the cached nodes, loading them from the panels when the cache is empty or expired.
+func (c *NodeStatusCache) Get(ctx context.Context) ([]NodeStatus, error) {
+	c.mu.Lock()
+	if c.nodes != nil && time.Now().Before(c.expiresAt) {
+		nodes := c.nodes
+		c.mu.Unlock()
+		return nodes, nil
+	}
+	c.mu.Unlock()
+	return c.Refresh(ctx)
+}
+
+// Refresh loads the nodes of every panel and stores them in the cache. A panel that does not answer is skipped,
+// the error is returned only when no panel answered.
+func (c *NodeStatusCache) Refresh(ctx context.Context) ([]NodeStatus, error) {
+	nodes := make([]NodeStatus, 0)
+	var errs []error
+	for _, name := range c.panels.Names() {
+		panelNodes, err := c.panels.Get(name).GetNodes(ctx)
+		if err != nil {
+			slog.Warn("Error getting panel nodes", "panel", name, "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		for _, node := range panelNodes {
+			nodes = append(nodes, newNodeStatus(name, node))
+		}
+	}
+	if len(errs) == len(c.panels.Names()) && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nodes = nodes
+	c.expiresAt = time.Now().Add(c.ttl)
+	return nodes, nil
+}
@@ -0,0 +1,70 @@
+package remnawave
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+	"github.com/google/uuid"
+)
+
+func TestNodeStatusCache(t *testing.T) {
+	ctx := context.Background()
+	de := NewFakePanel()
+	de.SetNodes(remapi.GetAllNodesResponseDtoResponseItem{
+		UUID:              uuid.New(),
+		Name:              "de-1",
+		CountryCode:       "DE",
+		IsConnected:       true,
+		IsNodeOnline:      true,
+		IsXrayRunning:     true,
+		XrayUptime:        "7200",
+		UsersOnline:       remapi.NewNilInt(12),
+		TrafficUsedBytes:  remapi.NewNilFloat64(25),
+		TrafficLimitBytes: remapi.NewNilFloat64(100),
+	})
+	nl := NewFakePanel()
+	nl.SetNodes(remapi.GetAllNodesResponseDtoResponseItem{UUID: uuid.New(), Name: "nl-1", XrayUptime: "7200"})
+
+	panels := NewPanels()
+	panels.Add("de", de)
+	panels.Add("nl", nl)
+	cache := NewNodeStatusCache(panels, time.Minute)
+
+	nodes, err := cache.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("nodes = %d, want 2", len(nodes))
+	}
+	online := nodes[0]
+	if !online.Online || online.Panel != "de" || online.UsersOnline != 12 || online.Load() != 25 || online.Uptime != 2*time.Hour {
+		t.Errorf("online node = %+v", online)
+	}
+	offline := nodes[1]
+	if offline.Online || offline.Load() != -1 || offline.Uptime != 0 {
+		t.Errorf("offline node = %+v", offline)
+	}
+
+	nl.SetNodes()
+	if nodes, _ := cache.Get(ctx); len(nodes) != 2 {
+		t.Errorf("cached nodes = %d, want 2", len(nodes))
+	}
+
+	nl.SetError(errors.New("down"))
+	nodes, err = cache.Refresh(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 {
+		t.Errorf("nodes with one panel down = %d, want 1", len(nodes))
+	}
+
+	de.SetError(errors.New("down"))
+	if _, err := cache.Refresh(ctx); err == nil {
+		t.Error("expected an error when no panel answers")
+	}
+}
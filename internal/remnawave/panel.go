@@ -0,0 +1,72 @@
+package remnawave
+
+import (
+	"context"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+	"github.com/google/uuid"
+)
+
+// Panel is everything the bot does with Remnawave. Client talks to the real panel, FakePanel keeps users in
+// memory for tests.
+type Panel interface {
+	Ping(ctx context.Context) error
+	GetUsers(ctx context.Context) (*[]remapi.UserDto, error)
+	CreateOrUpdateUser(ctx context.Context, customerId int64, telegramId int64, userUuid *uuid.UUID, trafficLimit int, days int) (*remapi.UserDto, error)
+	CreateOrUpdateUserUntil(ctx context.Context, customerId int64, telegramId int64, userUuid *uuid.UUID, trafficLimit int, expireAt time.Time) (*remapi.UserDto, error)
+	SetExpire(ctx context.Context, telegramId int64, userUuid *uuid.UUID, trafficLimit int, expireAt time.Time) (*remapi.UserDto, error)
+	FindUser(ctx context.Context, telegramId int64, userUuid *uuid.UUID) (*remapi.UserDto, error)
+	GetUserByUuid(ctx context.Context, userUuid uuid.UUID) (*remapi.UserDto, error)
+	GetUserByTelegramId(ctx context.Context, telegramId int64) (*remapi.UserDto, error)
+	GetTelegramIdByUsername(ctx context.Context, username string) (int64, error)
+	CountUserDevices(ctx context.Context, userUuid uuid.UUID) (int, error)
+	GetNodes(ctx context.Context) ([]remapi.GetAllNodesResponseDtoResponseItem, error)
+	ResetUserTraffic(ctx context.Context, userUuid uuid.UUID) error
+	DisableUser(ctx context.Context, userUuid uuid.UUID) error
+	EnableUser(ctx context.Context, userUuid uuid.UUID) error
+	RevokeSubscription(ctx context.Context, userUuid uuid.UUID) (string, error)
+}
+
+var (
+	_ Panel = (*Client)(nil)
+	_ Panel = (*FakePanel)(nil)
+)
+
+// Panels holds one Panel per configured Remnawave installation. The first added panel is the default one.
+type Panels struct {
+	names  []string
+	panels map[string]Panel
+}
+
+func NewPanels() *Panels {
+	return &Panels{panels: make(map[string]Panel)}
+}
+
+func (p *Panels) Add(name string, panel Panel) {
+	if _, exists := p.panels[name]; !exists {
+		p.names = append(p.names, name)
+	}
+	p.panels[name] = panel
+}
+
+// Get returns the panel of a customer location, the default panel for an empty or unknown name.
+func (p *Panels) Get(name string) Panel {
+	if panel, ok := p.panels[name]; ok {
+		return panel
+	}
+	return p.panels[p.names[0]]
+}
+
+// Resolve returns the name of the panel Get would return.
+func (p *Panels) Resolve(name string) string {
+	if _, ok := p.panels[name]; ok {
+		return name
+	}
+	return p.names[0]
+}
+
+// Names returns the panel names in configuration order.
+func (p *Panels) Names() []string {
+	return p.names
+}
@@ -0,0 +1,99 @@
+package remnawave
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+	"github.com/google/uuid"
+)
+
+// Usage is the live state of a panel user shown to the customer.
+type Usage struct {
+	User    *remapi.UserDto
+	Devices int
+}
+
+// NextTrafficReset returns when the panel resets the used traffic, nil for the NO_RESET strategy. The panel
+// resets daily at midnight UTC, weekly on Monday and monthly on the 1st.
+func (u *Usage) NextTrafficReset(now time.Time) *time.Time {
+	strategy, _ := u.User.TrafficLimitStrategy.Get()
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var next time.Time
+	switch strategy {
+	case remapi.UserDtoTrafficLimitStrategyDAY:
+		next = today.AddDate(0, 0, 1)
+	case remapi.UserDtoTrafficLimitStrategyWEEK:
+		next = today.AddDate(0, 0, 7-(int(today.Weekday())+6)%7)
+	case remapi.UserDtoTrafficLimitStrategyMONTH:
+		next = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+	default:
+		return nil
+	}
+	return &next
+}
+
+type usageItem struct {
+	usage     *Usage
+	expiresAt time.Time
+}
+
+// UsageCache keeps panel users for a short time so that pressing the connect button again does not hit the panel.
+type UsageCache struct {
+	panels *Panels
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	items map[int64]usageItem
+}
+
+func NewUsageCache(panels *Panels, ttl time.Duration) *UsageCache {
+	return &UsageCache{panels: panels, ttl: ttl, items: make(map[int64]usageItem)}
+}
+
+// Get returns the usage of the telegram account in the named panel, nil when the panel has no user for it. The
+// stored panel user uuid is preferred over the telegram id lookup.
+func (c *UsageCache) Get(ctx context.Context, panel string, telegramID int64, userUuid *uuid.UUID) (*Usage, error) {
+	now := time.Now()
+	c.mu.Lock()
+	item, ok := c.items[telegramID]
+	c.mu.Unlock()
+	if ok && now.Before(item.expiresAt) {
+		return item.usage, nil
+	}
+
+	client := c.panels.Get(panel)
+	user, err := client.FindUser(ctx, telegramID, userUuid)
+	if err != nil {
+		return nil, err
+	}
+	var usage *Usage
+	if user != nil {
+		usage = &Usage{User: user}
+		usage.Devices, err = client.CountUserDevices(ctx, user.UUID)
+		if err != nil {
+			slog.Warn("Error counting user devices", "error", err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, it := range c.items {
+		if now.After(it.expiresAt) {
+			delete(c.items, id)
+		}
+	}
+	c.items[telegramID] = usageItem{usage: usage, expiresAt: now.Add(c.ttl)}
+	return usage, nil
+}
+
+// Invalidate drops the cached usage after the bot changed the panel user, e.g. after a purchase.
+func (c *UsageCache) Invalidate(telegramID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.items, telegramID)
+}
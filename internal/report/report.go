@@ -0,0 +1,232 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/translation"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report is the accounting snapshot for a date range. Amounts are never summed across currencies.
+type Report struct {
+	Granularity database.ReportGranularity
+	From        time.Time
+	To          time.Time
+	Rows        []database.RevenueRow
+	MRR         []database.CurrencyAmount
+	Churn       *database.Churn
+}
+
+type Service struct {
+	purchaseRepository *database.PurchaseRepository
+	telegramBot        *bot.Bot
+	translation        *translation.Manager
+}
+
+func NewService(purchaseRepository *database.PurchaseRepository, telegramBot *bot.Bot, translation *translation.Manager) *Service {
+	return &Service{
+		purchaseRepository: purchaseRepository,
+		telegramBot:        telegramBot,
+		translation:        translation,
+	}
+}
+
+func ParseGranularity(value string) (database.ReportGranularity, bool) {
+	switch g := database.ReportGranularity(value); g {
+	case database.ReportGranularityDay, database.ReportGranularityWeek, database.ReportGranularityMonth:
+		return g, true
+	default:
+		return "", false
+	}
+}
+
+// Range returns the default range for a granularity: 30 days, 12 weeks or 12 months up to and including today.
+func Range(granularity database.ReportGranularity, now time.Time) (time.Time, time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	to := today.AddDate(0, 0, 1)
+	switch granularity {
+	case database.ReportGranularityWeek:
+		monday := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+		return monday.AddDate(0, 0, -7*11), to
+	case database.ReportGranularityMonth:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -11, 0), to
+	default:
+		return today.AddDate(0, 0, -29), to
+	}
+}
+
+func (s *Service) Build(ctx context.Context, granularity database.ReportGranularity, from, to time.Time) (*Report, error) {
+	rows, err := s.purchaseRepository.RevenueByPeriod(ctx, granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+	mrr, err := s.purchaseRepository.MRR(ctx)
+	if err != nil {
+		return nil, err
+	}
+	churn, err := s.purchaseRepository.Churn(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &Report{Granularity: granularity, From: from, To: to, Rows: rows, MRR: mrr, Churn: churn}, nil
+}
+
+type currencyTotal struct {
+	amount float64
+	count  int
+}
+
+// Summary renders totals per currency and provider, average order value, new vs renewal purchases, churn and MRR.
+func (s *Service) Summary(langCode string, report *Report) string {
+	totals := make(map[string]*currencyTotal)
+	providers := make(map[string]*currencyTotal)
+	newCount, renewalCount := 0, 0
+	for _, row := range report.Rows {
+		if totals[row.Currency] == nil {
+			totals[row.Currency] = &currencyTotal{}
+		}
+		totals[row.Currency].amount += row.Amount
+		totals[row.Currency].count += row.Count
+
+		key := string(row.InvoiceType) + "|" + row.Currency
+		if providers[key] == nil {
+			providers[key] = &currencyTotal{}
+		}
+		providers[key].amount += row.Amount
+		providers[key].count += row.Count
+
+		newCount += row.New
+		renewalCount += row.Renewal
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf(s.translation.GetText(langCode, "report_title"),
+		s.translation.GetText(langCode, "report_granularity_"+string(report.Granularity)),
+		report.From.Format("02.01.2006"), report.To.AddDate(0, 0, -1).Format("02.01.2006")))
+
+	text.WriteString("\n\n")
+	text.WriteString(s.translation.GetText(langCode, "report_revenue"))
+	if len(totals) == 0 {
+		text.WriteString("\n" + s.translation.GetText(langCode, "admin_stats_no_revenue"))
+	}
+	for _, currency := range sortedKeys(totals) {
+		t := totals[currency]
+		text.WriteString(fmt.Sprintf(s.translation.GetText(langCode, "report_currency_line"), currency, t.amount, t.count, t.amount/float64(t.count)))
+	}
+
+	if len(providers) > 0 {
+		text.WriteString("\n\n")
+		text.WriteString(s.translation.GetText(langCode, "report_providers"))
+		for _, key := range sortedKeys(providers) {
+			parts := strings.SplitN(key, "|", 2)
+			p := providers[key]
+			text.WriteString(fmt.Sprintf("\n• %s: <b>%.2f %s</b> (%d)", parts[0], p.amount, parts[1], p.count))
+		}
+	}
+
+	text.WriteString("\n\n")
+	text.WriteString(fmt.Sprintf(s.translation.GetText(langCode, "report_new_vs_renewal"), newCount, renewalCount))
+
+	churnRate := 0.0
+	if report.Churn.Base > 0 {
+		churnRate = float64(report.Churn.Churned) / float64(report.Churn.Base) * 100
+	}
+	text.WriteString("\n")
+	text.WriteString(fmt.Sprintf(s.translation.GetText(langCode, "report_churn"), churnRate, report.Churn.Churned, report.Churn.Base))
+
+	text.WriteString("\n\n")
+	text.WriteString(s.translation.GetText(langCode, "report_mrr"))
+	if len(report.MRR) == 0 {
+		text.WriteString("\n—")
+	}
+	for _, m := range report.MRR {
+		text.WriteString(fmt.Sprintf("\n• <b>%.2f %s</b>", m.Amount, m.Currency))
+	}
+	return text.String()
+}
+
+// CSV renders one line per period, invoice type and currency.
+func (s *Service) CSV(report *Report) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write([]string{"period", "invoice_type", "currency", "amount", "count", "new", "renewal", "average_order_value"}); err != nil {
+		return nil, err
+	}
+	for _, row := range report.Rows {
+		err := w.Write([]string{
+			row.Period.Format("2006-01-02"),
+			string(row.InvoiceType),
+			row.Currency,
+			strconv.FormatFloat(row.Amount, 'f', 2, 64),
+			strconv.Itoa(row.Count),
+			strconv.Itoa(row.New),
+			strconv.Itoa(row.Renewal),
+			strconv.FormatFloat(row.Amount/float64(row.Count), 'f', 2, 64),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// Send delivers the summary and the CSV document to the chat.
+func (s *Service) Send(ctx context.Context, chatID int64, langCode string, report *Report) error {
+	_, err := s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		ParseMode: models.ParseModeHTML,
+		Text:      s.Summary(langCode, report),
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := s.CSV(report)
+	if err != nil {
+		return err
+	}
+	_, err = s.telegramBot.SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID: chatID,
+		Document: &models.InputFileUpload{
+			Filename: fmt.Sprintf("report_%s_%s_%s.csv", report.Granularity, report.From.Format("20060102"), report.To.AddDate(0, 0, -1).Format("20060102")),
+			Data:     bytes.NewReader(data),
+		},
+	})
+	return err
+}
+
+// SendDaily sends yesterday's summary to the owner.
+func (s *Service) SendDaily(ctx context.Context) error {
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	report, err := s.Build(ctx, database.ReportGranularityDay, to.AddDate(0, 0, -1), to)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    config.GetAdminTelegramId(),
+		ParseMode: models.ParseModeHTML,
+		Text:      s.Summary("", report),
+	})
+	return err
+}
+
+func sortedKeys(m map[string]*currencyTotal) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
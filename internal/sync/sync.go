@@ -2,100 +2,446 @@ package sync
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
 	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
 	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/metrics"
+	"remnawave-tg-shop-bot/internal/notifier"
 	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/translation"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// CallbackApply is the callback data of the button that applies a dry-run diff.
+const CallbackApply = "admin_sync_apply"
+
+// diffPreviewSize is how many customers of each kind are listed in the diff message.
+const diffPreviewSize = 10
+
+var ErrNoPanelUsers = errors.New("no users found in remnawave")
+
+// ErrSyncRunning is returned when a sync is started while another one has not finished yet.
+var ErrSyncRunning = errors.New("sync is already running")
+
 type SyncService struct {
-	client             *remnawave.Client
+	panels             *remnawave.Panels
 	customerRepository *database.CustomerRepository
+	eventRepository    *database.SubscriptionEventRepository
+	notifier           *notifier.Notifier
+	telegramBot        *bot.Bot
+	translation        *translation.Manager
+	// running is shared by the copies of the service, so only one sync writes to the database at a time.
+	running *atomic.Bool
 }
 
-func NewSyncService(client *remnawave.Client, customerRepository *database.CustomerRepository) *SyncService {
+func NewSyncService(panels *remnawave.Panels, customerRepository *database.CustomerRepository, eventRepository *database.SubscriptionEventRepository, notifier *notifier.Notifier, telegramBot *bot.Bot, translation *translation.Manager) *SyncService {
 	return &SyncService{
-		client: client, customerRepository: customerRepository,
+		panels: panels, customerRepository: customerRepository, eventRepository: eventRepository, notifier: notifier,
+		telegramBot: telegramBot, translation: translation, running: &atomic.Bool{},
+	}
+}
+
+// CustomerUpdate is a customer whose panel fields differ from the database.
+type CustomerUpdate struct {
+	Previous database.Customer
+	Customer database.Customer
+}
+
+func (u CustomerUpdate) ExpireChanged() bool {
+	if u.Previous.ExpireAt == nil || u.Customer.ExpireAt == nil {
+		return u.Previous.ExpireAt != u.Customer.ExpireAt
+	}
+	return !u.Previous.ExpireAt.Equal(*u.Customer.ExpireAt)
+}
+
+func (u CustomerUpdate) LinkChanged() bool {
+	if u.Previous.SubscriptionLink == nil || u.Customer.SubscriptionLink == nil {
+		return u.Previous.SubscriptionLink != u.Customer.SubscriptionLink
+	}
+	return *u.Previous.SubscriptionLink != *u.Customer.SubscriptionLink
+}
+
+func (u CustomerUpdate) PanelUserChanged() bool {
+	if u.Previous.Panel != u.Customer.Panel {
+		return true
 	}
+	if u.Previous.PanelUUID == nil || u.Customer.PanelUUID == nil {
+		return u.Previous.PanelUUID != u.Customer.PanelUUID
+	}
+	return *u.Previous.PanelUUID != *u.Customer.PanelUUID
+}
+
+// Plan is the difference between the panel and the database. Customers whose fields already match are not in it.
+type Plan struct {
+	PanelUsers    int
+	Create        []database.Customer
+	Update        []CustomerUpdate
+	Missing       []database.Customer
+	MissingAction string
+	trafficLimits map[int64]int64
+}
+
+func (p *Plan) Empty() bool {
+	return len(p.Create) == 0 && len(p.Update) == 0 && (len(p.Missing) == 0 || p.MissingAction == "keep")
+}
+
+// Sync computes the plan and applies it right away, the result goes to the admin event feed. It returns
+// ErrSyncRunning without doing anything while another sync is running.
+func (s SyncService) Sync() error {
+	if !s.running.CompareAndSwap(false, true) {
+		return ErrSyncRunning
+	}
+	defer s.running.Store(false)
+	s.sync()
+	return nil
 }
 
-func (s SyncService) Sync() {
+// SyncInBackground is Sync that does not wait for the result. The ErrSyncRunning check is done before it returns.
+func (s SyncService) SyncInBackground() error {
+	if !s.running.CompareAndSwap(false, true) {
+		return ErrSyncRunning
+	}
+	go func() {
+		defer s.running.Store(false)
+		s.sync()
+	}()
+	return nil
+}
+
+func (s SyncService) sync() {
 	slog.Info("Starting sync")
 	ctx := context.Background()
-	var telegramIDs []int64
-	telegramIDsSet := make(map[int64]int64)
-	var mappedUsers []database.Customer
-	users, err := s.client.GetUsers(ctx)
+	plan, err := s.Plan(ctx)
+	if errors.Is(err, ErrNoPanelUsers) {
+		slog.Error("No users found in remnawave")
+		return
+	}
 	if err != nil {
-		slog.Error("Error while getting users from remnawave", err)
+		slog.Error("Error while planning sync", "error", err)
+		s.notifier.SyncFailed(err)
+		metrics.SyncFailed()
 		return
 	}
-	if users == nil || len(*users) == 0 {
-		slog.Error("No users found in remnawave")
+
+	if err := s.Apply(ctx, plan); err != nil {
+		slog.Error("Error while applying sync", "error", err)
+		s.notifier.SyncFailed(err)
+		metrics.SyncFailed()
 		return
 	}
+	slog.Info("Synchronization completed")
+	s.notifier.SyncCompleted(plan.PanelUsers, len(plan.Create), len(plan.Update))
+	metrics.SyncSucceeded(len(plan.Create), len(plan.Update))
+}
 
-	for _, user := range *users {
-		if user.TelegramId.Null {
-			continue
-		}
-		if _, exists := telegramIDsSet[int64(user.TelegramId.Value)]; exists {
-			continue
-		}
+// RunScheduled is the cron entry point: it applies the sync, or with SYNC_DRY_RUN sends the diff to the owner.
+func (s SyncService) RunScheduled(ctx context.Context) error {
+	if !config.SyncDryRun() {
+		return s.Sync()
+	}
 
-		telegramIDsSet[int64(user.TelegramId.Value)] = int64(user.TelegramId.Value)
+	plan, err := s.Plan(ctx)
+	if err != nil {
+		return err
+	}
+	if plan.Empty() {
+		slog.Info("Scheduled sync dry run found no changes")
+		return nil
+	}
 
-		telegramIDs = append(telegramIDs, int64(user.TelegramId.Value))
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    config.GetAdminTelegramId(),
+		ParseMode: models.ParseModeHTML,
+		Text:      s.Diff("", plan),
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{{Text: s.translation.GetText("", "sync_apply_button"), CallbackData: CallbackApply}},
+			},
+		},
+	})
+	return err
+}
 
-		mappedUsers = append(mappedUsers, database.Customer{
-			TelegramID:       int64(user.TelegramId.Value),
-			ExpireAt:         &user.ExpireAt,
-			SubscriptionLink: &user.SubscriptionUrl,
-		})
+// Plan downloads the users of every panel and compares them with the customers without changing anything. A
+// customer stays on its panel while that panel has a user for it, otherwise it moves to the first panel that has
+// one, unless the customer chose the location and gets the user there with the next purchase. When several panel
+// users share a telegram id, the one stored on the customer wins, see remnawave.PickUser.
+func (s SyncService) Plan(ctx context.Context) (*Plan, error) {
+	var telegramIDs []int64
+	usersByTelegramID := make(map[int64]map[string][]remapi.UserDto)
+	panelUsers := 0
+	for _, name := range s.panels.Names() {
+		users, err := s.panels.Get(name).GetUsers(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get users from remnawave panel %s: %w", name, err)
+		}
+		panelUsers += len(*users)
+
+		for _, user := range *users {
+			if user.TelegramId.Null {
+				continue
+			}
+			telegramID := int64(user.TelegramId.Value)
+			if _, exists := usersByTelegramID[telegramID]; !exists {
+				telegramIDs = append(telegramIDs, telegramID)
+				usersByTelegramID[telegramID] = make(map[string][]remapi.UserDto)
+			}
+			usersByTelegramID[telegramID][name] = append(usersByTelegramID[telegramID][name], user)
+		}
+	}
+	if panelUsers == 0 {
+		return nil, ErrNoPanelUsers
 	}
 
 	existingCustomers, err := s.customerRepository.FindByTelegramIds(ctx, telegramIDs)
 	if err != nil {
-		slog.Error("Error while searching users by telegram ids")
-		return
+		return nil, err
 	}
 	existingMap := make(map[int64]database.Customer)
 	for _, cust := range existingCustomers {
 		existingMap[cust.TelegramID] = cust
 	}
 
-	var toCreate []database.Customer
-	var toUpdate []database.Customer
-
-	for _, cust := range mappedUsers {
-		if _, found := existingMap[cust.TelegramID]; found {
-			cust.CreatedAt = time.Now()
-			toUpdate = append(toUpdate, cust)
-		} else {
-			toCreate = append(toCreate, cust)
+	plan := &Plan{PanelUsers: panelUsers, MissingAction: config.SyncMissingUsers(), trafficLimits: make(map[int64]int64)}
+	now := time.Now()
+	for _, telegramID := range telegramIDs {
+		previous, found := existingMap[telegramID]
+		if found && s.awaitsChosenPanel(previous, usersByTelegramID[telegramID]) {
+			continue
+		}
+		panel := s.customerPanel(previous, usersByTelegramID[telegramID])
+		user := remnawave.PickUser(usersByTelegramID[telegramID][s.panels.Resolve(panel)], telegramID, previous.PanelUUID)
+		if limit, ok := user.TrafficLimitBytes.Get(); ok {
+			plan.trafficLimits[telegramID] = int64(limit)
+		}
+		cust := database.Customer{
+			TelegramID:       telegramID,
+			ExpireAt:         &user.ExpireAt,
+			SubscriptionLink: &user.SubscriptionUrl,
+			PanelUUID:        &user.UUID,
+			PanelShortUUID:   &user.ShortUuid,
+			Panel:            panel,
+		}
+		if !found {
+			// The panel user already has a subscription, so the imported customer does not get the trial.
+			trialSource := database.TrialSourcePanel
+			cust.TrialUsedAt = &now
+			cust.TrialSource = &trialSource
+			plan.Create = append(plan.Create, cust)
+			continue
+		}
+		update := CustomerUpdate{Previous: previous, Customer: cust}
+		if update.ExpireChanged() || update.LinkChanged() || update.PanelUserChanged() || previous.ArchivedAt != nil {
+			plan.Update = append(plan.Update, update)
 		}
 	}
 
-	err = s.customerRepository.DeleteByNotInTelegramIds(ctx, telegramIDs)
+	plan.Missing, err = s.customerRepository.FindMissingFromPanel(ctx, telegramIDs)
 	if err != nil {
-		slog.Error("Error while deleting users")
+		return nil, err
 	}
-	slog.Info("Deleted clients which not exist in panel")
+	return plan, nil
+}
 
-	if len(toCreate) > 0 {
-		if err := s.customerRepository.CreateBatch(ctx, toCreate); err != nil {
-			slog.Error("Error while creating users")
-		} else {
-			slog.Info("Created clients", "count", len(toCreate))
+// Apply writes the plan: creates new customers, updates only the changed ones and archives or deletes
+// customers missing from the panel according to SYNC_MISSING_USERS. Customers that used the trial are archived
+// instead of deleted, so that they cannot take it again with a new customer record.
+func (s SyncService) Apply(ctx context.Context, plan *Plan) error {
+	var missingIDs, trialUsedIDs []int64
+	for _, cust := range plan.Missing {
+		if plan.MissingAction == "delete" && cust.TrialUsedAt != nil {
+			trialUsedIDs = append(trialUsedIDs, cust.ID)
+			continue
+		}
+		missingIDs = append(missingIDs, cust.ID)
+	}
+	switch plan.MissingAction {
+	case "delete":
+		if err := s.customerRepository.DeleteByIds(ctx, missingIDs); err != nil {
+			return err
+		}
+		if err := s.customerRepository.ArchiveByIds(ctx, trialUsedIDs); err != nil {
+			return err
 		}
+		slog.Info("Deleted clients which not exist in panel", "count", len(missingIDs), "archived", len(trialUsedIDs))
+	case "archive":
+		if err := s.customerRepository.ArchiveByIds(ctx, missingIDs); err != nil {
+			return err
+		}
+		slog.Info("Archived clients which not exist in panel", "count", len(missingIDs))
 	}
 
-	if len(toUpdate) > 0 {
+	if len(plan.Create) > 0 {
+		if err := s.customerRepository.CreateBatch(ctx, plan.Create); err != nil {
+			return err
+		}
+		slog.Info("Created clients", "count", len(plan.Create))
+	}
+
+	if len(plan.Update) > 0 {
+		toUpdate := make([]database.Customer, 0, len(plan.Update))
+		for _, update := range plan.Update {
+			toUpdate = append(toUpdate, update.Customer)
+		}
 		if err := s.customerRepository.UpdateBatch(ctx, toUpdate); err != nil {
-			slog.Error("Error while updating users")
-		} else {
-			slog.Info("Updated clients", "count", len(toUpdate))
+			return err
 		}
+		slog.Info("Updated clients", "count", len(plan.Update))
+		s.recordOverwrites(ctx, plan.Update, plan.trafficLimits)
+	}
+	return nil
+}
+
+// customerPanel returns the panel the customer is kept on: its own one when that panel has a user for it, otherwise
+// the first panel in configuration order that does.
+func (s SyncService) customerPanel(customer database.Customer, users map[string][]remapi.UserDto) string {
+	if len(users[s.panels.Resolve(customer.Panel)]) > 0 {
+		return customer.Panel
+	}
+	for _, name := range s.panels.Names() {
+		if len(users[name]) > 0 {
+			return name
+		}
+	}
+	return customer.Panel
+}
+
+// awaitsChosenPanel tells whether the customer switched to a location that has no user for it yet. Changing the
+// location clears the panel user, and the old users in other panels must not pull the customer back.
+func (s SyncService) awaitsChosenPanel(customer database.Customer, users map[string][]remapi.UserDto) bool {
+	return customer.Panel != "" && customer.PanelUUID == nil && len(users[s.panels.Resolve(customer.Panel)]) == 0
+}
+
+// BackfillPanelUsers stores the panel user of customers created before the bot kept the panel uuid. It runs on
+// startup and does nothing once every customer has one.
+func (s SyncService) BackfillPanelUsers(ctx context.Context) error {
+	customers, err := s.customerRepository.FindWithoutPanelUUID(ctx)
+	if err != nil {
+		return err
+	}
+	if len(customers) == 0 {
+		return nil
+	}
+
+	filled := 0
+	for _, name := range s.panels.Names() {
+		users, err := s.panels.Get(name).GetUsers(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get users from remnawave panel %s: %w", name, err)
+		}
+		usersByTelegramID := make(map[int64][]remapi.UserDto)
+		for _, user := range *users {
+			if user.TelegramId.Null {
+				continue
+			}
+			usersByTelegramID[int64(user.TelegramId.Value)] = append(usersByTelegramID[int64(user.TelegramId.Value)], user)
+		}
+
+		for telegramID, panel := range customers {
+			if s.panels.Resolve(panel) != name {
+				continue
+			}
+			user := remnawave.PickUser(usersByTelegramID[telegramID], telegramID, nil)
+			if user == nil {
+				continue
+			}
+			if err := s.customerRepository.SetPanelUser(ctx, telegramID, user.UUID, user.ShortUuid); err != nil {
+				return err
+			}
+			filled++
+		}
+	}
+	slog.Info("Backfilled panel users", "count", filled, "without_panel_user", len(customers)-filled)
+	return nil
+}
+
+// Diff renders the plan: counts of each kind and the first customers of each list.
+func (s SyncService) Diff(langCode string, plan *Plan) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf(s.translation.GetText(langCode, "sync_diff_title"), plan.PanelUsers))
+	if plan.Empty() {
+		text.WriteString("\n\n" + s.translation.GetText(langCode, "sync_diff_empty"))
+		return text.String()
+	}
+
+	text.WriteString("\n\n" + fmt.Sprintf(s.translation.GetText(langCode, "sync_diff_create"), len(plan.Create)))
+	for i, cust := range plan.Create {
+		if i == diffPreviewSize {
+			text.WriteString("\n…")
+			break
+		}
+		text.WriteString(fmt.Sprintf("\n+ <code>%d</code> → %s", cust.TelegramID, formatDate(cust.ExpireAt)))
+	}
+
+	text.WriteString("\n\n" + fmt.Sprintf(s.translation.GetText(langCode, "sync_diff_update"), len(plan.Update)))
+	for i, update := range plan.Update {
+		if i == diffPreviewSize {
+			text.WriteString("\n…")
+			break
+		}
+		var changes []string
+		if update.ExpireChanged() {
+			changes = append(changes, formatDate(update.Previous.ExpireAt)+" → "+formatDate(update.Customer.ExpireAt))
+		}
+		if update.LinkChanged() {
+			changes = append(changes, s.translation.GetText(langCode, "sync_diff_link_changed"))
+		}
+		if update.PanelUserChanged() {
+			changes = append(changes, s.translation.GetText(langCode, "sync_diff_panel_user_changed"))
+		}
+		if update.Previous.ArchivedAt != nil {
+			changes = append(changes, s.translation.GetText(langCode, "sync_diff_restored"))
+		}
+		text.WriteString(fmt.Sprintf("\n~ <code>%d</code>: %s", update.Customer.TelegramID, strings.Join(changes, ", ")))
+	}
+
+	text.WriteString("\n\n" + fmt.Sprintf(s.translation.GetText(langCode, "sync_diff_missing_"+plan.MissingAction), len(plan.Missing)))
+	for i, cust := range plan.Missing {
+		if i == diffPreviewSize {
+			text.WriteString("\n…")
+			break
+		}
+		text.WriteString(fmt.Sprintf("\n- <code>%d</code>", cust.TelegramID))
+	}
+	return text.String()
+}
+
+func formatDate(t *time.Time) string {
+	if t == nil {
+		return "—"
+	}
+	return t.Format("02.01.2006")
+}
+
+// recordOverwrites writes an audit entry for every customer whose expiration date was replaced by the panel value.
+func (s SyncService) recordOverwrites(ctx context.Context, updates []CustomerUpdate, trafficLimits map[int64]int64) {
+	var events []database.SubscriptionEvent
+	for _, update := range updates {
+		if !update.ExpireChanged() {
+			continue
+		}
+		event := database.SubscriptionEvent{
+			CustomerID:       update.Previous.ID,
+			TelegramID:       update.Customer.TelegramID,
+			Source:           database.SubscriptionEventSync,
+			Actor:            database.ActorSync,
+			PreviousExpireAt: update.Previous.ExpireAt,
+			NewExpireAt:      update.Customer.ExpireAt,
+		}
+		if limit, ok := trafficLimits[update.Customer.TelegramID]; ok {
+			event.TrafficLimit = &limit
+		}
+		events = append(events, event)
+	}
+
+	if err := s.eventRepository.CreateBatch(ctx, events); err != nil {
+		slog.Error("Error recording sync subscription events", "error", err)
 	}
-	slog.Info("Synchronization completed")
 }
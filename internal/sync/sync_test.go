@@ -0,0 +1,61 @@
+package sync
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+	"github.com/google/uuid"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+)
+
+func TestCustomerPanelKeepsChosenLocation(t *testing.T) {
+	panels := remnawave.NewPanels()
+	panels.Add("eu", remnawave.NewFakePanel())
+	panels.Add("ru", remnawave.NewFakePanel())
+	s := SyncService{panels: panels}
+
+	panelUUID := uuid.New()
+	euUser := map[string][]remapi.UserDto{"eu": {{UUID: panelUUID}}}
+	tests := []struct {
+		name     string
+		customer database.Customer
+		users    map[string][]remapi.UserDto
+		awaits   bool
+		panel    string
+	}{
+		{"switched to a location without a user yet", database.Customer{Panel: "ru"}, euUser, true, "eu"},
+		{"got the user in the chosen location", database.Customer{Panel: "ru"}, map[string][]remapi.UserDto{"eu": {{}}, "ru": {{}}}, false, "ru"},
+		{"customer without a location", database.Customer{}, euUser, false, ""},
+		{"panel user deleted in the panel", database.Customer{Panel: "ru", PanelUUID: &panelUUID}, euUser, false, "eu"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if awaits := s.awaitsChosenPanel(tt.customer, tt.users); awaits != tt.awaits {
+				t.Errorf("awaitsChosenPanel = %v, want %v", awaits, tt.awaits)
+			}
+			if !tt.awaits {
+				if panel := s.customerPanel(tt.customer, tt.users); panel != tt.panel {
+					t.Errorf("customerPanel = %q, want %q", panel, tt.panel)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncRefusesToRunTwice(t *testing.T) {
+	s := SyncService{running: &atomic.Bool{}}
+	s.running.Store(true)
+
+	if err := s.Sync(); !errors.Is(err, ErrSyncRunning) {
+		t.Errorf("Sync error = %v, want ErrSyncRunning", err)
+	}
+	if err := s.SyncInBackground(); !errors.Is(err, ErrSyncRunning) {
+		t.Errorf("SyncInBackground error = %v, want ErrSyncRunning", err)
+	}
+	if !s.running.Load() {
+		t.Error("the refused sync released the lock of the running one")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"remnawave-tg-shop-bot/internal/config"
 	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/notifier"
 	"remnawave-tg-shop-bot/internal/payment"
 	"strings"
 	"time"
@@ -21,6 +22,7 @@ import (
 type Client struct {
 	paymentService     *payment.PaymentService
 	customerRepository *database.CustomerRepository
+	notifier           *notifier.Notifier
 }
 
 const (
@@ -28,10 +30,11 @@ const (
 	NewSubscription       = "new_subscription"
 )
 
-func NewClient(paymentService *payment.PaymentService, customerRepository *database.CustomerRepository) *Client {
+func NewClient(paymentService *payment.PaymentService, customerRepository *database.CustomerRepository, notifier *notifier.Notifier) *Client {
 	return &Client{
 		paymentService:     paymentService,
 		customerRepository: customerRepository,
+		notifier:           notifier,
 	}
 }
 
@@ -104,6 +107,14 @@ func (c *Client) newSubscriptionHandler(ctx context.Context, wh SubscriptionWebh
 	months := convertPeriodToMonths(wh.Payload.Period)
 
 	customer, err := c.customerRepository.FindByTelegramId(ctx, wh.Payload.TelegramUserID)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		c.notifier.ProvisioningError(0, wh.Payload.TelegramUserID, payment.ErrCustomerNotFound)
+		return payment.ErrCustomerNotFound
+	}
+
 	_, purchaseId, err := c.paymentService.CreatePurchase(ctx, float64(wh.Payload.Amount), months, customer, database.InvoiceTypeTribute)
 
 	if err != nil {
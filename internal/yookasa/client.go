@@ -10,6 +10,7 @@ import (
 	"log"
 	"net/http"
 	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/metrics"
 	"strconv"
 	"time"
 
@@ -95,7 +96,9 @@ func (c *Client) CreateInvoice(ctx context.Context, amount int, month int, custo
 	return payment, nil
 }
 
-func (c *Client) CreatePayment(ctx context.Context, request PaymentRequest, idempotencyKey string) (*Payment, error) {
+func (c *Client) CreatePayment(ctx context.Context, request PaymentRequest, idempotencyKey string) (_ *Payment, err error) {
+	defer metrics.ObservePaymentProvider("yookasa", "create_payment", time.Now(), &err)
+
 	paymentURL := fmt.Sprintf("%s/payments", c.baseURL)
 
 	reqBody, err := json.Marshal(request)
@@ -134,7 +137,9 @@ func (c *Client) CreatePayment(ctx context.Context, request PaymentRequest, idem
 	return &payment, nil
 }
 
-func (c *Client) GetPayment(ctx context.Context, paymentID uuid.UUID) (*Payment, error) {
+func (c *Client) GetPayment(ctx context.Context, paymentID uuid.UUID) (_ *Payment, err error) {
+	defer metrics.ObservePaymentProvider("yookasa", "get_payment", time.Now(), &err)
+
 	paymentURL := fmt.Sprintf("%s/payments/%s", c.baseURL, paymentID)
 
 	var payment *Payment
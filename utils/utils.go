@@ -1,8 +1,10 @@
 package utils
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func MaskHalfInt(input int) string {
@@ -25,3 +27,57 @@ func MaskHalf(input string) string {
 	maskedLength := length - visibleLength
 	return input[:visibleLength] + strings.Repeat("*", maskedLength)
 }
+
+// FormatDuration returns a short duration like "3d 4h", "5h 12m" or "7m".
+func FormatDuration(d time.Duration) string {
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+// CountryFlag returns the flag emoji of a two-letter country code, an empty string for other codes.
+func CountryFlag(code string) string {
+	code = strings.ToUpper(code)
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return ""
+	}
+	return string([]rune{rune(code[0]) - 'A' + 0x1F1E6, rune(code[1]) - 'A' + 0x1F1E6})
+}
+
+// accountIDDates are approximate registration dates of Telegram user ids. Ids are given out in increasing order, with
+// a jump past 2^32 in late 2021.
+var accountIDDates = []struct {
+	id   int64
+	date time.Time
+}{
+	{0, time.Date(2013, 8, 1, 0, 0, 0, 0, time.UTC)},
+	{1_000_000_000, time.Date(2019, 9, 1, 0, 0, 0, 0, time.UTC)},
+	{2_000_000_000, time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)},
+	{5_000_000_000, time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)},
+	{6_000_000_000, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+	{7_000_000_000, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	{8_000_000_000, time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)},
+}
+
+// EstimateAccountCreated guesses when a Telegram account was registered from its id by interpolating between known
+// ids. It is a heuristic accurate to a few months; ids past the last known one are extrapolated.
+func EstimateAccountCreated(telegramID int64) time.Time {
+	i := 1
+	for i < len(accountIDDates)-1 && telegramID > accountIDDates[i].id {
+		i++
+	}
+	from, to := accountIDDates[i-1], accountIDDates[i]
+	if telegramID < from.id {
+		return from.date
+	}
+	perID := float64(to.date.Sub(from.date)) / float64(to.id-from.id)
+	return from.date.Add(time.Duration(float64(telegramID-from.id) * perID))
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateAccountCreated(t *testing.T) {
+	tests := []struct {
+		id   int64
+		want time.Time
+	}{
+		{1_000_000_000, time.Date(2019, 9, 1, 0, 0, 0, 0, time.UTC)},
+		{5_500_000_000, time.Date(2022, 6, 16, 12, 0, 0, 0, time.UTC)},
+		{9_000_000_000, time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := EstimateAccountCreated(tt.id); got.Sub(tt.want).Abs() > 48*time.Hour {
+			t.Errorf("EstimateAccountCreated(%d) = %s, want about %s", tt.id, got, tt.want)
+		}
+	}
+	if EstimateAccountCreated(100).After(EstimateAccountCreated(7_900_000_000)) {
+		t.Error("older ids must be estimated as older accounts")
+	}
+}